@@ -0,0 +1,192 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+/*
+Package artifact keeps the large payloads of analyses (alignment,
+result trees and logs) out of the database.
+
+If no store is configured (nil Store), payloads are kept in the
+analysis itself, and then in the database, as before.
+*/
+package artifact
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/evolbioinfo/booster-web/model"
+)
+
+// Names of the artifacts of an analysis
+const (
+	ALIGNMENT     = "alignment.fa" // Input alignment (when trees are inferred)
+	FBP_TREE      = "fbp.nh"       // Tree with fbp supports
+	TBE_NORM_TREE = "tbe_norm.nh"  // Tree with normalized tbe supports
+	TBE_RAW_TREE  = "tbe_raw.nh"   // Tree with raw tbe supports <id|avg_dist|depth>
+	TBE_LOGS      = "tbe_logs.txt" // TBE log file
+)
+
+var Names = []string{ALIGNMENT, FBP_TREE, TBE_NORM_TREE, TBE_RAW_TREE, TBE_LOGS}
+
+// Content types of the artifacts
+var contentTypes = map[string]string{
+	ALIGNMENT:     "text/x-fasta; charset=utf-8",
+	FBP_TREE:      "text/x-nh; charset=utf-8",
+	TBE_NORM_TREE: "text/x-nh; charset=utf-8",
+	TBE_RAW_TREE:  "text/x-nh; charset=utf-8",
+	TBE_LOGS:      "text/plain; charset=utf-8",
+}
+
+var ErrNotFound = errors.New("Artifact does not exist")
+
+// Storage of artifacts, identified by keys of the form "<analysis id>/<name>"
+type Store interface {
+	// Stores the content under the given key, replacing any previous one
+	Put(key string, content io.Reader) error
+	// Returns a reader of the content, or ErrNotFound
+	Get(key string) (io.ReadCloser, error)
+	// Deletes the content, if it exists
+	Delete(key string) error
+}
+
+func Key(id, name string) string {
+	return id + "/" + name
+}
+
+// True if name is a known artifact name
+func ValidName(name string) bool {
+	for _, n := range Names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Content type of the artifact, given its name
+func ContentType(name string) string {
+	if t, ok := contentTypes[name]; ok {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// Field of the analysis holding the artifact when it is not in a store
+func field(a *model.Analysis, name string) *string {
+	switch name {
+	case ALIGNMENT:
+		return &a.Alignfile
+	case FBP_TREE:
+		return &a.FbpTree
+	case TBE_NORM_TREE:
+		return &a.TbeNormTree
+	case TBE_RAW_TREE:
+		return &a.TbeRawTree
+	case TBE_LOGS:
+		return &a.TbeLogs
+	default:
+		return nil
+	}
+}
+
+// Saves the content of the artifact of the analysis: in the store if
+// any, or in the analysis otherwise (the database row then keeps it)
+func Save(s Store, a *model.Analysis, name, content string) error {
+	f := field(a, name)
+	if f == nil {
+		return ErrNotFound
+	}
+	if s == nil {
+		*f = content
+		return nil
+	}
+	*f = ""
+	return s.Put(Key(a.Id, name), strings.NewReader(content))
+}
+
+// Opens the artifact of the analysis.
+//
+// Analyses stored before the store was configured still
+// have their artifacts in the database: they are read from there.
+func Open(s Store, a *model.Analysis, name string) (io.ReadCloser, error) {
+	f := field(a, name)
+	if f == nil {
+		return nil, ErrNotFound
+	}
+	if *f != "" {
+		return ioutil.NopCloser(strings.NewReader(*f)), nil
+	}
+	if s == nil {
+		return nil, ErrNotFound
+	}
+	return s.Get(Key(a.Id, name))
+}
+
+// Returns the whole content of the artifact, empty if it does not exist
+func Read(s Store, a *model.Analysis, name string) (content string, err error) {
+	var r io.ReadCloser
+	var b []byte
+
+	if r, err = Open(s, a, name); err != nil {
+		if err == ErrNotFound {
+			err = nil
+		}
+		return
+	}
+	defer r.Close()
+	if b, err = ioutil.ReadAll(r); err != nil {
+		return
+	}
+	content = string(b)
+	return
+}
+
+// Returns a copy of the analysis with all its artifacts
+func Load(s Store, a *model.Analysis) (full *model.Analysis, err error) {
+	c := *a
+	full = &c
+	if s == nil {
+		return
+	}
+	for _, name := range Names {
+		if *field(full, name), err = Read(s, a, name); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Deletes all the artifacts of the analysis from the store
+func Delete(s Store, id string) (err error) {
+	if s == nil {
+		return
+	}
+	for _, name := range Names {
+		if err = s.Delete(Key(id, name)); err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,117 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+package artifact
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/evolbioinfo/booster-web/model"
+)
+
+func TestSaveRead(t *testing.T) {
+	s, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &model.Analysis{Id: "id"}
+
+	// Without store, the artifact is kept in the analysis
+	if err = Save(nil, a, FBP_TREE, "(a,b);"); err != nil {
+		t.Fatal(err)
+	}
+	if a.FbpTree != "(a,b);" {
+		t.Errorf("Expected the tree in the analysis, got %q", a.FbpTree)
+	}
+
+	// With a store, it is moved to the store
+	if err = Save(s, a, FBP_TREE, "(c,d);"); err != nil {
+		t.Fatal(err)
+	}
+	if a.FbpTree != "" {
+		t.Errorf("Expected no tree in the analysis, got %q", a.FbpTree)
+	}
+	if content, err := Read(s, a, FBP_TREE); err != nil || content != "(c,d);" {
+		t.Errorf("Expected %q, got %q (%v)", "(c,d);", content, err)
+	}
+
+	// Missing artifacts are empty
+	if content, err := Read(s, a, TBE_LOGS); err != nil || content != "" {
+		t.Errorf("Expected an empty artifact, got %q (%v)", content, err)
+	}
+	if _, err = Open(s, a, "unknown"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound for an unknown artifact, got %v", err)
+	}
+}
+
+func TestOpenFallsBackToDatabase(t *testing.T) {
+	s, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Analysis stored before the store was configured
+	a := &model.Analysis{Id: "old", TbeNormTree: "(a,b,c);"}
+	if err = s.Put(Key(a.Id, TBE_NORM_TREE), strings.NewReader("(d,e,f);")); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := Open(s, a, TBE_NORM_TREE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ := ioutil.ReadAll(r)
+	r.Close()
+	if string(content) != "(a,b,c);" {
+		t.Errorf("Expected the tree kept in the database, got %q", content)
+	}
+
+	if _, err = Open(nil, &model.Analysis{Id: "old"}, TBE_NORM_TREE); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound without store, got %v", err)
+	}
+
+	full, err := Load(s, &model.Analysis{Id: "old"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if full.TbeNormTree != "(d,e,f);" {
+		t.Errorf("Expected the tree of the store, got %q", full.TbeNormTree)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	s, f := newTestS3Store(t)
+	a := &model.Analysis{Id: "id"}
+	for _, name := range Names {
+		if err := Save(s, a, name, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := Delete(s, a.Id); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.objects) != 0 {
+		t.Errorf("Expected no object left, got %d", len(f.objects))
+	}
+}
@@ -0,0 +1,117 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+package artifact
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Store keeping artifacts in a local directory, one
+// sub-directory per analysis
+type LocalStore struct {
+	dir string
+}
+
+// Returns a new store in the given directory, created if needed
+func NewLocalStore(dir string) (s *LocalStore, err error) {
+	if dir == "" {
+		return nil, errors.New("Artifact directory must not be empty")
+	}
+	if err = os.MkdirAll(dir, 0750); err != nil {
+		return
+	}
+	s = &LocalStore{dir}
+	return
+}
+
+// Path of the file of the given key, that must stay inside the store directory
+func (s *LocalStore) path(key string) (string, error) {
+	p := filepath.Join(s.dir, filepath.FromSlash(key))
+	if !strings.HasPrefix(p, filepath.Clean(s.dir)+string(filepath.Separator)) {
+		return "", errors.New("Invalid artifact key: " + key)
+	}
+	return p, nil
+}
+
+// The content is first written in a temporary file, so
+// that readers never see a partially written artifact
+func (s *LocalStore) Put(key string, content io.Reader) (err error) {
+	var p string
+	var f *os.File
+
+	if p, err = s.path(key); err != nil {
+		return
+	}
+	if err = os.MkdirAll(filepath.Dir(p), 0750); err != nil {
+		return
+	}
+	if f, err = ioutil.TempFile(filepath.Dir(p), ".tmp-"); err != nil {
+		return
+	}
+	if _, err = io.Copy(f, content); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return
+	}
+	if err = f.Close(); err != nil {
+		os.Remove(f.Name())
+		return
+	}
+	if err = os.Rename(f.Name(), p); err != nil {
+		os.Remove(f.Name())
+	}
+	return
+}
+
+func (s *LocalStore) Get(key string) (r io.ReadCloser, err error) {
+	var p string
+
+	if p, err = s.path(key); err != nil {
+		return
+	}
+	if r, err = os.Open(p); os.IsNotExist(err) {
+		err = ErrNotFound
+	}
+	return
+}
+
+// Removes the file, and the directory of the analysis once empty
+func (s *LocalStore) Delete(key string) (err error) {
+	var p string
+
+	if p, err = s.path(key); err != nil {
+		return
+	}
+	if err = os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return
+	}
+	// Fails as long as other artifacts of the analysis remain
+	os.Remove(filepath.Dir(p))
+	return nil
+}
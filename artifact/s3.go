@@ -0,0 +1,233 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+package artifact
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Store keeping artifacts in a bucket of a S3 compatible object
+// storage (AWS S3, MinIO, Ceph, etc.).
+//
+// Objects are addressed in path style (endpoint/bucket/key), and
+// requests are signed with AWS signature version 4.
+type S3Store struct {
+	endpoint  *url.URL
+	region    string
+	bucket    string
+	prefix    string // Prefix of all object keys, may be empty
+	accessKey string
+	secretKey string
+	client    *http.Client
+}
+
+// Returns a new store in the given bucket.
+//
+// endpoint is the url of the server, ex: https://s3.eu-west-3.amazonaws.com
+// or http://localhost:9000. If region is empty, us-east-1 is used.
+func NewS3Store(endpoint, region, bucket, prefix, accessKey, secretKey string) (s *S3Store, err error) {
+	var u *url.URL
+
+	if u, err = url.Parse(endpoint); err != nil {
+		return
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, errors.New("S3 endpoint must be an http(s) url: " + endpoint)
+	}
+	if bucket == "" {
+		return nil, errors.New("S3 bucket must not be empty")
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+	s = &S3Store{
+		endpoint:  u,
+		region:    region,
+		bucket:    bucket,
+		prefix:    prefix,
+		accessKey: accessKey,
+		secretKey: secretKey,
+		client:    &http.Client{Timeout: 5 * time.Minute},
+	}
+	return
+}
+
+// The content is read in memory: S3 needs its length and its hash
+func (s *S3Store) Put(key string, content io.Reader) (err error) {
+	var body []byte
+	var resp *http.Response
+
+	if body, err = ioutil.ReadAll(content); err != nil {
+		return
+	}
+	if resp, err = s.do(http.MethodPut, key, body); err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s3Error(resp)
+	}
+	return
+}
+
+func (s *S3Store) Get(key string) (r io.ReadCloser, err error) {
+	var resp *http.Response
+
+	if resp, err = s.do(http.MethodGet, key, nil); err != nil {
+		return
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		r = resp.Body
+	case http.StatusNotFound:
+		resp.Body.Close()
+		err = ErrNotFound
+	default:
+		err = s3Error(resp)
+		resp.Body.Close()
+	}
+	return
+}
+
+func (s *S3Store) Delete(key string) (err error) {
+	var resp *http.Response
+
+	if resp, err = s.do(http.MethodDelete, key, nil); err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	// Deleting a missing object is not an error
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return s3Error(resp)
+	}
+	return
+}
+
+// Sends a signed request on the object of the given key
+func (s *S3Store) do(method, key string, body []byte) (*http.Response, error) {
+	u := *s.endpoint
+	u.Path = strings.TrimRight(u.Path, "/") + "/" + s.bucket + "/" + s.prefix + key
+	u.RawPath = awsEscapePath(u.Path)
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	s.sign(req, body, time.Now())
+	return s.client.Do(req)
+}
+
+// Signs the request with AWS signature version 4: all the headers
+// already set on the request are signed, with host and x-amz-*.
+//
+// See https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html
+func (s *S3Store) sign(req *http.Request, body []byte, t time.Time) {
+	amzdate := t.UTC().Format("20060102T150405Z")
+	date := amzdate[:8]
+	payloadhash := hexSha256(body)
+
+	req.Header.Set("x-amz-date", amzdate)
+	req.Header.Set("x-amz-content-sha256", payloadhash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalheaders strings.Builder
+	for _, name := range names {
+		canonicalheaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedheaders := strings.Join(names, ";")
+
+	canonicalrequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalheaders.String(),
+		signedheaders,
+		payloadhash,
+	}, "\n")
+
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	tosign := "AWS4-HMAC-SHA256\n" + amzdate + "\n" + scope + "\n" + hexSha256([]byte(canonicalrequest))
+
+	key := hmacSha256([]byte("AWS4"+s.secretKey), date)
+	key = hmacSha256(key, s.region)
+	key = hmacSha256(key, "s3")
+	key = hmacSha256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSha256(key, tosign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedheaders, signature))
+}
+
+func hexSha256(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// Escapes the path as expected by AWS: everything except
+// unreserved characters (A-Za-z0-9-_.~) and slashes
+func awsEscapePath(path string) string {
+	var b strings.Builder
+	for _, c := range []byte(path) {
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func s3Error(resp *http.Response) error {
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	return errors.New(fmt.Sprintf("S3 request failed (%s): %s", resp.Status, strings.TrimSpace(string(msg))))
+}
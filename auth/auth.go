@@ -0,0 +1,121 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+// This package encapsulates the authentication of users:
+// local accounts of the database (static), LDAP bind, or
+// OpenID Connect authorization code flow.
+//
+// Users authenticated by an external provider (LDAP, OpenID Connect)
+// are given a local account at their first login, owning their analyses.
+package auth
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/evolbioinfo/booster-web/database"
+	"github.com/evolbioinfo/booster-web/model"
+	uuid "github.com/nu7hatch/gouuid"
+)
+
+var ErrWrongCredentials = errors.New("Wrong Credentials")
+var ErrRedirectOnly = errors.New("Authentication is only possible with the web login page")
+
+// Store of user accounts (implemented by database.BoosterwebDB)
+type UserStore interface {
+	GetUserByLogin(login string) (*model.User, error)
+	GetUserBySubject(provider, subject string) (*model.User, error)
+	UpdateUser(*model.User) error
+}
+
+type Authenticator interface {
+	// Returns the user having the given credentials
+	// (ErrWrongCredentials if they are not valid)
+	Authenticate(login, password string) (*model.User, error)
+}
+
+// Authenticators delegating the login to an external page
+// (OpenID Connect). Authenticate returns ErrRedirectOnly.
+type RedirectAuthenticator interface {
+	Authenticator
+	// URL of the external login page. state is given back to the
+	// callback url, and nonce is checked in the returned identity
+	LoginURL(state, nonce string) string
+	// Returns the user authenticated by the external page, given
+	// the code sent to the callback url
+	Callback(code, nonce string) (*model.User, error)
+}
+
+// Returns the local account of a user authenticated by an external
+// provider, and creates it if it does not exist. Users given in admins
+// are given the admin role.
+//
+// Accounts are found by the provider and the subject (stable id of the
+// user at the provider), never by login: an external user cannot take
+// the account of a local user having the same login. Accounts created
+// before subjects were stored (same login, no provider and no password)
+// are given the subject at the next login of their user.
+func externalUser(store UserStore, provider, subject, login string, admins []string) (u *model.User, err error) {
+	var id *uuid.UUID
+
+	if subject == "" || login == "" {
+		return nil, errors.New("External user without subject or login")
+	}
+	admin := false
+	for _, a := range admins {
+		if a == login {
+			admin = true
+		}
+	}
+
+	if u, err = store.GetUserBySubject(provider, subject); err == nil {
+		if !admin || u.IsAdmin() {
+			return
+		}
+		u.Role = model.ROLE_ADMIN
+		return u, store.UpdateUser(u)
+	} else if err != database.ErrUserNotFound {
+		return
+	}
+
+	if u, err = store.GetUserByLogin(login); err == nil {
+		if u.Provider != "" || u.PasswordHash != "" {
+			return nil, errors.New(fmt.Sprintf("Login %s of %s user %s is already used by another account", login, provider, subject))
+		}
+	} else if err != database.ErrUserNotFound {
+		return
+	} else {
+		if id, err = uuid.NewV4(); err != nil {
+			return
+		}
+		if u, err = model.NewUser(id.String(), login, model.ROLE_USER); err != nil {
+			return
+		}
+	}
+	u.Provider = provider
+	u.Subject = subject
+	if admin {
+		u.Role = model.ROLE_ADMIN
+	}
+	return u, store.UpdateUser(u)
+}
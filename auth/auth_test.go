@@ -0,0 +1,99 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+package auth
+
+import (
+	"testing"
+
+	"github.com/evolbioinfo/booster-web/database"
+	"github.com/evolbioinfo/booster-web/model"
+)
+
+func newTestStore(t *testing.T) *database.MemoryBoosterWebDB {
+	store := database.NewMemoryBoosterWebDB()
+	if err := store.InitDatabase(); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestExternalUser(t *testing.T) {
+	store := newTestStore(t)
+	admins := []string{"carol"}
+
+	// A local admin account
+	local, _ := model.NewUser("local", "admin", model.ROLE_ADMIN)
+	local.SetPassword("secret")
+	if err := store.UpdateUser(local); err != nil {
+		t.Fatal(err)
+	}
+
+	// Accounts are created at the first login, and found by subject
+	u, err := externalUser(store, model.PROVIDER_OIDC, "sub-alice", "alice", admins)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Login != "alice" || u.Role != model.ROLE_USER || u.Provider != model.PROVIDER_OIDC || u.Subject != "sub-alice" {
+		t.Errorf("Wrong new account %+v", u)
+	}
+	again, err := externalUser(store, model.PROVIDER_OIDC, "sub-alice", "alice-renamed", admins)
+	if err != nil || again.Id != u.Id {
+		t.Errorf("Expected the account of the subject, got %+v (%v)", again, err)
+	}
+
+	// Logins of other accounts are not taken over
+	if _, err = externalUser(store, model.PROVIDER_OIDC, "sub-mallory", "admin", admins); err == nil {
+		t.Error("An external user should not log in the local account having its login")
+	}
+	if _, err = externalUser(store, model.PROVIDER_OIDC, "sub-mallory", "alice", admins); err == nil {
+		t.Error("An external user should not log in the account of another subject")
+	}
+	if _, err = externalUser(store, model.PROVIDER_LDAP, "sub-alice", "alice", admins); err == nil {
+		t.Error("A user of another provider should not log in the account having its login")
+	}
+	if u, _ = store.GetUserByLogin("admin"); u.Provider != "" || u.Subject != "" {
+		t.Errorf("The local account was modified: %+v", u)
+	}
+
+	// Accounts created before subjects were stored are given their subject
+	old, _ := model.NewUser("old", "bob", model.ROLE_USER)
+	if err = store.UpdateUser(old); err != nil {
+		t.Fatal(err)
+	}
+	if u, err = externalUser(store, model.PROVIDER_LDAP, "uid=bob,dc=example,dc=org", "bob", admins); err != nil || u.Id != "old" {
+		t.Fatalf("Expected the existing account of bob, got %+v (%v)", u, err)
+	}
+	if u, err = store.GetUserBySubject(model.PROVIDER_LDAP, "uid=bob,dc=example,dc=org"); err != nil || u.Id != "old" {
+		t.Errorf("Expected the subject to be stored, got %+v (%v)", u, err)
+	}
+
+	// Admins are given the admin role
+	if u, err = externalUser(store, model.PROVIDER_OIDC, "sub-carol", "carol", admins); err != nil || !u.IsAdmin() {
+		t.Errorf("Expected an admin account, got %+v (%v)", u, err)
+	}
+
+	if _, err = externalUser(store, model.PROVIDER_OIDC, "", "dave", admins); err == nil {
+		t.Error("Users without subject should be refused")
+	}
+}
@@ -0,0 +1,136 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+package auth
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/evolbioinfo/booster-web/model"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// Authenticates users with a bind to a LDAP server.
+//
+// The dn of the user is either given by the userdn template (ex:
+// "uid=%s,ou=people,dc=example,dc=org"), or searched in basedn with
+// filter (ex: "(uid=%s)"), after a bind with binddn/bindpassword.
+type LDAPAuthenticator struct {
+	url          string // ldap://host:389 or ldaps://host:636
+	starttls     bool   // If StartTLS is used with ldap:// urls
+	userdn       string // Template of the dn of users
+	basedn       string // Base dn of the search of users
+	filter       string // Template of the search filter of users
+	binddn       string // dn of the account searching users
+	bindpassword string // password of the account searching users
+	admins       []string
+	store        UserStore
+}
+
+func NewLDAPAuthenticator(ldapurl string, starttls bool, userdn, basedn, filter, binddn, bindpassword string, admins []string, store UserStore) (a *LDAPAuthenticator, err error) {
+	if userdn == "" && (basedn == "" || filter == "") {
+		return nil, errors.New("LDAP authentication needs a user dn template, or a base dn and a filter")
+	}
+	return &LDAPAuthenticator{
+		url:          ldapurl,
+		starttls:     starttls,
+		userdn:       userdn,
+		basedn:       basedn,
+		filter:       filter,
+		binddn:       binddn,
+		bindpassword: bindpassword,
+		admins:       admins,
+		store:        store,
+	}, nil
+}
+
+func (a *LDAPAuthenticator) Authenticate(login, password string) (u *model.User, err error) {
+	var conn *ldap.Conn
+	var dn string
+
+	// An empty password would be an anonymous bind
+	if login == "" || password == "" {
+		return nil, ErrWrongCredentials
+	}
+
+	if conn, err = a.dial(); err != nil {
+		return
+	}
+	defer conn.Close()
+
+	if dn, err = a.userDN(conn, login); err != nil {
+		return
+	}
+	if err = conn.Bind(dn, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			err = ErrWrongCredentials
+		}
+		return nil, err
+	}
+	// Attribute values of dn are case insensitive
+	return externalUser(a.store, model.PROVIDER_LDAP, strings.ToLower(dn), login, a.admins)
+}
+
+func (a *LDAPAuthenticator) dial() (conn *ldap.Conn, err error) {
+	var u *url.URL
+	if conn, err = ldap.DialURL(a.url); err != nil {
+		return
+	}
+	if a.starttls {
+		if u, err = url.Parse(a.url); err == nil {
+			err = conn.StartTLS(&tls.Config{ServerName: u.Hostname()})
+		}
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return
+}
+
+// dn of the user, from the template or searched in the directory
+func (a *LDAPAuthenticator) userDN(conn *ldap.Conn, login string) (dn string, err error) {
+	var res *ldap.SearchResult
+
+	if a.userdn != "" {
+		return fmt.Sprintf(a.userdn, ldap.EscapeDN(login)), nil
+	}
+	if a.binddn != "" {
+		if err = conn.Bind(a.binddn, a.bindpassword); err != nil {
+			return
+		}
+	}
+	req := ldap.NewSearchRequest(a.basedn, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false,
+		fmt.Sprintf(a.filter, ldap.EscapeFilter(login)), []string{"dn"}, nil)
+	if res, err = conn.Search(req); err != nil {
+		return
+	}
+	if len(res.Entries) != 1 {
+		return "", ErrWrongCredentials
+	}
+	return res.Entries[0].DN, nil
+}
@@ -0,0 +1,119 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/evolbioinfo/booster-web/model"
+	"golang.org/x/oauth2"
+)
+
+const OIDC_TIMEOUT = 30 * time.Second // Timeout of requests to the identity provider
+
+// Authenticates users with an OpenID Connect identity provider
+// (authorization code flow). The provider is discovered from its
+// issuer url (issuer/.well-known/openid-configuration).
+type OIDCAuthenticator struct {
+	ctx        context.Context // Context of requests to the identity provider (may carry an http client)
+	config     oauth2.Config
+	verifier   *oidc.IDTokenVerifier
+	loginclaim string // Claim of the id token giving the login of the user, sub if empty
+	admins     []string
+	store      UserStore
+}
+
+// ctx may carry the http client used to reach the provider (see oidc.ClientContext)
+func NewOIDCAuthenticator(ctx context.Context, issuer, clientid, clientsecret, redirecturl string, scopes []string, loginclaim string, admins []string, store UserStore) (a *OIDCAuthenticator, err error) {
+	var provider *oidc.Provider
+
+	dctx, cancel := context.WithTimeout(ctx, OIDC_TIMEOUT)
+	defer cancel()
+	if provider, err = oidc.NewProvider(dctx, issuer); err != nil {
+		return
+	}
+	if len(scopes) == 0 {
+		scopes = []string{oidc.ScopeOpenID, "profile", "email"}
+	}
+	return &OIDCAuthenticator{
+		ctx: ctx,
+		config: oauth2.Config{
+			ClientID:     clientid,
+			ClientSecret: clientsecret,
+			Endpoint:     provider.Endpoint(),
+			RedirectURL:  redirecturl,
+			Scopes:       scopes,
+		},
+		verifier:   provider.Verifier(&oidc.Config{ClientID: clientid}),
+		loginclaim: loginclaim,
+		admins:     admins,
+		store:      store,
+	}, nil
+}
+
+func (a *OIDCAuthenticator) Authenticate(login, password string) (*model.User, error) {
+	return nil, ErrRedirectOnly
+}
+
+func (a *OIDCAuthenticator) LoginURL(state, nonce string) string {
+	return a.config.AuthCodeURL(state, oidc.Nonce(nonce))
+}
+
+func (a *OIDCAuthenticator) Callback(code, nonce string) (u *model.User, err error) {
+	var token *oauth2.Token
+	var idtoken *oidc.IDToken
+	var claims map[string]interface{}
+
+	ctx, cancel := context.WithTimeout(a.ctx, OIDC_TIMEOUT)
+	defer cancel()
+
+	if token, err = a.config.Exchange(ctx, code); err != nil {
+		return
+	}
+	rawidtoken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("No id token given by the identity provider")
+	}
+	if idtoken, err = a.verifier.Verify(ctx, rawidtoken); err != nil {
+		return
+	}
+	if nonce == "" || idtoken.Nonce != nonce {
+		return nil, errors.New("Wrong nonce in id token")
+	}
+	if err = idtoken.Claims(&claims); err != nil {
+		return
+	}
+	// The account is found by the subject, the login is only displayed
+	// (and gives the admin role): by default, it is the subject itself
+	login := idtoken.Subject
+	if a.loginclaim != "" {
+		if login, _ = claims[a.loginclaim].(string); login == "" {
+			return nil, errors.New("No " + a.loginclaim + " claim in id token")
+		}
+	}
+	return externalUser(a.store, model.PROVIDER_OIDC, idtoken.Subject, login, a.admins)
+}
@@ -0,0 +1,138 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/evolbioinfo/booster-web/model"
+	uuid "github.com/nu7hatch/gouuid"
+	"github.com/spf13/cobra"
+)
+
+var apiKeyName string
+
+// apikeyCmd represents the apikey command
+var apikeyCmd = &cobra.Command{
+	Use:   "apikey",
+	Short: "Manages api keys of users",
+	Long: `Manages the long-lived api keys of the users of the database given in
+the configuration file.
+
+Api keys are given to the api in the Authorization header:
+    Authorization: ApiKey <key>
+and give the same access as the user owning the key, until revoked.`,
+}
+
+var apikeyCreateCmd = &cobra.Command{
+	Use:   "create <login>",
+	Short: "Creates an api key for a user",
+	Long:  `Creates an api key for a user. The key is only displayed once.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var u *model.User
+		var k *model.ApiKey
+		var id *uuid.UUID
+		var key string
+		var err error
+
+		db := openUserDB()
+		if u, err = db.GetUserByLogin(args[0]); err != nil {
+			log.Fatal(err)
+		}
+		if id, err = uuid.NewV4(); err != nil {
+			log.Fatal(err)
+		}
+		if k, key, err = model.NewApiKey(id.String(), u.Id, apiKeyName); err != nil {
+			log.Fatal(err)
+		}
+		if err = db.InsertApiKey(k); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Api key %s created for %s, keep it safe, it will not be displayed again:\n", k.Id, u.Login)
+		fmt.Println(key)
+	},
+}
+
+var apikeyListCmd = &cobra.Command{
+	Use:   "list [login]",
+	Short: "Lists api keys",
+	Long:  `Lists api keys of the given user, or of all users`,
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var keys []*model.ApiKey
+		var users []*model.User
+		var err error
+
+		db := openUserDB()
+		if users, err = db.ListUsers(); err != nil {
+			log.Fatal(err)
+		}
+		logins := make(map[string]string)
+		userid := ""
+		for _, u := range users {
+			logins[u.Id] = u.Login
+			if len(args) > 0 && u.Login == args[0] {
+				userid = u.Id
+			}
+		}
+		if len(args) > 0 && userid == "" {
+			log.Fatal("User does not exist: " + args[0])
+		}
+		if keys, err = db.ListApiKeys(userid); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println("Id\tLogin\tName\tPrefix\tCreated on\tLast used")
+		for _, k := range keys {
+			lastused := "never"
+			if !k.LastUsed.IsZero() {
+				lastused = k.LastUsed.Local().Format(time.RFC3339)
+			}
+			fmt.Printf("%s\t%s\t%s\t%s...\t%s\t%s\n", k.Id, logins[k.UserId], k.Name, k.Prefix, k.Created.Local().Format(time.RFC3339), lastused)
+		}
+	},
+}
+
+var apikeyRevokeCmd = &cobra.Command{
+	Use:   "revoke <id>",
+	Short: "Revokes an api key",
+	Long:  `Revokes an api key, given its id (see apikey list)`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := openUserDB().DeleteApiKey(args[0]); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Api key %s revoked\n", args[0])
+	},
+}
+
+func init() {
+	apikeyCreateCmd.Flags().StringVar(&apiKeyName, "name", "", "Name of the key (ex: name of the pipeline using it)")
+	apikeyCmd.AddCommand(apikeyCreateCmd)
+	apikeyCmd.AddCommand(apikeyListCmd)
+	apikeyCmd.AddCommand(apikeyRevokeCmd)
+	RootCmd.AddCommand(apikeyCmd)
+}
@@ -0,0 +1,100 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/evolbioinfo/booster-web/database"
+	"github.com/evolbioinfo/booster-web/server"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// dbCmd represents the db command
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Manages the booster-web database",
+	Long: `Manages the booster-web database given in the configuration file.
+
+The schema of sql databases (mysql, postgres, sqlite) is versioned:
+pending migrations are applied when booster-web starts, or
+with "booster-web db migrate".`,
+}
+
+// dbMigrateCmd represents the db migrate command
+var dbMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Applies pending database migrations",
+	Long:  `Applies pending database migrations`,
+	Run: func(cmd *cobra.Command, args []string) {
+		m := openMigrator()
+		if err := m.Migrate(); err != nil {
+			log.Fatal(err)
+		}
+		printMigrationStatus(m)
+	},
+}
+
+// dbStatusCmd represents the db status command
+var dbStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Prints applied and pending database migrations",
+	Long:  `Prints applied and pending database migrations`,
+	Run: func(cmd *cobra.Command, args []string) {
+		printMigrationStatus(openMigrator())
+	},
+}
+
+func openMigrator() database.Migrator {
+	db := server.NewDatabase(viper.GetViper())
+	m, ok := db.(database.Migrator)
+	if !ok {
+		log.Fatal("Database type has no versioned schema: " + viper.GetString("database.type"))
+	}
+	return m
+}
+
+func printMigrationStatus(m database.Migrator) {
+	status, err := m.MigrationStatus()
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Version\tStatus\tApplied on\tDescription")
+	for _, s := range status {
+		if s.Applied {
+			fmt.Printf("%d\tapplied\t%s\t%s\n", s.Version, s.AppliedOn.Local().Format(time.RFC3339), s.Description)
+		} else {
+			fmt.Printf("%d\tpending\t-\t%s\n", s.Version, s.Description)
+		}
+	}
+}
+
+func init() {
+	dbCmd.AddCommand(dbMigrateCmd)
+	dbCmd.AddCommand(dbStatusCmd)
+	RootCmd.AddCommand(dbCmd)
+}
@@ -0,0 +1,195 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/evolbioinfo/booster-web/database"
+	"github.com/evolbioinfo/booster-web/model"
+	"github.com/evolbioinfo/booster-web/server"
+	uuid "github.com/nu7hatch/gouuid"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var userPassword string
+var userAdmin bool
+
+// userCmd represents the user command
+var userCmd = &cobra.Command{
+	Use:   "user",
+	Short: "Manages user accounts",
+	Long: `Manages the user accounts of the database given in the configuration file.
+
+Users only see and cancel their own analyses, admins see and cancel all
+analyses. Accounts are used if authentication is activated
+(authentication.enabled = true in the configuration file).
+
+If the password is not given with --password, it is read on stdin.`,
+}
+
+var userAddCmd = &cobra.Command{
+	Use:   "add <login>",
+	Short: "Creates a user account",
+	Long:  `Creates a user account`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var u *model.User
+		var id *uuid.UUID
+		var err error
+
+		db := openUserDB()
+		if _, err = db.GetUserByLogin(args[0]); err == nil {
+			log.Fatal("Login already exists: " + args[0])
+		} else if err != database.ErrUserNotFound {
+			log.Fatal(err)
+		}
+		role := model.ROLE_USER
+		if userAdmin {
+			role = model.ROLE_ADMIN
+		}
+		if id, err = uuid.NewV4(); err != nil {
+			log.Fatal(err)
+		}
+		if u, err = model.NewUser(id.String(), args[0], role); err != nil {
+			log.Fatal(err)
+		}
+		if err = u.SetPassword(readPassword()); err != nil {
+			log.Fatal(err)
+		}
+		if err = db.UpdateUser(u); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("User %s created (%s)\n", u.Login, u.Role)
+	},
+}
+
+var userPasswdCmd = &cobra.Command{
+	Use:   "passwd <login>",
+	Short: "Changes the password of a user",
+	Long:  `Changes the password of a user`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		db := openUserDB()
+		u, err := db.GetUserByLogin(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err = u.SetPassword(readPassword()); err != nil {
+			log.Fatal(err)
+		}
+		if err = db.UpdateUser(u); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Password of %s changed\n", u.Login)
+	},
+}
+
+var userDeleteCmd = &cobra.Command{
+	Use:   "delete <login>",
+	Short: "Deletes a user account",
+	Long:  `Deletes a user account and revokes its api keys. Its analyses are kept, and are only accessible to admins.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		db := openUserDB()
+		u, err := db.GetUserByLogin(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err = db.DeleteUser(u.Id); err != nil {
+			log.Fatal(err)
+		}
+		keys, err := db.ListApiKeys(u.Id)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, k := range keys {
+			if err = db.DeleteApiKey(k.Id); err != nil {
+				log.Fatal(err)
+			}
+		}
+		fmt.Printf("User %s deleted\n", u.Login)
+	},
+}
+
+var userListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists user accounts",
+	Long:  `Lists user accounts`,
+	Run: func(cmd *cobra.Command, args []string) {
+		users, err := openUserDB().ListUsers()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println("Login\tRole\tProvider\tCreated on\tId")
+		for _, u := range users {
+			provider := u.Provider
+			if provider == "" {
+				provider = "local"
+			}
+			fmt.Printf("%s\t%s\t%s\t%s\t%s\n", u.Login, u.Role, provider, u.Created.Local().Format(time.RFC3339), u.Id)
+		}
+	},
+}
+
+// Accounts are only kept in persistent databases
+func openUserDB() database.BoosterwebDB {
+	db := server.NewDatabase(viper.GetViper())
+	if _, ok := db.(database.Migrator); !ok {
+		log.Fatal("User accounts are not persistent with database type: " + viper.GetString("database.type"))
+	}
+	if err := db.InitDatabase(); err != nil {
+		log.Fatal(err)
+	}
+	return db
+}
+
+func readPassword() string {
+	if userPassword != "" {
+		return userPassword
+	}
+	fmt.Fprint(os.Stderr, "Password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		log.Fatal(errors.New("Cannot read password: " + err.Error()))
+	}
+	return strings.TrimRight(line, "\r\n")
+}
+
+func init() {
+	userCmd.PersistentFlags().StringVar(&userPassword, "password", "", "Password of the user (read on stdin if not given)")
+	userAddCmd.Flags().BoolVar(&userAdmin, "admin", false, "Gives the admin role to the user")
+	userCmd.AddCommand(userAddCmd)
+	userCmd.AddCommand(userPasswdCmd)
+	userCmd.AddCommand(userDeleteCmd)
+	userCmd.AddCommand(userListCmd)
+	RootCmd.AddCommand(userCmd)
+}
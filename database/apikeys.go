@@ -0,0 +1,123 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/evolbioinfo/booster-web/model"
+)
+
+var ErrApiKeyNotFound = errors.New("Api key does not exist")
+
+// Row of the api keys table, shared by sql databases
+type dbapikey struct {
+	id       string       // Id of the key
+	userid   string       // Id of the user owning the key
+	name     string       // Name of the key
+	prefix   string       // First characters of the key
+	hash     string       // sha256 of the key
+	created  sql.NullTime // date of creation
+	lastused sql.NullTime // date of last use
+}
+
+// Columns of the api keys table, in the order expected by scanApiKey
+const apiKeyColumns = "id,userid,name,prefix,hash,created,lastused"
+
+// Selects the api keys returned by the given query and arguments
+func queryApiKeys(db *sql.DB, query string, args ...interface{}) (keys []*model.ApiKey, err error) {
+	var rows *sql.Rows
+
+	keys = make([]*model.ApiKey, 0)
+	if rows, err = db.Query(query, args...); err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		dbk := dbapikey{}
+		if err = rows.Scan(&dbk.id, &dbk.userid, &dbk.name, &dbk.prefix, &dbk.hash, &dbk.created, &dbk.lastused); err != nil {
+			return
+		}
+		keys = append(keys, &model.ApiKey{
+			Id:       dbk.id,
+			UserId:   dbk.userid,
+			Name:     dbk.name,
+			Prefix:   dbk.prefix,
+			Hash:     dbk.hash,
+			Created:  dbk.created.Time,
+			LastUsed: dbk.lastused.Time,
+		})
+	}
+	err = rows.Err()
+	return
+}
+
+func getApiKey(db *sql.DB, dialect, hash string) (k *model.ApiKey, err error) {
+	var keys []*model.ApiKey
+	if keys, err = queryApiKeys(db, "SELECT "+apiKeyColumns+" FROM apikeys WHERE hash = "+placeholder(dialect, 1), hash); err != nil {
+		return
+	}
+	if len(keys) == 0 {
+		return nil, ErrApiKeyNotFound
+	}
+	return keys[0], nil
+}
+
+// Lists the api keys of the user, or all keys if userid is empty
+func listApiKeys(db *sql.DB, dialect, userid string) ([]*model.ApiKey, error) {
+	if userid == "" {
+		return queryApiKeys(db, "SELECT "+apiKeyColumns+" FROM apikeys ORDER BY created")
+	}
+	return queryApiKeys(db, "SELECT "+apiKeyColumns+" FROM apikeys WHERE userid = "+placeholder(dialect, 1)+" ORDER BY created", userid)
+}
+
+func insertApiKey(db *sql.DB, dialect string, k *model.ApiKey) (err error) {
+	query := "INSERT INTO apikeys (" + apiKeyColumns + ") VALUES (" +
+		placeholder(dialect, 1) + "," + placeholder(dialect, 2) + "," + placeholder(dialect, 3) + "," +
+		placeholder(dialect, 4) + "," + placeholder(dialect, 5) + "," + placeholder(dialect, 6) + "," +
+		placeholder(dialect, 7) + ")"
+	_, err = db.Exec(query, k.Id, k.UserId, k.Name, k.Prefix, k.Hash, dbtime(k.Created), dbtime(k.LastUsed))
+	return
+}
+
+// Only updates the last use date of the key
+func updateApiKeyUsage(db *sql.DB, dialect, id string, used time.Time) (err error) {
+	_, err = db.Exec("UPDATE apikeys SET lastused = "+placeholder(dialect, 1)+" WHERE id = "+placeholder(dialect, 2), dbtime(used), id)
+	return
+}
+
+func deleteApiKey(db *sql.DB, dialect, id string) (err error) {
+	var res sql.Result
+	var n int64
+	if res, err = db.Exec("DELETE FROM apikeys WHERE id = "+placeholder(dialect, 1), id); err != nil {
+		return
+	}
+	if n, err = res.RowsAffected(); err == nil && n == 0 {
+		err = ErrApiKeyNotFound
+	}
+	return
+}
@@ -0,0 +1,86 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/evolbioinfo/booster-web/model"
+)
+
+func TestApiKeys(t *testing.T) {
+	for name, db := range testDatabases(t) {
+		k1, key1, err := model.NewApiKey("k1", "u1", "pipeline")
+		if err != nil {
+			t.Fatal(err)
+		}
+		k1.Created = k1.Created.Add(-time.Hour)
+		k2, _, err := model.NewApiKey("k2", "u2", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, k := range []*model.ApiKey{k1, k2} {
+			if err = db.InsertApiKey(k); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		k, err := db.GetApiKey(model.HashApiKey(key1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if k.Id != "k1" || k.UserId != "u1" || k.Name != "pipeline" || k.Prefix != k1.Prefix || !k.LastUsed.IsZero() {
+			t.Errorf("%s: wrong api key %+v", name, k)
+		}
+		if _, err = db.GetApiKey(model.HashApiKey("bwk_unknown")); err != ErrApiKeyNotFound {
+			t.Errorf("%s: expected ErrApiKeyNotFound, got %v", name, err)
+		}
+
+		used := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+		if err = db.UpdateApiKeyUsage("k1", used); err != nil {
+			t.Fatal(err)
+		}
+		if k, err = db.GetApiKey(k1.Hash); err != nil || !k.LastUsed.Equal(used) {
+			t.Errorf("%s: expected last use %v, got %+v (%v)", name, used, k, err)
+		}
+
+		if keys, err := db.ListApiKeys("u1"); err != nil || len(keys) != 1 || keys[0].Id != "k1" {
+			t.Errorf("%s: expected the key of u1, got %v (%v)", name, keys, err)
+		}
+		if keys, err := db.ListApiKeys(""); err != nil || len(keys) != 2 || keys[0].Id != "k1" {
+			t.Errorf("%s: expected all keys by creation date, got %v (%v)", name, keys, err)
+		}
+
+		if err = db.DeleteApiKey("k1"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = db.GetApiKey(k1.Hash); err != ErrApiKeyNotFound {
+			t.Errorf("%s: expected revoked key to be removed, got %v", name, err)
+		}
+		if err = db.DeleteApiKey("k1"); err != ErrApiKeyNotFound {
+			t.Errorf("%s: expected ErrApiKeyNotFound, got %v", name, err)
+		}
+	}
+}
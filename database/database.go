@@ -24,15 +24,57 @@ Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
 package database
 
 import (
+	"time"
+
 	"github.com/evolbioinfo/booster-web/model"
 )
 
 type BoosterwebDB interface {
 	GetAnalysis(id string) (*model.Analysis, error)
+	// Analysis without its alignment, result trees and logs
+	GetAnalysisSummary(id string) (*model.Analysis, error)
 	UpdateAnalysis(*model.Analysis) error
+	// Only updates the number of processed bootstrap trees
+	UpdateProgress(id string, nboot int) error
+	// Only updates the status and the message of the analysis
+	UpdateStatus(id string, status int, message string) error
 	Connect() error
 	Disconnect() error
 	InitDatabase() error
-	DeleteOldAnalyses(days int) error
+	DeleteOldAnalyses(days int) (deleted []string, err error)
 	GetRunningAnalyses() (analyses []*model.Analysis, err error)
+	// Lists the analyses selected by the filter (see AnalysisFilter), and
+	// returns the cursor of the next page (empty if it is the last page)
+	ListAnalyses(filter AnalysisFilter) (analyses []*model.Analysis, next string, err error)
+
+	// User accounts (ErrUserNotFound if the user does not exist)
+	GetUser(id string) (*model.User, error)
+	GetUserByLogin(login string) (*model.User, error)
+	GetUserBySubject(provider, subject string) (*model.User, error) // User of an external provider
+	ListUsers() ([]*model.User, error)
+	UpdateUser(*model.User) error
+	DeleteUser(id string) error
+
+	// Api keys of users (ErrApiKeyNotFound if the key does not exist)
+	GetApiKey(hash string) (*model.ApiKey, error)
+	ListApiKeys(userid string) ([]*model.ApiKey, error)
+	InsertApiKey(*model.ApiKey) error
+	UpdateApiKeyUsage(id string, used time.Time) error
+	DeleteApiKey(id string) error
+}
+
+// Databases having a versioned schema (sql databases).
+//
+// Pending migrations are applied by InitDatabase, or
+// with the "booster-web db migrate" command
+type Migrator interface {
+	Migrate() error
+	MigrationStatus() ([]MigrationStatus, error)
+}
+
+type MigrationStatus struct {
+	Version     int
+	Description string
+	Applied     bool
+	AppliedOn   time.Time
 }
@@ -0,0 +1,150 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+package database
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/evolbioinfo/booster-web/model"
+)
+
+const (
+	DEFAULT_LIST_LIMIT = 20
+	MAX_LIST_LIMIT     = 100
+)
+
+var ErrInvalidCursor = errors.New("Invalid pagination cursor")
+
+/*
+Filter of the analyses listed by ListAnalyses.
+
+Zero values do not filter anything. Analyses are listed from the most
+recently submitted to the oldest, Limit at a time: Cursor is empty for
+the first page, and then takes the value returned with the previous
+page.
+*/
+type AnalysisFilter struct {
+	Status   []int     // Statuses of the analyses
+	Workflow []int     // Workflows of the analyses
+	RunName  string    // Substring of the run name (case insensitive)
+	EMail    string    // Email of the analysis creator
+	Owner    string    // Id of the user who submitted the analyses
+	From     time.Time // Analyses submitted on or after this date
+	To       time.Time // Analyses submitted before this date
+	Cursor   string    // Position after the previous page
+	Limit    int       // Number of analyses per page (default DEFAULT_LIST_LIMIT, at most MAX_LIST_LIMIT)
+}
+
+// Number of analyses to return in a page
+func (f AnalysisFilter) limit() int {
+	if f.Limit <= 0 {
+		return DEFAULT_LIST_LIMIT
+	}
+	if f.Limit > MAX_LIST_LIMIT {
+		return MAX_LIST_LIMIT
+	}
+	return f.Limit
+}
+
+// Returns true if the analysis is selected by the filter, cursor apart
+func (f AnalysisFilter) match(a *model.Analysis) bool {
+	if a.StartPending.IsZero() {
+		return false
+	}
+	if len(f.Status) > 0 && !containsInt(f.Status, a.Status) {
+		return false
+	}
+	if len(f.Workflow) > 0 && !containsInt(f.Workflow, a.Workflow) {
+		return false
+	}
+	if f.RunName != "" && !strings.Contains(strings.ToLower(a.RunName), strings.ToLower(f.RunName)) {
+		return false
+	}
+	if f.EMail != "" && a.EMail != f.EMail {
+		return false
+	}
+	if f.Owner != "" && a.Owner != f.Owner {
+		return false
+	}
+	if !f.From.IsZero() && a.StartPending.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !a.StartPending.Before(f.To) {
+		return false
+	}
+	return true
+}
+
+func containsInt(values []int, v int) bool {
+	for _, val := range values {
+		if val == v {
+			return true
+		}
+	}
+	return false
+}
+
+// The cursor is the submission date and the id of the last
+// analysis of the previous page (analyses are sorted by date and id)
+func encodeCursor(a *model.Analysis) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(a.StartPending.UTC().Format(time.RFC3339Nano) + "|" + a.Id))
+}
+
+func decodeCursor(cursor string) (date time.Time, id string, err error) {
+	var dec []byte
+	if dec, err = base64.RawURLEncoding.DecodeString(cursor); err != nil {
+		err = ErrInvalidCursor
+		return
+	}
+	parts := strings.SplitN(string(dec), "|", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		err = ErrInvalidCursor
+		return
+	}
+	if date, err = time.Parse(time.RFC3339Nano, parts[0]); err != nil {
+		err = ErrInvalidCursor
+		return
+	}
+	id = parts[1]
+	return
+}
+
+// Returns true if the analysis comes after the cursor position
+func afterCursor(a *model.Analysis, date time.Time, id string) bool {
+	return a.StartPending.Before(date) || (a.StartPending.Equal(date) && a.Id < id)
+}
+
+// Copy of the analysis without its alignment, result trees and logs
+func summary(a *model.Analysis) *model.Analysis {
+	s := *a
+	s.Alignfile = ""
+	s.FbpTree = ""
+	s.TbeNormTree = ""
+	s.TbeRawTree = ""
+	s.TbeLogs = ""
+	return &s
+}
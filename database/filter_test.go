@@ -0,0 +1,139 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+package database
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/evolbioinfo/booster-web/model"
+)
+
+// Inserts 7 analyses, submitted every hour from day
+// (a0 is the oldest), a5 and a6 being submitted together
+func insertListedAnalyses(t *testing.T, db BoosterwebDB, day time.Time) {
+	for i := 0; i < 7; i++ {
+		a := model.NewAnalysis()
+		a.Id = fmt.Sprintf("a%d", i)
+		a.RunName = fmt.Sprintf("Run_%d", i)
+		a.Status = model.STATUS_FINISHED
+		a.StartPending = day.Add(time.Duration(i) * time.Hour)
+		if i == 6 {
+			a.StartPending = day.Add(5 * time.Hour)
+		}
+		if i%2 == 0 {
+			a.Owner = "u1"
+			a.EMail = "u1@example.org"
+		} else {
+			a.Status = model.STATUS_ERROR
+		}
+		if err := db.UpdateAnalysis(a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Never submitted analyses are not listed
+	if err := db.UpdateAnalysis(&model.Analysis{Id: "unsubmitted"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func listedIds(t *testing.T, db BoosterwebDB, f AnalysisFilter) (ids []string, next string) {
+	analyses, next, err := db.ListAnalyses(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range analyses {
+		ids = append(ids, a.Id)
+	}
+	return
+}
+
+func TestListAnalysesPaging(t *testing.T) {
+	day := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+	for name, db := range testDatabases(t) {
+		insertListedAnalyses(t, db, day)
+
+		var all []string
+		f := AnalysisFilter{Limit: 3}
+		for page := 0; ; page++ {
+			ids, next := listedIds(t, db, f)
+			if len(ids) > 3 {
+				t.Errorf("%s: page %d has %d analyses", name, page, len(ids))
+			}
+			all = append(all, ids...)
+			if next == "" {
+				break
+			}
+			f.Cursor = next
+		}
+		if fmt.Sprint(all) != "[a6 a5 a4 a3 a2 a1 a0]" {
+			t.Errorf("%s: expected analyses by decreasing date and id, got %v", name, all)
+		}
+
+		if _, _, err := db.ListAnalyses(AnalysisFilter{Cursor: "not a cursor"}); err != ErrInvalidCursor {
+			t.Errorf("%s: expected ErrInvalidCursor, got %v", name, err)
+		}
+	}
+}
+
+func TestListAnalysesFilter(t *testing.T) {
+	day := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+	for name, db := range testDatabases(t) {
+		insertListedAnalyses(t, db, day)
+
+		for _, test := range []struct {
+			filter   AnalysisFilter
+			expected string
+		}{
+			{AnalysisFilter{Owner: "u1"}, "[a6 a4 a2 a0]"},
+			{AnalysisFilter{EMail: "u1@example.org", Limit: 2}, "[a6 a4]"},
+			{AnalysisFilter{Status: []int{model.STATUS_ERROR}}, "[a5 a3 a1]"},
+			{AnalysisFilter{RunName: "run_3"}, "[a3]"},
+			{AnalysisFilter{RunName: "_"}, "[a6 a5 a4 a3 a2 a1 a0]"},
+			{AnalysisFilter{RunName: "%"}, "[]"},
+			{AnalysisFilter{From: day.Add(4 * time.Hour), To: day.Add(5 * time.Hour)}, "[a4]"},
+		} {
+			if ids, _ := listedIds(t, db, test.filter); fmt.Sprint(ids) != test.expected {
+				t.Errorf("%s: %+v: expected %s, got %v", name, test.filter, test.expected, ids)
+			}
+		}
+
+		// Listed analyses do not include their alignment, trees and logs
+		a := model.NewAnalysis()
+		a.Id = "full"
+		a.StartPending = day.Add(24 * time.Hour)
+		a.TbeNormTree = "(a,b,c);"
+		if err := db.UpdateAnalysis(a); err != nil {
+			t.Fatal(err)
+		}
+		analyses, _, err := db.ListAnalyses(AnalysisFilter{Limit: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if analyses[0].Id != "full" || analyses[0].TbeNormTree != "" {
+			t.Errorf("%s: expected analysis full without its tree, got %s %q", name, analyses[0].Id, analyses[0].TbeNormTree)
+		}
+	}
+}
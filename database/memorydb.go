@@ -26,6 +26,7 @@ package database
 import (
 	"errors"
 	"log"
+	"sort"
 	"sync"
 	"time"
 
@@ -35,6 +36,8 @@ import (
 type MemoryBoosterWebDB struct {
 	lock        sync.RWMutex
 	allanalyses map[string]*model.Analysis
+	allusers    map[string]*model.User
+	allapikeys  map[string]*model.ApiKey
 }
 
 /* Returns a new database */
@@ -64,6 +67,14 @@ func (db *MemoryBoosterWebDB) GetAnalysis(id string) (a *model.Analysis, err err
 	return
 }
 
+// Returns the analysis without its alignment, result trees and logs
+func (db *MemoryBoosterWebDB) GetAnalysisSummary(id string) (a *model.Analysis, err error) {
+	if a, err = db.GetAnalysis(id); err != nil {
+		return
+	}
+	return summary(a), nil
+}
+
 /* Update an anlysis or insert it if it does not exist */
 func (db *MemoryBoosterWebDB) UpdateAnalysis(a *model.Analysis) error {
 	db.lock.Lock()
@@ -73,15 +84,40 @@ func (db *MemoryBoosterWebDB) UpdateAnalysis(a *model.Analysis) error {
 	return nil
 }
 
+func (db *MemoryBoosterWebDB) UpdateProgress(id string, nboot int) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	a, ok := db.allanalyses[id]
+	if !ok {
+		return errors.New("Analysis does not exist")
+	}
+	a.Nboot = nboot
+	return nil
+}
+
+func (db *MemoryBoosterWebDB) UpdateStatus(id string, status int, message string) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	a, ok := db.allanalyses[id]
+	if !ok {
+		return errors.New("Analysis does not exist")
+	}
+	a.Status = status
+	a.Message = message
+	return nil
+}
+
 /* Check if table is present otherwise creates it */
 func (db *MemoryBoosterWebDB) InitDatabase() error {
 	log.Print("Initializing in memory database")
 	db.allanalyses = make(map[string]*model.Analysis)
+	db.allusers = make(map[string]*model.User)
+	db.allapikeys = make(map[string]*model.ApiKey)
 	return nil
 }
 
-// Will delete analyses older than d days
-func (db *MemoryBoosterWebDB) DeleteOldAnalyses(days int) (err error) {
+// Will delete analyses older than d days, and returns their ids
+func (db *MemoryBoosterWebDB) DeleteOldAnalyses(days int) (deleted []string, err error) {
 	db.lock.Lock()
 	defer db.lock.Unlock()
 	log.Print("In memory database : Deleting old analyses")
@@ -89,13 +125,170 @@ func (db *MemoryBoosterWebDB) DeleteOldAnalyses(days int) (err error) {
 	for id, a := range db.allanalyses {
 		if o, _ := a.OlderThan(time.Duration(days*24) * time.Hour); o {
 			delete(db.allanalyses, id)
+			deleted = append(deleted, id)
 		}
 	}
 	return
 
 }
 
+// Get only analyses that are running (1) or pending (0)
 func (db *MemoryBoosterWebDB) GetRunningAnalyses() (analyses []*model.Analysis, err error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
 	analyses = make([]*model.Analysis, 0)
+	for _, a := range db.allanalyses {
+		if a.Status == model.STATUS_PENDING || a.Status == model.STATUS_RUNNING {
+			analyses = append(analyses, a)
+		}
+	}
 	return
 }
+
+// Lists analyses, without their alignments, result trees and logs
+func (db *MemoryBoosterWebDB) ListAnalyses(filter AnalysisFilter) (analyses []*model.Analysis, next string, err error) {
+	var date time.Time
+	var id string
+	if filter.Cursor != "" {
+		if date, id, err = decodeCursor(filter.Cursor); err != nil {
+			return
+		}
+	}
+
+	db.lock.RLock()
+	analyses = make([]*model.Analysis, 0)
+	for _, a := range db.allanalyses {
+		if filter.match(a) && (filter.Cursor == "" || afterCursor(a, date, id)) {
+			analyses = append(analyses, summary(a))
+		}
+	}
+	db.lock.RUnlock()
+
+	sort.Slice(analyses, func(i, j int) bool {
+		return afterCursor(analyses[j], analyses[i].StartPending, analyses[i].Id)
+	})
+	if limit := filter.limit(); len(analyses) > limit {
+		analyses = analyses[:limit]
+		next = encodeCursor(analyses[limit-1])
+	}
+	return
+}
+
+func (db *MemoryBoosterWebDB) GetUser(id string) (*model.User, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+	u, ok := db.allusers[id]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return u, nil
+}
+
+func (db *MemoryBoosterWebDB) GetUserByLogin(login string) (*model.User, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+	for _, u := range db.allusers {
+		if u.Login == login {
+			return u, nil
+		}
+	}
+	return nil, ErrUserNotFound
+}
+
+func (db *MemoryBoosterWebDB) GetUserBySubject(provider, subject string) (*model.User, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+	for _, u := range db.allusers {
+		if provider != "" && u.Provider == provider && u.Subject == subject {
+			return u, nil
+		}
+	}
+	return nil, ErrUserNotFound
+}
+
+func (db *MemoryBoosterWebDB) ListUsers() (users []*model.User, err error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+	users = make([]*model.User, 0, len(db.allusers))
+	for _, u := range db.allusers {
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Login < users[j].Login })
+	return
+}
+
+/* Update a user or insert it if it does not exist */
+func (db *MemoryBoosterWebDB) UpdateUser(u *model.User) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	for _, other := range db.allusers {
+		if other.Login == u.Login && other.Id != u.Id {
+			return errors.New("Login already exists: " + u.Login)
+		}
+	}
+	db.allusers[u.Id] = u
+	return nil
+}
+
+func (db *MemoryBoosterWebDB) DeleteUser(id string) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	if _, ok := db.allusers[id]; !ok {
+		return ErrUserNotFound
+	}
+	delete(db.allusers, id)
+	return nil
+}
+
+// Returns the api key having the given hash
+func (db *MemoryBoosterWebDB) GetApiKey(hash string) (*model.ApiKey, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+	for _, k := range db.allapikeys {
+		if k.Hash == hash {
+			return k, nil
+		}
+	}
+	return nil, ErrApiKeyNotFound
+}
+
+func (db *MemoryBoosterWebDB) ListApiKeys(userid string) (keys []*model.ApiKey, err error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+	keys = make([]*model.ApiKey, 0)
+	for _, k := range db.allapikeys {
+		if userid == "" || k.UserId == userid {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Created.Before(keys[j].Created) })
+	return
+}
+
+func (db *MemoryBoosterWebDB) InsertApiKey(k *model.ApiKey) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	db.allapikeys[k.Id] = k
+	return nil
+}
+
+func (db *MemoryBoosterWebDB) UpdateApiKeyUsage(id string, used time.Time) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	k, ok := db.allapikeys[id]
+	if !ok {
+		return ErrApiKeyNotFound
+	}
+	k.LastUsed = used
+	return nil
+}
+
+func (db *MemoryBoosterWebDB) DeleteApiKey(id string) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	if _, ok := db.allapikeys[id]; !ok {
+		return ErrApiKeyNotFound
+	}
+	delete(db.allapikeys, id)
+	return nil
+}
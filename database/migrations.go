@@ -0,0 +1,348 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+package database
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"database/sql"
+)
+
+// Row of the table keeping the applied migrations
+type dbmigration struct {
+	version     int          // Version of the migration
+	description string       // Description of the migration
+	applied     sql.NullTime // Date the migration was applied
+}
+
+// A versioned step of the schema of sql databases.
+//
+// Migrations are applied in order, only once per database. A new schema
+// change must be added at the end of the list, with the next version
+// number, and must never be modified once released: migrations give
+// their statements explicitly, and do not depend on the current structs.
+type migration struct {
+	version     int
+	description string
+	apply       func(db execer, dialect string) error
+}
+
+// Runs the statements of a migration, on the database or in a transaction
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+var migrations = []migration{
+	{
+		1,
+		"Create analysis table",
+		func(db execer, dialect string) error {
+			// Dates were stored as strings, they are converted by migration 2
+			return execAll(db, dialectQuery(dialect,
+				`CREATE TABLE IF NOT EXISTS analysis (
+					id varchar(100) NOT NULL PRIMARY KEY,
+					runname varchar(100) DEFAULT '',
+					email varchar(100) DEFAULT '',
+					seqalign blob,
+					nbootrep int DEFAULT 0,
+					alignfile longblob,
+					alignalphabet int DEFAULT -1,
+					workflow int DEFAULT -1,
+					alignnbseq int DEFAULT -1,
+					alignlength int DEFAULT -1,
+					reffile blob,
+					bootfile blob,
+					fbptree longtext,
+					tbenormtree longtext,
+					tberawtree longtext,
+					tbelogs longtext,
+					status int DEFAULT -1,
+					jobid varchar(100) DEFAULT '',
+					galaxyhistory varchar(100) DEFAULT '',
+					message longtext,
+					nboot int DEFAULT 0,
+					startpending varchar(100) DEFAULT '',
+					startrunning varchar(100) DEFAULT '',
+					end varchar(100) DEFAULT '')`,
+				`CREATE TABLE IF NOT EXISTS analysis (
+					id varchar(100) NOT NULL PRIMARY KEY,
+					runname varchar(100) DEFAULT '',
+					email varchar(100) DEFAULT '',
+					seqalign text,
+					nbootrep int DEFAULT 0,
+					alignfile text,
+					alignalphabet int DEFAULT -1,
+					workflow int DEFAULT -1,
+					alignnbseq int DEFAULT -1,
+					alignlength int DEFAULT -1,
+					reffile text,
+					bootfile text,
+					fbptree text,
+					tbenormtree text,
+					tberawtree text,
+					tbelogs text,
+					status int DEFAULT -1,
+					jobid varchar(100) DEFAULT '',
+					galaxyhistory varchar(100) DEFAULT '',
+					message text,
+					nboot int DEFAULT 0,
+					startpending varchar(100) DEFAULT '',
+					startrunning varchar(100) DEFAULT '',
+					"end" varchar(100) DEFAULT '')`))
+		},
+	},
+	{
+		2,
+		"Store analysis dates as DATETIME",
+		convertDateColumns,
+	},
+	{
+		3,
+		"Create users table",
+		func(db execer, dialect string) error {
+			return execAll(db, dialectQuery(dialect,
+				`CREATE TABLE IF NOT EXISTS users (
+					id varchar(100) NOT NULL PRIMARY KEY,
+					login varchar(100) NOT NULL UNIQUE,
+					passwordhash varchar(100) DEFAULT '',
+					role varchar(20) DEFAULT 'user',
+					created datetime)`,
+				`CREATE TABLE IF NOT EXISTS users (
+					id varchar(100) NOT NULL PRIMARY KEY,
+					login varchar(100) NOT NULL UNIQUE,
+					passwordhash varchar(100) DEFAULT '',
+					role varchar(20) DEFAULT 'user',
+					created timestamptz)`))
+		},
+	},
+	{
+		4,
+		"Add analysis owner",
+		func(db execer, dialect string) error {
+			return execAll(db,
+				"ALTER TABLE analysis ADD COLUMN owner varchar(100) DEFAULT ''")
+		},
+	},
+	{
+		5,
+		"Create api keys table",
+		func(db execer, dialect string) error {
+			return execAll(db, dialectQuery(dialect,
+				`CREATE TABLE IF NOT EXISTS apikeys (
+					id varchar(100) NOT NULL PRIMARY KEY,
+					userid varchar(100) DEFAULT '',
+					name varchar(100) DEFAULT '',
+					prefix varchar(20) DEFAULT '',
+					hash varchar(64) NOT NULL UNIQUE,
+					created datetime,
+					lastused datetime)`,
+				`CREATE TABLE IF NOT EXISTS apikeys (
+					id varchar(100) NOT NULL PRIMARY KEY,
+					userid varchar(100) DEFAULT '',
+					name varchar(100) DEFAULT '',
+					prefix varchar(20) DEFAULT '',
+					hash varchar(64) NOT NULL UNIQUE,
+					created timestamptz,
+					lastused timestamptz)`))
+		},
+	},
+	{
+		6,
+		"Add analysis tree inference parameters",
+		func(db execer, dialect string) error {
+			// sqlite adds only one column per statement
+			return execAll(db,
+				"ALTER TABLE analysis ADD COLUMN criterion varchar(10) DEFAULT ''",
+				"ALTER TABLE analysis ADD COLUMN moves varchar(10) DEFAULT ''",
+				"ALTER TABLE analysis ADD COLUMN substmodel varchar(20) DEFAULT ''",
+				"ALTER TABLE analysis ADD COLUMN nogamma boolean DEFAULT false")
+		},
+	},
+	{
+		7,
+		"Add analysis TBE parameters",
+		func(db execer, dialect string) error {
+			return execAll(db,
+				"ALTER TABLE analysis ADD COLUMN tbecutoff double precision DEFAULT 0.3",
+				"ALTER TABLE analysis ADD COLUMN norawtree boolean DEFAULT false",
+				"ALTER TABLE analysis ADD COLUMN nomovedtaxa boolean DEFAULT false")
+		},
+	},
+	{
+		8,
+		"Add analysis listing indexes",
+		func(db execer, dialect string) error {
+			// Analyses are listed by decreasing submission date, optionally of one owner
+			return execAll(db,
+				"CREATE INDEX analysis_startpending ON analysis (startpending, id)",
+				"CREATE INDEX analysis_owner ON analysis (owner, startpending, id)")
+		},
+	},
+	{
+		9,
+		"Add users external identities",
+		func(db execer, dialect string) error {
+			// External users are found by their provider and their subject
+			return execAll(db,
+				"ALTER TABLE users ADD COLUMN provider varchar(20) DEFAULT ''",
+				"ALTER TABLE users ADD COLUMN subject varchar(255) DEFAULT ''",
+				"CREATE INDEX users_subject ON users (provider, subject)")
+		},
+	},
+}
+
+// Returns the mysql query, or the postgres query if the dialect
+// is postgres (sqlite accepts mysql types)
+func dialectQuery(dialect, mysql, postgres string) string {
+	if dialect == DIALECT_POSTGRES {
+		return postgres
+	}
+	return mysql
+}
+
+// Executes the queries in order, stopping at the first error
+func execAll(db execer, queries ...string) (err error) {
+	for _, q := range queries {
+		if _, err = db.Exec(q); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Applies the migrations that are not applied yet on the database
+func migrate(db *sql.DB, dialect string) (err error) {
+	var applied map[int]MigrationStatus
+
+	if err = execAll(db, dialectQuery(dialect,
+		"CREATE TABLE IF NOT EXISTS schema_migrations (version int NOT NULL PRIMARY KEY, description varchar(255) DEFAULT '', applied datetime)",
+		"CREATE TABLE IF NOT EXISTS schema_migrations (version int NOT NULL PRIMARY KEY, description varchar(255) DEFAULT '', applied timestamptz)")); err != nil {
+		return
+	}
+	if applied, err = appliedMigrations(db); err != nil {
+		return
+	}
+
+	for _, m := range migrations {
+		if _, ok := applied[m.version]; ok {
+			continue
+		}
+		log.Print(fmt.Sprintf("Applying database migration %d: %s", m.version, m.description))
+		if err = applyMigration(db, dialect, m); err != nil {
+			return errors.New(fmt.Sprintf("Database migration %d failed: %v", m.version, err))
+		}
+	}
+	return
+}
+
+// Applies the migration and records it. Postgres and sqlite run it in a
+// transaction, so that it is applied entirely or not at all. Mysql commits
+// each schema change, and its migrations must be written so that they can
+// be run again after a failure.
+func applyMigration(db *sql.DB, dialect string, m migration) (err error) {
+	var tx *sql.Tx
+
+	query := "INSERT INTO schema_migrations (version, description, applied) VALUES (" +
+		placeholder(dialect, 1) + "," + placeholder(dialect, 2) + "," + placeholder(dialect, 3) + ")"
+	if dialect == DIALECT_MYSQL {
+		if err = m.apply(db, dialect); err != nil {
+			return
+		}
+		_, err = db.Exec(query, m.version, m.description, dbtime(time.Now()))
+		return
+	}
+
+	if tx, err = db.Begin(); err != nil {
+		return
+	}
+	if err = m.apply(tx, dialect); err != nil {
+		tx.Rollback()
+		return
+	}
+	if _, err = tx.Exec(query, m.version, m.description, dbtime(time.Now())); err != nil {
+		tx.Rollback()
+		return
+	}
+	return tx.Commit()
+}
+
+// Returns the status of all known migrations, followed by applied
+// migrations that are unknown (applied by a more recent version)
+func migrationStatus(db *sql.DB, dialect string) (status []MigrationStatus, err error) {
+	var cols map[string]string
+	applied := make(map[int]MigrationStatus)
+
+	// The migration table does not exist if nothing was applied yet
+	if cols, err = columnTypes(db, dialect, "schema_migrations"); err != nil {
+		return
+	}
+	if len(cols) > 0 {
+		if applied, err = appliedMigrations(db); err != nil {
+			return
+		}
+	}
+
+	status = make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		s, ok := applied[m.version]
+		if !ok {
+			s = MigrationStatus{Version: m.version, Description: m.description}
+		}
+		status = append(status, s)
+		delete(applied, m.version)
+	}
+	for _, s := range applied {
+		status = append(status, s)
+	}
+	return
+}
+
+func appliedMigrations(db *sql.DB) (applied map[int]MigrationStatus, err error) {
+	var rows *sql.Rows
+
+	if rows, err = db.Query("SELECT version, description, applied FROM schema_migrations ORDER BY version"); err != nil {
+		return
+	}
+	defer rows.Close()
+
+	applied = make(map[int]MigrationStatus)
+	for rows.Next() {
+		var dbm dbmigration
+		if err = rows.Scan(&dbm.version, &dbm.description, &dbm.applied); err != nil {
+			return
+		}
+		applied[dbm.version] = MigrationStatus{
+			Version:     dbm.version,
+			Description: dbm.description,
+			Applied:     true,
+			AppliedOn:   dbm.applied.Time,
+		}
+	}
+	err = rows.Err()
+	return
+}
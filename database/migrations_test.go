@@ -0,0 +1,262 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func sqliteIndexes(t *testing.T, db *sql.DB, table string) map[string]bool {
+	rows, err := db.Query("SELECT name FROM pragma_index_list(?)", table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	indexes := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		indexes[name] = true
+	}
+	return indexes
+}
+
+func TestMigrateFreshDatabase(t *testing.T) {
+	db := newTestSQLiteDB(t)
+
+	cols, err := columnTypes(db.db, DIALECT_SQLITE, "analysis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []string{"id", "runname", "email", "nboot", "owner",
+		"criterion", "moves", "substmodel", "nogamma",
+		"tbecutoff", "norawtree", "nomovedtaxa"} {
+		if _, ok := cols[c]; !ok {
+			t.Errorf("Column analysis.%s is missing", c)
+		}
+	}
+	for _, c := range []string{"startpending", "startrunning", "end"} {
+		if !isDateType(cols[c]) {
+			t.Errorf("Column analysis.%s has type %q, expected a date type", c, cols[c])
+		}
+	}
+	for _, table := range []string{"users", "apikeys"} {
+		if cols, err = columnTypes(db.db, DIALECT_SQLITE, table); err != nil {
+			t.Fatal(err)
+		}
+		if len(cols) == 0 {
+			t.Errorf("Table %s is missing", table)
+		}
+	}
+
+	if cols, err = columnTypes(db.db, DIALECT_SQLITE, "users"); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []string{"provider", "subject"} {
+		if _, ok := cols[c]; !ok {
+			t.Errorf("Column users.%s is missing", c)
+		}
+	}
+
+	indexes := sqliteIndexes(t, db.db, "analysis")
+	for _, i := range []string{"analysis_owner", "analysis_startpending"} {
+		if !indexes[i] {
+			t.Errorf("Index %s is missing", i)
+		}
+	}
+	if !sqliteIndexes(t, db.db, "users")["users_subject"] {
+		t.Error("Index users_subject is missing")
+	}
+
+	status, err := db.MigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status) != len(migrations) {
+		t.Fatalf("Expected %d migrations, got %d", len(migrations), len(status))
+	}
+	for _, s := range status {
+		if !s.Applied {
+			t.Errorf("Migration %d is not applied", s.Version)
+		}
+	}
+
+	// Applied migrations are not applied again
+	if err = db.Migrate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMigrateLegacyDatabase(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "booster.db")
+	legacy, err := sql.Open("sqlite3", "file:"+file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Table and dates as written before migrations existed
+	if err = migrations[0].apply(legacy, DIALECT_SQLITE); err != nil {
+		t.Fatal(err)
+	}
+	submitted := time.Date(2020, 3, 4, 10, 20, 30, 0, time.Local)
+	if _, err = legacy.Exec(`INSERT INTO analysis (id, seqalign, alignfile, reffile, bootfile, fbptree,
+		tbenormtree, tberawtree, tbelogs, message, status, startpending, startrunning, end)
+		VALUES ('old', '', '', '', '', '', '', '', '', '', 2, ?, '', '')`,
+		submitted.Format(time.RFC1123)); err != nil {
+		t.Fatal(err)
+	}
+	legacy.Close()
+
+	db := NewSQLiteBoosterwebDB(file)
+	if err = db.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Disconnect()
+	if err = db.InitDatabase(); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := db.GetAnalysis("old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !a.StartPending.Equal(submitted) {
+		t.Errorf("Expected submission date %v, got %v", submitted, a.StartPending)
+	}
+	if !a.End.IsZero() {
+		t.Errorf("Expected no end date, got %v", a.End)
+	}
+	if a.Owner != "" || a.TransferCutoff != 0.3 || a.NoRawTree || a.NoMovedTaxa || a.NoGamma {
+		t.Errorf("New columns do not have their default values: %+v", a)
+	}
+}
+
+// Failed migrations are rolled back, and applied again at next start
+func TestMigrateRollback(t *testing.T) {
+	db := newTestSQLiteDB(t)
+	saved := migrations
+	defer func() { migrations = saved }()
+
+	failure := errors.New("failure")
+	migrations = append(append([]migration{}, saved...), migration{
+		len(saved) + 1,
+		"Failing migration",
+		func(db execer, dialect string) error {
+			if err := execAll(db, "ALTER TABLE analysis ADD COLUMN partial int"); err != nil {
+				return err
+			}
+			return failure
+		},
+	})
+	for i := 0; i < 2; i++ {
+		if err := db.Migrate(); err == nil || err.Error() != fmt.Sprintf("Database migration %d failed: failure", len(migrations)) {
+			t.Fatalf("Run %d: expected the failure of the migration, got %v", i, err)
+		}
+		if cols, _ := columnTypes(db.db, DIALECT_SQLITE, "analysis"); cols["partial"] != "" {
+			t.Errorf("Run %d: expected the column of the failed migration to be rolled back", i)
+		}
+	}
+
+	failure = nil
+	if err := db.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	status, err := db.MigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := status[len(status)-1]; !last.Applied {
+		t.Errorf("Expected the migration to be applied, got %+v", last)
+	}
+}
+
+// Date conversions interrupted on mysql, that has no transactional
+// schema changes, are completed
+func TestConvertDateColumnsInterrupted(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "booster.db")
+	legacy, err := sql.Open("sqlite3", "file:"+file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = migrations[0].apply(legacy, DIALECT_SQLITE); err != nil {
+		t.Fatal(err)
+	}
+	submitted := time.Date(2020, 3, 4, 10, 20, 30, 0, time.Local)
+	ended := submitted.Add(time.Hour)
+	if err = execAll(legacy,
+		`INSERT INTO analysis (id, seqalign, alignfile, reffile, bootfile, fbptree,
+		tbenormtree, tberawtree, tbelogs, message, status, startpending, startrunning, end)
+		VALUES ('old', '', '', '', '', '', '', '', '', '', 2, '`+submitted.Format(time.RFC1123)+`', '', '`+ended.Format(time.RFC1123)+`')`,
+		// Interrupted while copying the dates
+		"ALTER TABLE analysis ADD COLUMN startpending_new datetime",
+		// Interrupted after dropping the old column
+		"ALTER TABLE analysis ADD COLUMN end_new datetime"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = legacy.Exec("UPDATE analysis SET end_new=? WHERE id='old'", dbtime(ended)); err != nil {
+		t.Fatal(err)
+	}
+	if err = execAll(legacy, "ALTER TABLE analysis DROP COLUMN end"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = convertDateColumns(legacy, DIALECT_SQLITE); err != nil {
+		t.Fatal(err)
+	}
+	cols, err := columnTypes(legacy, DIALECT_SQLITE, "analysis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []string{"startpending", "startrunning", "end"} {
+		if !isDateType(cols[c]) {
+			t.Errorf("Column analysis.%s has type %q, expected a date type", c, cols[c])
+		}
+		if _, ok := cols[c+"_new"]; ok {
+			t.Errorf("Column analysis.%s_new is left", c)
+		}
+	}
+	legacy.Close()
+
+	db := NewSQLiteBoosterwebDB(file)
+	if err = db.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Disconnect()
+	if err = db.InitDatabase(); err != nil {
+		t.Fatal(err)
+	}
+	a, err := db.GetAnalysis("old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !a.StartPending.Equal(submitted) || !a.End.Equal(ended) {
+		t.Errorf("Expected dates %v and %v, got %v and %v", submitted, ended, a.StartPending, a.End)
+	}
+}
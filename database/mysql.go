@@ -27,7 +27,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"reflect"
+	"time"
 
 	"database/sql"
 	"github.com/evolbioinfo/booster-web/model"
@@ -43,33 +43,6 @@ type MySQLBoosterwebDB struct {
 	db     *sql.DB
 }
 
-type dbanalysis struct {
-	id            string `mysql-type:"varchar(100)" mysql-other:"NOT NULL PRIMARY KEY"` // Id of the analysis
-	runname       string `mysql-type:"varchar(100)" mysql-default:"''"`                 // Optional user given name of the run
-	email         string `mysql-type:"varchar(100)" mysql-default:"''"`                 // Email of the analysis creator
-	seqalign      string `mysql-type:"blob"`                                            // Input Fasta Sequence Alignment if user wants to build the ref/boot trees (priority over reffile and bootfile)
-	nbootrep      int    `mysql-type:"int" mysql-default:"0"`                           // Number of bootstrap replicates given by the user to build the bootstrap trees
-	alignfile     string `mysql-type:"longblob"`                                        // alignment input file (if user wants to build the trees)
-	alignalphabet int    `mysql-type:"int" mysql-default:"-1`                           // alignment alphabet 0: aa | 1: nt
-	workflow      int    `mysql-type:"int" mysql-default:"-1"`                          // workflow to launch if alignfile!="" : 8: PhyML-SMS, 9: FastTRee
-	alignnbseq    int    `mysql-type:"int" mysql-default:"-1"`                          // Number of sequences in the given alignment
-	alignlength   int    `mysql-type:"int" mysql-default:"-1"`                          // Length of the given alignment
-	reffile       string `mysql-type:"blob"`                                            // reference tree file
-	bootfile      string `mysql-type:"blob"`                                            // boot tree file
-	fbptree       string `mysql-type:"longtext"`                                        // tree with fbp supports
-	tbenormtree   string `mysql-type:"longtext"`                                        // tree with normalized tbe supports
-	tberawtree    string `mysql-type:"longtext"`                                        // tree with raw tbe supports in the form <id|avg_dist|depth> as branch names
-	tbelogs       string `mysql-type:"longtext"`                                        // tbe log file
-	status        int    `mysql-type:"int" mysql-default:"-1"`                          // Status of the analysis
-	jobid         string `mysql-type:"varchar(100)" mysql-default:"''"`                 // Galaxy or local Job id
-	galaxyhistory string `mysql-type:"varchar(100)" mysql-default:"''"`                 // Galaxy History
-	message       string `mysql-type:"longtext"`                                        // Optional message
-	nboot         int    `mysql-type:"int" mysql-default:"0"`                           // number of bootstrap trees
-	startpending  string `mysql-type:"varchar(100)" mysql-default:"''"`                 // date of job being submited
-	startrunning  string `mysql-type:"varchar(100)" mysql-default:"''"`                 // date of job being running
-	end           string `mysql-type:"varchar(100)" mysql-default:"''"`                 // date of job finished
-}
-
 /* Returns a new database */
 func NewMySQLBoosterwebDB(login, pass, url, dbname string, port int) *MySQLBoosterwebDB {
 	log.Print("New mysql database")
@@ -85,7 +58,7 @@ func NewMySQLBoosterwebDB(login, pass, url, dbname string, port int) *MySQLBoost
 
 func (db *MySQLBoosterwebDB) Connect() error {
 	log.Print("Connect mysql database")
-	d, err := sql.Open("mysql", fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", db.login, db.pass, db.url, db.port, db.dbname))
+	d, err := sql.Open("mysql", fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?parseTime=true", db.login, db.pass, db.url, db.port, db.dbname))
 	if err != nil {
 		log.Print(err)
 	} else {
@@ -106,56 +79,15 @@ func (db *MySQLBoosterwebDB) GetAnalysis(id string) (*model.Analysis, error) {
 	if db.db == nil {
 		return nil, errors.New("Database not opened")
 	}
-	rows, err := db.db.Query("SELECT id,runname,email,seqalign,nbootrep,alignfile,alignalphabet,workflow,alignnbseq,alignlength,reffile,bootfile,fbptree,tbenormtree,tberawtree,tbelogs,status,jobid,galaxyhistory,message,nboot,startpending,startrunning,end FROM analysis WHERE id = ?", id)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	dban := dbanalysis{}
-	if rows.Next() {
-		if err := rows.Scan(&dban.id, &dban.runname, &dban.email, &dban.seqalign, &dban.nbootrep,
-			&dban.alignfile, &dban.alignalphabet, &dban.workflow, &dban.alignnbseq, &dban.alignlength, &dban.reffile, &dban.bootfile,
-			&dban.fbptree, &dban.tbenormtree, &dban.tberawtree, &dban.tbelogs, &dban.status, &dban.jobid, &dban.galaxyhistory,
-			&dban.message, &dban.nboot, &dban.startpending, &dban.startrunning, &dban.end); err != nil {
-			return nil, err
-		}
-	} else {
-		return nil, errors.New("Analysis does not exist")
-	}
-
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
+	return queryAnalysis(db.db, "SELECT "+analysisColumns+" FROM analysis WHERE id = ?", id)
+}
 
-	a := &model.Analysis{
-		Id:            dban.id,
-		RunName:       dban.runname,
-		EMail:         dban.email,
-		SeqAlign:      dban.seqalign,
-		NbootRep:      dban.nbootrep,
-		Alignfile:     dban.alignfile,
-		AlignAlphabet: dban.alignalphabet,
-		Workflow:      dban.workflow,
-		AlignNbSeq:    dban.alignnbseq,
-		AlignLength:   dban.alignlength,
-		Reffile:       dban.reffile,
-		Bootfile:      dban.bootfile,
-		FbpTree:       dban.fbptree,
-		TbeNormTree:   dban.tbenormtree,
-		TbeRawTree:    dban.tberawtree,
-		TbeLogs:       dban.tbelogs,
-		Status:        dban.status,
-		JobId:         dban.jobid,
-		GalaxyHistory: dban.galaxyhistory,
-		Message:       dban.message,
-		Nboot:         dban.nboot,
-		StartPending:  dban.startpending,
-		StartRunning:  dban.startrunning,
-		End:           dban.end,
+// Returns the analysis without its alignment, result trees and logs
+func (db *MySQLBoosterwebDB) GetAnalysisSummary(id string) (*model.Analysis, error) {
+	if db.db == nil {
+		return nil, errors.New("Database not opened")
 	}
-
-	return a, nil
+	return queryAnalysis(db.db, "SELECT "+analysisSummaryColumns+" FROM analysis WHERE id = ?", id)
 }
 
 // Get only analyses that are running (1) or pending (0)
@@ -163,61 +95,15 @@ func (db *MySQLBoosterwebDB) GetRunningAnalyses() (analyses []*model.Analysis, e
 	if db.db == nil {
 		return nil, errors.New("Database not opened")
 	}
-	analyses = make([]*model.Analysis, 0)
-	var rows *sql.Rows
-	query := `SELECT id,runname, email,seqalign,nbootrep,alignfile,
-                         alignalphabet,workflow,alignnbseq,alignlength,reffile,bootfile,
-                         fbptree,tbenormtree,tberawtree,tbelogs,status,jobid,galaxyhistory,
-                         message,nboot,startpending,startrunning,end 
-                  FROM analysis 
-                  WHERE status=0 or status=1`
-	if rows, err = db.db.Query(query); err != nil {
-		return
-	}
-	defer rows.Close()
-
-	dban := dbanalysis{}
-	for rows.Next() {
-		if err = rows.Scan(&dban.id, &dban.runname, &dban.email, &dban.seqalign, &dban.nbootrep,
-			&dban.alignfile, &dban.alignalphabet, &dban.workflow, &dban.alignnbseq, &dban.alignlength, &dban.reffile, &dban.bootfile,
-			&dban.fbptree, &dban.tbenormtree, &dban.tberawtree, &dban.tbelogs, &dban.status, &dban.jobid, &dban.galaxyhistory,
-			&dban.message, &dban.nboot, &dban.startpending, &dban.startrunning, &dban.end); err != nil {
-			return
-		}
-		if err = rows.Err(); err != nil {
-			return
-		}
-
-		a := &model.Analysis{
-			Id:            dban.id,
-			RunName:       dban.runname,
-			EMail:         dban.email,
-			SeqAlign:      dban.seqalign,
-			NbootRep:      dban.nbootrep,
-			Alignfile:     dban.alignfile,
-			AlignAlphabet: dban.alignalphabet,
-			Workflow:      dban.workflow,
-			AlignNbSeq:    dban.alignnbseq,
-			AlignLength:   dban.alignlength,
-			Reffile:       dban.reffile,
-			Bootfile:      dban.bootfile,
-			FbpTree:       dban.fbptree,
-			TbeNormTree:   dban.tbenormtree,
-			TbeRawTree:    dban.tberawtree,
-			TbeLogs:       dban.tbelogs,
-			Status:        dban.status,
-			JobId:         dban.jobid,
-			GalaxyHistory: dban.galaxyhistory,
-			Message:       dban.message,
-			Nboot:         dban.nboot,
-			StartPending:  dban.startpending,
-			StartRunning:  dban.startrunning,
-			End:           dban.end,
-		}
-		analyses = append(analyses, a)
-	}
+	return queryAnalyses(db.db, "SELECT "+analysisColumns+" FROM analysis WHERE status=0 or status=1")
+}
 
-	return
+// Lists analyses, without their alignments, result trees and logs
+func (db *MySQLBoosterwebDB) ListAnalyses(filter AnalysisFilter) (analyses []*model.Analysis, next string, err error) {
+	if db.db == nil {
+		return nil, "", errors.New("Database not opened")
+	}
+	return listAnalyses(db.db, DIALECT_MYSQL, filter)
 }
 
 /* Update an anlysis or insert it if it does not exist */
@@ -228,13 +114,16 @@ func (db *MySQLBoosterwebDB) UpdateAnalysis(a *model.Analysis) error {
 		return errors.New("Database not opened")
 	}
 	query := `INSERT INTO analysis 
-                    (id, runname, email, seqalign, nbootrep, alignfile, alignalphabet,workflow, alignnbseq, alignlength, reffile, bootfile, fbptree,tbenormtree, tberawtree, tbelogs, status, jobid, galaxyhistory, message, nboot, startpending, startrunning , end) 
-                  VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?) 
+                    (id, runname, email, seqalign, nbootrep, alignfile, alignalphabet,workflow, alignnbseq, alignlength, reffile, bootfile, fbptree,tbenormtree, tberawtree, tbelogs, status, jobid, galaxyhistory, message, nboot, startpending, startrunning , end, owner, criterion, moves, substmodel, nogamma, tbecutoff, norawtree, nomovedtaxa) 
+                  VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?) 
                   ON DUPLICATE KEY UPDATE runname=values(runname), alignfile=values(alignfile),alignalphabet=values(alignalphabet),fbptree=values(fbptree), 
                                           tbenormtree=values(tbenormtree), tberawtree=values(tberawtree), tbelogs=values(tbelogs), 
                                           status=values(status),jobid=values(jobid),galaxyhistory=values(galaxyhistory),workflow=values(workflow), 
                                           alignnbseq=values(alignnbseq), alignLength=values(alignLength), message=values(message), nboot=values(nboot),
-                                          startpending=values(startpending), startrunning=values(startrunning), end=values(end)`
+                                          startpending=values(startpending), startrunning=values(startrunning), end=values(end),
+                                          owner=values(owner), criterion=values(criterion), moves=values(moves), substmodel=values(substmodel),
+                                          nogamma=values(nogamma), tbecutoff=values(tbecutoff), norawtree=values(norawtree), nomovedtaxa=values(nomovedtaxa),
+                                          email=values(email), seqalign=values(seqalign), nbootrep=values(nbootrep), reffile=values(reffile), bootfile=values(bootfile)`
 	_, err := db.db.Exec(
 		query,
 		a.Id,
@@ -258,104 +147,147 @@ func (db *MySQLBoosterwebDB) UpdateAnalysis(a *model.Analysis) error {
 		a.GalaxyHistory,
 		a.Message,
 		a.Nboot,
-		a.StartPending,
-		a.StartRunning,
-		a.End,
+		dbtime(a.StartPending),
+		dbtime(a.StartRunning),
+		dbtime(a.End),
+		a.Owner,
+		a.Criterion,
+		a.Moves,
+		a.Model,
+		a.NoGamma,
+		a.TransferCutoff,
+		a.NoRawTree,
+		a.NoMovedTaxa,
 	)
 	return err
 }
 
+func (db *MySQLBoosterwebDB) UpdateProgress(id string, nboot int) error {
+	if db.db == nil {
+		return errors.New("Database not opened")
+	}
+	return updateProgress(db.db, DIALECT_MYSQL, id, nboot)
+}
+
+func (db *MySQLBoosterwebDB) UpdateStatus(id string, status int, message string) error {
+	if db.db == nil {
+		return errors.New("Database not opened")
+	}
+	return updateStatus(db.db, DIALECT_MYSQL, id, status, message)
+}
+
 /* Check if table is present otherwise creates it */
 func (db *MySQLBoosterwebDB) InitDatabase() (err error) {
 	log.Print("Initializing mysql Database")
-	query := "CREATE TABLE if not exists analysis ("
-	dba := dbanalysis{}
-	dbanalysistype := reflect.ValueOf(dba).Type()
-	fields := dbanalysistype.NumField()
-	for i := 0; i < fields; i++ {
-		field := dbanalysistype.Field(i)
-		if mysqltype, mysqltypeok := field.Tag.Lookup("mysql-type"); mysqltypeok {
-			mysqldefault, mysqldefaultok := field.Tag.Lookup("mysql-default")
-			mysqlother, mysqlotherok := field.Tag.Lookup("mysql-other")
-			if i > 0 {
-				query += ","
-			}
-			query += field.Name + " " + mysqltype
-			if mysqlotherok {
-				query += " " + mysqlother
-			}
-			// If there is a default value for this field
-			if mysqldefaultok {
-				query += " DEFAULT " + mysqldefault
-			}
-		} else {
-			return errors.New(fmt.Sprintf("Cannot create table, dbanalysis struct element %s does not have mysql type", field.Name))
-		}
+	return db.Migrate()
+}
+
+/* Applies pending schema migrations */
+func (db *MySQLBoosterwebDB) Migrate() error {
+	if db.db == nil {
+		return errors.New("Database not opened")
 	}
-	query += ");"
-	if _, err = db.db.Exec(query); err == nil {
-		err = db.checkColumns()
+	return migrate(db.db, DIALECT_MYSQL)
+}
+
+func (db *MySQLBoosterwebDB) MigrationStatus() ([]MigrationStatus, error) {
+	if db.db == nil {
+		return nil, errors.New("Database not opened")
 	}
-	return err
+	return migrationStatus(db.db, DIALECT_MYSQL)
 }
 
-/* Check if table has all the columns, otherwise adds them */
-func (db *MySQLBoosterwebDB) checkColumns() error {
-	log.Print("Checking database tables")
+// Will delete analyses older than d days, and returns their ids
+func (db *MySQLBoosterwebDB) DeleteOldAnalyses(days int) (deleted []string, err error) {
+	log.Print("Mysql database : Deleting old analyses")
+	if db.db == nil {
+		return nil, errors.New("Database not opened")
+	}
 
-	rows, err := db.db.Query("SELECT * FROM analysis")
-	cols := make(map[string]bool)
+	// Dates are stored in UTC
+	if deleted, err = queryIds(db.db, `SELECT id FROM analysis 
+                             where status<>0 and status<>1 and status<>6 and end < DATE_SUB(UTC_TIMESTAMP(), INTERVAL ? DAY)`, days); err != nil {
+		return
+	}
+	err = deleteAnalyses(db.db, DIALECT_MYSQL, deleted)
+	return
+}
 
-	if colnames, err := rows.Columns(); err == nil {
-		for _, col := range colnames {
-			cols[col] = true
-		}
-	} else {
-		return err
+func (db *MySQLBoosterwebDB) GetUser(id string) (*model.User, error) {
+	if db.db == nil {
+		return nil, errors.New("Database not opened")
 	}
+	return queryUser(db.db, DIALECT_MYSQL, "id", id)
+}
 
-	dba := dbanalysis{}
-	dbanalysistype := reflect.ValueOf(dba).Type()
-	fields := dbanalysistype.NumField()
-	for i := 0; i < fields; i++ {
-		field := dbanalysistype.Field(i)
-		if mysqltype, mysqltypeok := field.Tag.Lookup("mysql-type"); mysqltypeok {
-			mysqldefault, mysqldefaultok := field.Tag.Lookup("mysql-default")
-			mysqlother, mysqlotherok := field.Tag.Lookup("mysql-other")
-			if _, colok := cols[field.Name]; !colok {
-				log.Print(fmt.Sprintf("Adding database column %s", field.Name))
-				query := "ALTER TABLE analysis ADD COLUMN " + field.Name + " " + mysqltype
-				// If there is a default value for this field
-				if mysqldefaultok {
-					query += " DEFAULT " + mysqldefault
-				}
-				if mysqlotherok {
-					query += " " + mysqlother
-				}
-				_, err = db.db.Exec(query)
-				if err != nil {
-					return err
-				}
-			}
-		} else {
-			return errors.New(fmt.Sprintf("dbanalysis struct element %s does not have mysql type", field.Name))
-		}
+func (db *MySQLBoosterwebDB) GetUserByLogin(login string) (*model.User, error) {
+	if db.db == nil {
+		return nil, errors.New("Database not opened")
 	}
+	return queryUser(db.db, DIALECT_MYSQL, "login", login)
+}
 
-	return err
+func (db *MySQLBoosterwebDB) GetUserBySubject(provider, subject string) (*model.User, error) {
+	if db.db == nil {
+		return nil, errors.New("Database not opened")
+	}
+	return queryUserBySubject(db.db, DIALECT_MYSQL, provider, subject)
 }
 
-// Will delete analyses older than d days
-func (db *MySQLBoosterwebDB) DeleteOldAnalyses(days int) (err error) {
-	log.Print("Mysql database : Deleting old analyses")
+func (db *MySQLBoosterwebDB) ListUsers() ([]*model.User, error) {
+	if db.db == nil {
+		return nil, errors.New("Database not opened")
+	}
+	return queryUsers(db.db, "SELECT "+userColumns+" FROM users ORDER BY login")
+}
+
+/* Update a user or insert it if it does not exist */
+func (db *MySQLBoosterwebDB) UpdateUser(u *model.User) error {
 	if db.db == nil {
 		return errors.New("Database not opened")
 	}
+	return updateUser(db.db, DIALECT_MYSQL, u)
+}
 
-	query := `UPDATE analysis set alignfile='',fbptree='', tbenormtree='', tberawtree='',tbelogs='',status=6 where status<>0 and status<>1 and STR_TO_DATE(replace(replace(end,"CET",""),"CEST",""), '%a, %d %b %Y %H:%i:%S')<DATE_SUB(CURDATE(), INTERVAL `
-	query += fmt.Sprintf("%d", days) + " DAY);"
+func (db *MySQLBoosterwebDB) DeleteUser(id string) error {
+	if db.db == nil {
+		return errors.New("Database not opened")
+	}
+	return deleteUser(db.db, DIALECT_MYSQL, id)
+}
 
-	_, err = db.db.Exec(query)
+// Returns the api key having the given hash
+func (db *MySQLBoosterwebDB) GetApiKey(hash string) (*model.ApiKey, error) {
+	if db.db == nil {
+		return nil, errors.New("Database not opened")
+	}
+	return getApiKey(db.db, DIALECT_MYSQL, hash)
+}
 
-	return
+func (db *MySQLBoosterwebDB) ListApiKeys(userid string) ([]*model.ApiKey, error) {
+	if db.db == nil {
+		return nil, errors.New("Database not opened")
+	}
+	return listApiKeys(db.db, DIALECT_MYSQL, userid)
+}
+
+func (db *MySQLBoosterwebDB) InsertApiKey(k *model.ApiKey) error {
+	if db.db == nil {
+		return errors.New("Database not opened")
+	}
+	return insertApiKey(db.db, DIALECT_MYSQL, k)
+}
+
+func (db *MySQLBoosterwebDB) UpdateApiKeyUsage(id string, used time.Time) error {
+	if db.db == nil {
+		return errors.New("Database not opened")
+	}
+	return updateApiKeyUsage(db.db, DIALECT_MYSQL, id, used)
+}
+
+func (db *MySQLBoosterwebDB) DeleteApiKey(id string) error {
+	if db.db == nil {
+		return errors.New("Database not opened")
+	}
+	return deleteApiKey(db.db, DIALECT_MYSQL, id)
 }
@@ -0,0 +1,305 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+package database
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"database/sql"
+	"github.com/evolbioinfo/booster-web/model"
+	_ "github.com/lib/pq"
+)
+
+// PostgreSQL database.
+//
+// Dates are stored as timestamps, so old analyses
+// can be selected directly by the database.
+type PostgresBoosterwebDB struct {
+	login   string
+	pass    string
+	url     string
+	dbname  string
+	port    int
+	sslmode string // disable, require, verify-ca, verify-full or "" (driver default)
+	db      *sql.DB
+}
+
+/* Returns a new database */
+func NewPostgresBoosterwebDB(login, pass, url, dbname string, port int, sslmode string) *PostgresBoosterwebDB {
+	log.Print("New postgres database")
+	return &PostgresBoosterwebDB{
+		login,
+		pass,
+		url,
+		dbname,
+		port,
+		sslmode,
+		nil,
+	}
+}
+
+func (db *PostgresBoosterwebDB) Connect() error {
+	log.Print("Connect postgres database")
+	dsn := url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(db.login, db.pass),
+		Host:   fmt.Sprintf("%s:%d", db.url, db.port),
+		Path:   db.dbname,
+	}
+	if db.sslmode != "" {
+		dsn.RawQuery = url.Values{"sslmode": {db.sslmode}}.Encode()
+	}
+	d, err := sql.Open("postgres", dsn.String())
+	if err != nil {
+		log.Print(err)
+	} else {
+		db.db = d
+	}
+	return err
+}
+
+func (db *PostgresBoosterwebDB) Disconnect() error {
+	log.Print("Disconnect postgres database")
+	if db.db == nil {
+		return errors.New("Database not opened")
+	}
+	return db.db.Close()
+}
+
+func (db *PostgresBoosterwebDB) GetAnalysis(id string) (*model.Analysis, error) {
+	if db.db == nil {
+		return nil, errors.New("Database not opened")
+	}
+	return queryAnalysis(db.db, "SELECT "+analysisColumnsPostgres+" FROM analysis WHERE id = $1", id)
+}
+
+// Returns the analysis without its alignment, result trees and logs
+func (db *PostgresBoosterwebDB) GetAnalysisSummary(id string) (*model.Analysis, error) {
+	if db.db == nil {
+		return nil, errors.New("Database not opened")
+	}
+	return queryAnalysis(db.db, "SELECT "+analysisSummaryColumnsPostgres+" FROM analysis WHERE id = $1", id)
+}
+
+// Get only analyses that are running (1) or pending (0)
+func (db *PostgresBoosterwebDB) GetRunningAnalyses() (analyses []*model.Analysis, err error) {
+	if db.db == nil {
+		return nil, errors.New("Database not opened")
+	}
+	return queryAnalyses(db.db, "SELECT "+analysisColumnsPostgres+" FROM analysis WHERE status=0 or status=1")
+}
+
+// Lists analyses, without their alignments, result trees and logs
+func (db *PostgresBoosterwebDB) ListAnalyses(filter AnalysisFilter) (analyses []*model.Analysis, next string, err error) {
+	if db.db == nil {
+		return nil, "", errors.New("Database not opened")
+	}
+	return listAnalyses(db.db, DIALECT_POSTGRES, filter)
+}
+
+/* Update an anlysis or insert it if it does not exist */
+func (db *PostgresBoosterwebDB) UpdateAnalysis(a *model.Analysis) error {
+	if db.db == nil {
+		return errors.New("Database not opened")
+	}
+	query := `INSERT INTO analysis 
+                    (id, runname, email, seqalign, nbootrep, alignfile, alignalphabet,workflow, alignnbseq, alignlength, reffile, bootfile, fbptree,tbenormtree, tberawtree, tbelogs, status, jobid, galaxyhistory, message, nboot, startpending, startrunning , "end", owner, criterion, moves, substmodel, nogamma, tbecutoff, norawtree, nomovedtaxa) 
+                  VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18,$19,$20,$21,$22,$23,$24,$25,$26,$27,$28,$29,$30,$31,$32) 
+                  ON CONFLICT (id) DO UPDATE SET runname=EXCLUDED.runname, alignfile=EXCLUDED.alignfile,alignalphabet=EXCLUDED.alignalphabet,fbptree=EXCLUDED.fbptree, 
+                                          tbenormtree=EXCLUDED.tbenormtree, tberawtree=EXCLUDED.tberawtree, tbelogs=EXCLUDED.tbelogs, 
+                                          status=EXCLUDED.status,jobid=EXCLUDED.jobid,galaxyhistory=EXCLUDED.galaxyhistory,workflow=EXCLUDED.workflow, 
+                                          alignnbseq=EXCLUDED.alignnbseq, alignlength=EXCLUDED.alignlength, message=EXCLUDED.message, nboot=EXCLUDED.nboot,
+                                          startpending=EXCLUDED.startpending, startrunning=EXCLUDED.startrunning, "end"=EXCLUDED."end",
+                                          owner=EXCLUDED.owner, criterion=EXCLUDED.criterion, moves=EXCLUDED.moves, substmodel=EXCLUDED.substmodel,
+                                          nogamma=EXCLUDED.nogamma, tbecutoff=EXCLUDED.tbecutoff, norawtree=EXCLUDED.norawtree, nomovedtaxa=EXCLUDED.nomovedtaxa,
+                                          email=EXCLUDED.email, seqalign=EXCLUDED.seqalign, nbootrep=EXCLUDED.nbootrep, reffile=EXCLUDED.reffile, bootfile=EXCLUDED.bootfile`
+	_, err := db.db.Exec(
+		query,
+		a.Id,
+		a.RunName,
+		a.EMail,
+		a.SeqAlign,
+		a.NbootRep,
+		a.Alignfile,
+		a.AlignAlphabet,
+		a.Workflow,
+		a.AlignNbSeq,
+		a.AlignLength,
+		a.Reffile,
+		a.Bootfile,
+		a.FbpTree,
+		a.TbeNormTree,
+		a.TbeRawTree,
+		a.TbeLogs,
+		a.Status,
+		a.JobId,
+		a.GalaxyHistory,
+		a.Message,
+		a.Nboot,
+		dbtime(a.StartPending),
+		dbtime(a.StartRunning),
+		dbtime(a.End),
+		a.Owner,
+		a.Criterion,
+		a.Moves,
+		a.Model,
+		a.NoGamma,
+		a.TransferCutoff,
+		a.NoRawTree,
+		a.NoMovedTaxa,
+	)
+	return err
+}
+
+func (db *PostgresBoosterwebDB) UpdateProgress(id string, nboot int) error {
+	if db.db == nil {
+		return errors.New("Database not opened")
+	}
+	return updateProgress(db.db, DIALECT_POSTGRES, id, nboot)
+}
+
+func (db *PostgresBoosterwebDB) UpdateStatus(id string, status int, message string) error {
+	if db.db == nil {
+		return errors.New("Database not opened")
+	}
+	return updateStatus(db.db, DIALECT_POSTGRES, id, status, message)
+}
+
+/* Check if table is present otherwise creates it */
+func (db *PostgresBoosterwebDB) InitDatabase() (err error) {
+	log.Print("Initializing postgres Database")
+	return db.Migrate()
+}
+
+/* Applies pending schema migrations */
+func (db *PostgresBoosterwebDB) Migrate() error {
+	if db.db == nil {
+		return errors.New("Database not opened")
+	}
+	return migrate(db.db, DIALECT_POSTGRES)
+}
+
+func (db *PostgresBoosterwebDB) MigrationStatus() ([]MigrationStatus, error) {
+	if db.db == nil {
+		return nil, errors.New("Database not opened")
+	}
+	return migrationStatus(db.db, DIALECT_POSTGRES)
+}
+
+// Will delete analyses older than d days, and returns their ids
+func (db *PostgresBoosterwebDB) DeleteOldAnalyses(days int) (deleted []string, err error) {
+	log.Print("Postgres database : Deleting old analyses")
+	if db.db == nil {
+		return nil, errors.New("Database not opened")
+	}
+	if deleted, err = queryIds(db.db, `SELECT id FROM analysis 
+                             where status<>0 and status<>1 and status<>6 and "end" < now() - make_interval(days => $1)`, days); err != nil {
+		return
+	}
+	err = deleteAnalyses(db.db, DIALECT_POSTGRES, deleted)
+	return
+}
+
+func (db *PostgresBoosterwebDB) GetUser(id string) (*model.User, error) {
+	if db.db == nil {
+		return nil, errors.New("Database not opened")
+	}
+	return queryUser(db.db, DIALECT_POSTGRES, "id", id)
+}
+
+func (db *PostgresBoosterwebDB) GetUserByLogin(login string) (*model.User, error) {
+	if db.db == nil {
+		return nil, errors.New("Database not opened")
+	}
+	return queryUser(db.db, DIALECT_POSTGRES, "login", login)
+}
+
+func (db *PostgresBoosterwebDB) GetUserBySubject(provider, subject string) (*model.User, error) {
+	if db.db == nil {
+		return nil, errors.New("Database not opened")
+	}
+	return queryUserBySubject(db.db, DIALECT_POSTGRES, provider, subject)
+}
+
+func (db *PostgresBoosterwebDB) ListUsers() ([]*model.User, error) {
+	if db.db == nil {
+		return nil, errors.New("Database not opened")
+	}
+	return queryUsers(db.db, "SELECT "+userColumns+" FROM users ORDER BY login")
+}
+
+/* Update a user or insert it if it does not exist */
+func (db *PostgresBoosterwebDB) UpdateUser(u *model.User) error {
+	if db.db == nil {
+		return errors.New("Database not opened")
+	}
+	return updateUser(db.db, DIALECT_POSTGRES, u)
+}
+
+func (db *PostgresBoosterwebDB) DeleteUser(id string) error {
+	if db.db == nil {
+		return errors.New("Database not opened")
+	}
+	return deleteUser(db.db, DIALECT_POSTGRES, id)
+}
+
+// Returns the api key having the given hash
+func (db *PostgresBoosterwebDB) GetApiKey(hash string) (*model.ApiKey, error) {
+	if db.db == nil {
+		return nil, errors.New("Database not opened")
+	}
+	return getApiKey(db.db, DIALECT_POSTGRES, hash)
+}
+
+func (db *PostgresBoosterwebDB) ListApiKeys(userid string) ([]*model.ApiKey, error) {
+	if db.db == nil {
+		return nil, errors.New("Database not opened")
+	}
+	return listApiKeys(db.db, DIALECT_POSTGRES, userid)
+}
+
+func (db *PostgresBoosterwebDB) InsertApiKey(k *model.ApiKey) error {
+	if db.db == nil {
+		return errors.New("Database not opened")
+	}
+	return insertApiKey(db.db, DIALECT_POSTGRES, k)
+}
+
+func (db *PostgresBoosterwebDB) UpdateApiKeyUsage(id string, used time.Time) error {
+	if db.db == nil {
+		return errors.New("Database not opened")
+	}
+	return updateApiKeyUsage(db.db, DIALECT_POSTGRES, id, used)
+}
+
+func (db *PostgresBoosterwebDB) DeleteApiKey(id string) error {
+	if db.db == nil {
+		return errors.New("Database not opened")
+	}
+	return deleteApiKey(db.db, DIALECT_POSTGRES, id)
+}
@@ -0,0 +1,492 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/evolbioinfo/booster-web/model"
+)
+
+// Row of the analysis table, shared by sql databases.
+//
+// The table is created and modified by the migrations (see migrations.go).
+// Dates are stored as DATETIME/timestamp columns, NULL if not set.
+type dbanalysis struct {
+	id            string       // Id of the analysis
+	runname       string       // Optional user given name of the run
+	email         string       // Email of the analysis creator
+	seqalign      string       // Input Fasta Sequence Alignment if user wants to build the ref/boot trees (priority over reffile and bootfile)
+	nbootrep      int          // Number of bootstrap replicates given by the user to build the bootstrap trees
+	alignfile     string       // alignment input file (if user wants to build the trees)
+	alignalphabet int          // alignment alphabet 0: aa | 1: nt
+	workflow      int          // workflow to launch if alignfile!="" : 8: PhyML-SMS, 9: FastTRee
+	alignnbseq    int          // Number of sequences in the given alignment
+	alignlength   int          // Length of the given alignment
+	reffile       string       // reference tree file
+	bootfile      string       // boot tree file
+	fbptree       string       // tree with fbp supports
+	tbenormtree   string       // tree with normalized tbe supports
+	tberawtree    string       // tree with raw tbe supports in the form <id|avg_dist|depth> as branch names
+	tbelogs       string       // tbe log file
+	status        int          // Status of the analysis
+	jobid         string       // Galaxy or local Job id
+	galaxyhistory string       // Galaxy History
+	message       string       // Optional message
+	nboot         int          // number of bootstrap trees
+	startpending  sql.NullTime // date of job being submited
+	startrunning  sql.NullTime // date of job being running
+	end           sql.NullTime // date of job finished
+	owner         string       // id of the user who submitted the analysis
+	criterion     string       // model selection criterion of the tree inference, '': default
+	moves         string       // tree search moves of the tree inference, '': default
+	substmodel    string       // substitution model of the tree inference, '': default
+	nogamma       bool         // tree inference without gamma distributed rates
+	tbecutoff     float64      // transfer cutoff of the taxa transfer index
+	norawtree     bool         // no tree with raw average transfer distances
+	nomovedtaxa   bool         // no taxa transfer indexes (tbe logs)
+}
+
+// Returns the date to store in a DATETIME/timestamp column:
+// nil if the date is not set, UTC otherwise (mysql DATETIME
+// columns do not store time zones)
+func dbtime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC()
+}
+
+// Database dialects
+const (
+	DIALECT_MYSQL    = "mysql"
+	DIALECT_POSTGRES = "postgres"
+	DIALECT_SQLITE   = "sqlite"
+)
+
+// Placeholder of the ith (starting at 1) argument of a query
+func placeholder(dialect string, i int) string {
+	if dialect == DIALECT_POSTGRES {
+		return fmt.Sprintf("$%d", i)
+	}
+	return "?"
+}
+
+// Columns of the analysis table, in the order expected by scanAnalysis
+const analysisColumns = `id,runname,email,seqalign,nbootrep,alignfile,
+                         alignalphabet,workflow,alignnbseq,alignlength,reffile,bootfile,
+                         fbptree,tbenormtree,tberawtree,tbelogs,status,jobid,galaxyhistory,
+                         message,nboot,startpending,startrunning,end,owner,
+                         criterion,moves,substmodel,nogamma,
+                         tbecutoff,norawtree,nomovedtaxa`
+
+// Same columns, quoted for postgres ("end" is a reserved word)
+const analysisColumnsPostgres = `id,runname,email,seqalign,nbootrep,alignfile,
+                         alignalphabet,workflow,alignnbseq,alignlength,reffile,bootfile,
+                         fbptree,tbenormtree,tberawtree,tbelogs,status,jobid,galaxyhistory,
+                         message,nboot,startpending,startrunning,"end",owner,
+                         criterion,moves,substmodel,nogamma,
+                         tbecutoff,norawtree,nomovedtaxa`
+
+// Columns selected when listing analyses, in the order expected by scanAnalysis:
+// alignments, result trees and logs are replaced by empty strings
+const analysisSummaryColumns = `id,runname,email,seqalign,nbootrep,'',
+                         alignalphabet,workflow,alignnbseq,alignlength,reffile,bootfile,
+                         '','','','',status,jobid,galaxyhistory,
+                         message,nboot,startpending,startrunning,end,owner,
+                         criterion,moves,substmodel,nogamma,
+                         tbecutoff,norawtree,nomovedtaxa`
+
+const analysisSummaryColumnsPostgres = `id,runname,email,seqalign,nbootrep,'',
+                         alignalphabet,workflow,alignnbseq,alignlength,reffile,bootfile,
+                         '','','','',status,jobid,galaxyhistory,
+                         message,nboot,startpending,startrunning,"end",owner,
+                         criterion,moves,substmodel,nogamma,
+                         tbecutoff,norawtree,nomovedtaxa`
+
+// Quotes the column name if needed by the dialect
+func quoteColumn(dialect, name string) string {
+	if dialect == DIALECT_POSTGRES {
+		return `"` + name + `"`
+	}
+	return name
+}
+
+// Scans the current row (selected with analysisColumns) into a new Analysis
+func scanAnalysis(rows *sql.Rows) (a *model.Analysis, err error) {
+	dban := dbanalysis{}
+	if err = rows.Scan(&dban.id, &dban.runname, &dban.email, &dban.seqalign, &dban.nbootrep,
+		&dban.alignfile, &dban.alignalphabet, &dban.workflow, &dban.alignnbseq, &dban.alignlength, &dban.reffile, &dban.bootfile,
+		&dban.fbptree, &dban.tbenormtree, &dban.tberawtree, &dban.tbelogs, &dban.status, &dban.jobid, &dban.galaxyhistory,
+		&dban.message, &dban.nboot, &dban.startpending, &dban.startrunning, &dban.end, &dban.owner,
+		&dban.criterion, &dban.moves, &dban.substmodel, &dban.nogamma,
+		&dban.tbecutoff, &dban.norawtree, &dban.nomovedtaxa); err != nil {
+		return
+	}
+
+	a = &model.Analysis{
+		Id:            dban.id,
+		RunName:       dban.runname,
+		EMail:         dban.email,
+		SeqAlign:      dban.seqalign,
+		NbootRep:      dban.nbootrep,
+		Alignfile:     dban.alignfile,
+		AlignAlphabet: dban.alignalphabet,
+		Workflow:      dban.workflow,
+		AlignNbSeq:    dban.alignnbseq,
+		AlignLength:   dban.alignlength,
+		Reffile:       dban.reffile,
+		Bootfile:      dban.bootfile,
+		FbpTree:       dban.fbptree,
+		TbeNormTree:   dban.tbenormtree,
+		TbeRawTree:    dban.tberawtree,
+		TbeLogs:       dban.tbelogs,
+		Status:        dban.status,
+		JobId:         dban.jobid,
+		GalaxyHistory: dban.galaxyhistory,
+		Message:       dban.message,
+		Nboot:         dban.nboot,
+		StartPending:  dban.startpending.Time,
+		StartRunning:  dban.startrunning.Time,
+		End:           dban.end.Time,
+		Owner:         dban.owner,
+		InferenceParams: model.InferenceParams{
+			Criterion: dban.criterion,
+			Moves:     dban.moves,
+			Model:     dban.substmodel,
+			NoGamma:   dban.nogamma,
+		},
+		TBEParams: model.TBEParams{
+			TransferCutoff: dban.tbecutoff,
+			NoRawTree:      dban.norawtree,
+			NoMovedTaxa:    dban.nomovedtaxa,
+		},
+	}
+	return
+}
+
+// Selects a single analysis with the given query and arguments
+func queryAnalysis(db *sql.DB, query string, args ...interface{}) (a *model.Analysis, err error) {
+	var rows *sql.Rows
+	if rows, err = db.Query(query, args...); err != nil {
+		return
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err = rows.Err(); err == nil {
+			err = errors.New("Analysis does not exist")
+		}
+		return
+	}
+	if a, err = scanAnalysis(rows); err != nil {
+		return
+	}
+	err = rows.Err()
+	return
+}
+
+// Selects all the analyses returned by the given query and arguments
+func queryAnalyses(db *sql.DB, query string, args ...interface{}) (analyses []*model.Analysis, err error) {
+	var rows *sql.Rows
+	var a *model.Analysis
+
+	analyses = make([]*model.Analysis, 0)
+	if rows, err = db.Query(query, args...); err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if a, err = scanAnalysis(rows); err != nil {
+			return
+		}
+		analyses = append(analyses, a)
+	}
+	err = rows.Err()
+	return
+}
+
+// Returns the ids of the analyses selected by the query
+func queryIds(db *sql.DB, query string, args ...interface{}) (ids []string, err error) {
+	var rows *sql.Rows
+	var id string
+
+	if rows, err = db.Query(query, args...); err != nil {
+		return
+	}
+	defer rows.Close()
+
+	ids = make([]string, 0)
+	for rows.Next() {
+		if err = rows.Scan(&id); err != nil {
+			return
+		}
+		ids = append(ids, id)
+	}
+	err = rows.Err()
+	return
+}
+
+/*
+Lists the analyses selected by the filter, without their alignments,
+result trees and logs, from the most recently submitted.
+
+next is the cursor of the following page, empty if it is the last page.
+*/
+func listAnalyses(db *sql.DB, dialect string, f AnalysisFilter) (analyses []*model.Analysis, next string, err error) {
+	var args []interface{}
+	// Adds an argument to the query, and returns its placeholder
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return placeholder(dialect, len(args))
+	}
+	in := func(values []int) string {
+		ph := make([]string, len(values))
+		for i, v := range values {
+			ph[i] = arg(v)
+		}
+		return "(" + strings.Join(ph, ",") + ")"
+	}
+
+	where := []string{"startpending IS NOT NULL"}
+	if len(f.Status) > 0 {
+		where = append(where, "status IN "+in(f.Status))
+	}
+	if len(f.Workflow) > 0 {
+		where = append(where, "workflow IN "+in(f.Workflow))
+	}
+	if f.RunName != "" {
+		pattern := "%" + escapeLike(strings.ToLower(f.RunName)) + "%"
+		where = append(where, "LOWER(runname) LIKE "+arg(pattern)+" ESCAPE '!'")
+	}
+	if f.EMail != "" {
+		where = append(where, "email = "+arg(f.EMail))
+	}
+	if f.Owner != "" {
+		where = append(where, "owner = "+arg(f.Owner))
+	}
+	if !f.From.IsZero() {
+		where = append(where, "startpending >= "+arg(dbtime(f.From)))
+	}
+	if !f.To.IsZero() {
+		where = append(where, "startpending < "+arg(dbtime(f.To)))
+	}
+	if f.Cursor != "" {
+		var date time.Time
+		var id string
+		if date, id, err = decodeCursor(f.Cursor); err != nil {
+			return
+		}
+		where = append(where, "(startpending < "+arg(dbtime(date))+
+			" OR (startpending = "+arg(dbtime(date))+" AND id < "+arg(id)+"))")
+	}
+
+	columns := analysisSummaryColumns
+	if dialect == DIALECT_POSTGRES {
+		columns = analysisSummaryColumnsPostgres
+	}
+	limit := f.limit()
+	// One more analysis is selected to know if there is a next page
+	query := fmt.Sprintf("SELECT %s FROM analysis WHERE %s ORDER BY startpending DESC, id DESC LIMIT %d",
+		columns, strings.Join(where, " AND "), limit+1)
+	if analyses, err = queryAnalyses(db, query, args...); err != nil {
+		return
+	}
+	if len(analyses) > limit {
+		analyses = analyses[:limit]
+		next = encodeCursor(analyses[limit-1])
+	}
+	return
+}
+
+// Escapes the LIKE wildcards of s, with '!' as escape character
+// (the default escape character differs between databases)
+func escapeLike(s string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(s)
+}
+
+// Updates the progress of the analysis without rewriting the whole row
+func updateProgress(db *sql.DB, dialect, id string, nboot int) (err error) {
+	query := "UPDATE analysis set nboot=" + placeholder(dialect, 1) + " where id=" + placeholder(dialect, 2)
+	_, err = db.Exec(query, nboot, id)
+	return
+}
+
+// Updates the status and message of the analysis without rewriting the whole row
+func updateStatus(db *sql.DB, dialect, id string, status int, message string) (err error) {
+	query := "UPDATE analysis set status=" + placeholder(dialect, 1) + ", message=" + placeholder(dialect, 2) + " where id=" + placeholder(dialect, 3)
+	_, err = db.Exec(query, status, message, id)
+	return
+}
+
+// Removes the results of the given analyses, and marks them as deleted
+func deleteAnalyses(db *sql.DB, dialect string, ids []string) (err error) {
+	query := "UPDATE analysis set alignfile='',fbptree='', tbenormtree='', tberawtree='',tbelogs='',status=6 where id=" + placeholder(dialect, 1)
+	for _, id := range ids {
+		if _, err = db.Exec(query, id); err != nil {
+			return
+		}
+	}
+	return
+}
+
+/*
+Converts the date columns of the analysis table that are still
+stored as strings (before dates were stored as DATETIME)
+*/
+func convertDateColumns(db execer, dialect string) error {
+	cols, err := columnTypes(db, dialect, "analysis")
+	if err != nil {
+		return err
+	}
+
+	coltype := dialectQuery(dialect, "datetime", "timestamptz")
+	for _, name := range []string{"startpending", "startrunning", "end"} {
+		current, colok := cols[name]
+		_, tmpok := cols[name+"_new"]
+		switch {
+		case !colok && tmpok:
+			// Conversion interrupted after the old column was dropped (mysql)
+			err = renameColumn(db, dialect, name+"_new", name, coltype)
+		case colok && !isDateType(current):
+			if tmpok {
+				// Conversion interrupted while copying the dates (mysql)
+				if _, err = db.Exec("ALTER TABLE analysis DROP COLUMN " + quoteColumn(dialect, name+"_new")); err != nil {
+					return err
+				}
+			}
+			err = migrateDateColumn(db, dialect, name, coltype)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the types of the columns of the table (empty if the table does not exist)
+func columnTypes(db execer, dialect, table string) (cols map[string]string, err error) {
+	var rows *sql.Rows
+	var name, coltype string
+
+	switch dialect {
+	case DIALECT_SQLITE:
+		rows, err = db.Query("SELECT name, type FROM pragma_table_info(?)", table)
+	case DIALECT_POSTGRES:
+		rows, err = db.Query("SELECT column_name, data_type FROM information_schema.columns WHERE table_schema=current_schema() AND table_name=$1", table)
+	default:
+		rows, err = db.Query("SELECT COLUMN_NAME, DATA_TYPE FROM information_schema.COLUMNS WHERE TABLE_SCHEMA=DATABASE() AND TABLE_NAME=?", table)
+	}
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	cols = make(map[string]string)
+	for rows.Next() {
+		if err = rows.Scan(&name, &coltype); err != nil {
+			return
+		}
+		cols[strings.ToLower(name)] = coltype
+	}
+	err = rows.Err()
+	return
+}
+
+// True if the column type stores dates (datetime, timestamp, timestamp with time zone, etc.)
+func isDateType(coltype string) bool {
+	coltype = strings.ToLower(coltype)
+	return strings.Contains(coltype, "date") || strings.Contains(coltype, "time")
+}
+
+// Converts a date column stored as RFC1123 strings into a DATETIME column.
+//
+// Dates are parsed and copied into a new column, which then replaces
+// the old one. Empty or malformed dates are set to NULL.
+func migrateDateColumn(db execer, dialect, name, coltype string) (err error) {
+	var rows *sql.Rows
+	var id, date string
+	var t time.Time
+
+	log.Print(fmt.Sprintf("Converting database column %s to %s", name, coltype))
+
+	dates := make(map[string]time.Time)
+	if rows, err = db.Query("SELECT id, " + quoteColumn(dialect, name) + " FROM analysis"); err != nil {
+		return
+	}
+	for rows.Next() {
+		var d sql.NullString
+		if err = rows.Scan(&id, &d); err != nil {
+			rows.Close()
+			return
+		}
+		date = d.String
+		if date == "" {
+			continue
+		}
+		// Dates were written in the local time zone of the server
+		if t, err = time.ParseInLocation(time.RFC1123, date, time.Local); err != nil {
+			log.Print(fmt.Sprintf("Analysis %s: malformed %s date %q, set to NULL", id, name, date))
+			continue
+		}
+		dates[id] = t
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return
+	}
+
+	tmp := name + "_new"
+	if _, err = db.Exec("ALTER TABLE analysis ADD COLUMN " + quoteColumn(dialect, tmp) + " " + coltype); err != nil {
+		return
+	}
+	query := "UPDATE analysis SET " + quoteColumn(dialect, tmp) + "=" + placeholder(dialect, 1) + " WHERE id=" + placeholder(dialect, 2)
+	for id, t = range dates {
+		if _, err = db.Exec(query, dbtime(t), id); err != nil {
+			return
+		}
+	}
+	if _, err = db.Exec("ALTER TABLE analysis DROP COLUMN " + quoteColumn(dialect, name)); err != nil {
+		return
+	}
+	return renameColumn(db, dialect, tmp, name, coltype)
+}
+
+// Renames the column of the analysis table, of type coltype
+func renameColumn(db execer, dialect, name, newname, coltype string) (err error) {
+	if dialect == DIALECT_MYSQL {
+		// RENAME COLUMN is not supported before mysql 8
+		_, err = db.Exec("ALTER TABLE analysis CHANGE " + quoteColumn(dialect, name) + " " + quoteColumn(dialect, newname) + " " + coltype)
+	} else {
+		_, err = db.Exec("ALTER TABLE analysis RENAME COLUMN " + quoteColumn(dialect, name) + " TO " + quoteColumn(dialect, newname))
+	}
+	return
+}
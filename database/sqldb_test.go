@@ -0,0 +1,97 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+package database
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/evolbioinfo/booster-web/model"
+)
+
+// An existing analysis is updated with all its fields
+func TestUpdateAnalysis(t *testing.T) {
+	for name, db := range testDatabases(t) {
+		a := model.NewAnalysis()
+		a.Id = "a1"
+		a.Status = model.STATUS_PENDING
+		a.StartPending = time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC)
+		if err := db.UpdateAnalysis(a); err != nil {
+			t.Fatal(err)
+		}
+
+		updated := &model.Analysis{
+			Id:            "a1",
+			RunName:       "run",
+			EMail:         "u1@example.org",
+			SeqAlign:      "/tmp/align.fa",
+			NbootRep:      100,
+			Alignfile:     ">A\nACGT\n",
+			AlignAlphabet: model.ALIGN_NUCLEOTIDS,
+			Workflow:      model.WORKFLOW_PHYML_SMS,
+			AlignNbSeq:    4,
+			AlignLength:   4,
+			InferenceParams: model.InferenceParams{
+				Criterion: "BIC",
+				Moves:     "NNI",
+				Model:     "GTR",
+				NoGamma:   true,
+			},
+			TBEParams: model.TBEParams{
+				TransferCutoff: 0.5,
+				NoRawTree:      true,
+				NoMovedTaxa:    true,
+			},
+			Reffile:       "/tmp/ref.nw",
+			Bootfile:      "/tmp/boot.nw",
+			FbpTree:       "(A,B,(C,D)0.9);",
+			TbeNormTree:   "(A,B,(C,D)0.95);",
+			TbeRawTree:    "(A,B,(C,D)1|0.05|2);",
+			TbeLogs:       "logs",
+			Status:        model.STATUS_FINISHED,
+			JobId:         "job",
+			GalaxyHistory: "history",
+			Message:       "message",
+			Nboot:         100,
+			StartPending:  a.StartPending,
+			StartRunning:  a.StartPending.Add(time.Minute),
+			End:           a.StartPending.Add(time.Hour),
+			Owner:         "u1",
+		}
+		if err := db.UpdateAnalysis(updated); err != nil {
+			t.Fatal(err)
+		}
+		got, err := db.GetAnalysis("a1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, d := range []*time.Time{&got.StartPending, &got.StartRunning, &got.End} {
+			*d = d.UTC()
+		}
+		if !reflect.DeepEqual(got, updated) {
+			t.Errorf("%s: expected\n%+v\ngot\n%+v", name, updated, got)
+		}
+	}
+}
@@ -0,0 +1,311 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+package database
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"database/sql"
+	"github.com/evolbioinfo/booster-web/model"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// SQLite database, stored in a single file.
+//
+// For small single node servers that do not want to
+// run a mysql server but want to keep their analyses
+type SQLiteBoosterwebDB struct {
+	file string
+	db   *sql.DB
+}
+
+/* Returns a new database */
+func NewSQLiteBoosterwebDB(file string) *SQLiteBoosterwebDB {
+	log.Print("New sqlite database")
+	return &SQLiteBoosterwebDB{
+		file,
+		nil,
+	}
+}
+
+func (db *SQLiteBoosterwebDB) Connect() error {
+	log.Print("Connect sqlite database: " + db.file)
+	d, err := sql.Open("sqlite3", "file:"+db.file+"?_busy_timeout=10000")
+	if err != nil {
+		log.Print(err)
+	} else {
+		// SQLite does not support concurrent writes:
+		// all requests go through a single connection
+		d.SetMaxOpenConns(1)
+		db.db = d
+	}
+	return err
+}
+
+func (db *SQLiteBoosterwebDB) Disconnect() error {
+	log.Print("Disconnect sqlite database")
+	if db.db == nil {
+		return errors.New("Database not opened")
+	}
+	return db.db.Close()
+}
+
+func (db *SQLiteBoosterwebDB) GetAnalysis(id string) (*model.Analysis, error) {
+	if db.db == nil {
+		return nil, errors.New("Database not opened")
+	}
+	return queryAnalysis(db.db, "SELECT "+analysisColumns+" FROM analysis WHERE id = ?", id)
+}
+
+// Returns the analysis without its alignment, result trees and logs
+func (db *SQLiteBoosterwebDB) GetAnalysisSummary(id string) (*model.Analysis, error) {
+	if db.db == nil {
+		return nil, errors.New("Database not opened")
+	}
+	return queryAnalysis(db.db, "SELECT "+analysisSummaryColumns+" FROM analysis WHERE id = ?", id)
+}
+
+// Get only analyses that are running (1) or pending (0)
+func (db *SQLiteBoosterwebDB) GetRunningAnalyses() (analyses []*model.Analysis, err error) {
+	if db.db == nil {
+		return nil, errors.New("Database not opened")
+	}
+	return queryAnalyses(db.db, "SELECT "+analysisColumns+" FROM analysis WHERE status=0 or status=1")
+}
+
+// Lists analyses, without their alignments, result trees and logs
+func (db *SQLiteBoosterwebDB) ListAnalyses(filter AnalysisFilter) (analyses []*model.Analysis, next string, err error) {
+	if db.db == nil {
+		return nil, "", errors.New("Database not opened")
+	}
+	return listAnalyses(db.db, DIALECT_SQLITE, filter)
+}
+
+/* Update an anlysis or insert it if it does not exist */
+func (db *SQLiteBoosterwebDB) UpdateAnalysis(a *model.Analysis) error {
+	if db.db == nil {
+		return errors.New("Database not opened")
+	}
+	query := `INSERT INTO analysis 
+                    (id, runname, email, seqalign, nbootrep, alignfile, alignalphabet,workflow, alignnbseq, alignlength, reffile, bootfile, fbptree,tbenormtree, tberawtree, tbelogs, status, jobid, galaxyhistory, message, nboot, startpending, startrunning , end, owner, criterion, moves, substmodel, nogamma, tbecutoff, norawtree, nomovedtaxa) 
+                  VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?) 
+                  ON CONFLICT(id) DO UPDATE SET runname=excluded.runname, alignfile=excluded.alignfile,alignalphabet=excluded.alignalphabet,fbptree=excluded.fbptree, 
+                                          tbenormtree=excluded.tbenormtree, tberawtree=excluded.tberawtree, tbelogs=excluded.tbelogs, 
+                                          status=excluded.status,jobid=excluded.jobid,galaxyhistory=excluded.galaxyhistory,workflow=excluded.workflow, 
+                                          alignnbseq=excluded.alignnbseq, alignLength=excluded.alignLength, message=excluded.message, nboot=excluded.nboot,
+                                          startpending=excluded.startpending, startrunning=excluded.startrunning, end=excluded.end,
+                                          owner=excluded.owner, criterion=excluded.criterion, moves=excluded.moves, substmodel=excluded.substmodel,
+                                          nogamma=excluded.nogamma, tbecutoff=excluded.tbecutoff, norawtree=excluded.norawtree, nomovedtaxa=excluded.nomovedtaxa,
+                                          email=excluded.email, seqalign=excluded.seqalign, nbootrep=excluded.nbootrep, reffile=excluded.reffile, bootfile=excluded.bootfile`
+	_, err := db.db.Exec(
+		query,
+		a.Id,
+		a.RunName,
+		a.EMail,
+		a.SeqAlign,
+		a.NbootRep,
+		a.Alignfile,
+		a.AlignAlphabet,
+		a.Workflow,
+		a.AlignNbSeq,
+		a.AlignLength,
+		a.Reffile,
+		a.Bootfile,
+		a.FbpTree,
+		a.TbeNormTree,
+		a.TbeRawTree,
+		a.TbeLogs,
+		a.Status,
+		a.JobId,
+		a.GalaxyHistory,
+		a.Message,
+		a.Nboot,
+		dbtime(a.StartPending),
+		dbtime(a.StartRunning),
+		dbtime(a.End),
+		a.Owner,
+		a.Criterion,
+		a.Moves,
+		a.Model,
+		a.NoGamma,
+		a.TransferCutoff,
+		a.NoRawTree,
+		a.NoMovedTaxa,
+	)
+	return err
+}
+
+func (db *SQLiteBoosterwebDB) UpdateProgress(id string, nboot int) error {
+	if db.db == nil {
+		return errors.New("Database not opened")
+	}
+	return updateProgress(db.db, DIALECT_SQLITE, id, nboot)
+}
+
+func (db *SQLiteBoosterwebDB) UpdateStatus(id string, status int, message string) error {
+	if db.db == nil {
+		return errors.New("Database not opened")
+	}
+	return updateStatus(db.db, DIALECT_SQLITE, id, status, message)
+}
+
+/* Check if table is present otherwise creates it */
+func (db *SQLiteBoosterwebDB) InitDatabase() (err error) {
+	log.Print("Initializing sqlite Database")
+	return db.Migrate()
+}
+
+/* Applies pending schema migrations */
+func (db *SQLiteBoosterwebDB) Migrate() error {
+	if db.db == nil {
+		return errors.New("Database not opened")
+	}
+	return migrate(db.db, DIALECT_SQLITE)
+}
+
+func (db *SQLiteBoosterwebDB) MigrationStatus() ([]MigrationStatus, error) {
+	if db.db == nil {
+		return nil, errors.New("Database not opened")
+	}
+	return migrationStatus(db.db, DIALECT_SQLITE)
+}
+
+// Will delete analyses older than d days, and returns their ids
+//
+// SQLite has no date type (dates are stored as text and parsed by
+// the driver), so end dates are compared here, and old analyses
+// are deleted one by one.
+func (db *SQLiteBoosterwebDB) DeleteOldAnalyses(days int) (old []string, err error) {
+	log.Print("SQLite database : Deleting old analyses")
+	if db.db == nil {
+		return nil, errors.New("Database not opened")
+	}
+
+	var rows *sql.Rows
+	var id string
+	var end sql.NullTime
+
+	if rows, err = db.db.Query("SELECT id, end FROM analysis WHERE status<>0 and status<>1 and status<>6"); err != nil {
+		return
+	}
+	limit := time.Now().AddDate(0, 0, -days)
+	for rows.Next() {
+		if err = rows.Scan(&id, &end); err != nil {
+			rows.Close()
+			return
+		}
+		if end.Valid && end.Time.Before(limit) {
+			old = append(old, id)
+		}
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return
+	}
+
+	err = deleteAnalyses(db.db, DIALECT_SQLITE, old)
+	return
+}
+
+func (db *SQLiteBoosterwebDB) GetUser(id string) (*model.User, error) {
+	if db.db == nil {
+		return nil, errors.New("Database not opened")
+	}
+	return queryUser(db.db, DIALECT_SQLITE, "id", id)
+}
+
+func (db *SQLiteBoosterwebDB) GetUserByLogin(login string) (*model.User, error) {
+	if db.db == nil {
+		return nil, errors.New("Database not opened")
+	}
+	return queryUser(db.db, DIALECT_SQLITE, "login", login)
+}
+
+func (db *SQLiteBoosterwebDB) GetUserBySubject(provider, subject string) (*model.User, error) {
+	if db.db == nil {
+		return nil, errors.New("Database not opened")
+	}
+	return queryUserBySubject(db.db, DIALECT_SQLITE, provider, subject)
+}
+
+func (db *SQLiteBoosterwebDB) ListUsers() ([]*model.User, error) {
+	if db.db == nil {
+		return nil, errors.New("Database not opened")
+	}
+	return queryUsers(db.db, "SELECT "+userColumns+" FROM users ORDER BY login")
+}
+
+/* Update a user or insert it if it does not exist */
+func (db *SQLiteBoosterwebDB) UpdateUser(u *model.User) error {
+	if db.db == nil {
+		return errors.New("Database not opened")
+	}
+	return updateUser(db.db, DIALECT_SQLITE, u)
+}
+
+func (db *SQLiteBoosterwebDB) DeleteUser(id string) error {
+	if db.db == nil {
+		return errors.New("Database not opened")
+	}
+	return deleteUser(db.db, DIALECT_SQLITE, id)
+}
+
+// Returns the api key having the given hash
+func (db *SQLiteBoosterwebDB) GetApiKey(hash string) (*model.ApiKey, error) {
+	if db.db == nil {
+		return nil, errors.New("Database not opened")
+	}
+	return getApiKey(db.db, DIALECT_SQLITE, hash)
+}
+
+func (db *SQLiteBoosterwebDB) ListApiKeys(userid string) ([]*model.ApiKey, error) {
+	if db.db == nil {
+		return nil, errors.New("Database not opened")
+	}
+	return listApiKeys(db.db, DIALECT_SQLITE, userid)
+}
+
+func (db *SQLiteBoosterwebDB) InsertApiKey(k *model.ApiKey) error {
+	if db.db == nil {
+		return errors.New("Database not opened")
+	}
+	return insertApiKey(db.db, DIALECT_SQLITE, k)
+}
+
+func (db *SQLiteBoosterwebDB) UpdateApiKeyUsage(id string, used time.Time) error {
+	if db.db == nil {
+		return errors.New("Database not opened")
+	}
+	return updateApiKeyUsage(db.db, DIALECT_SQLITE, id, used)
+}
+
+func (db *SQLiteBoosterwebDB) DeleteApiKey(id string) error {
+	if db.db == nil {
+		return errors.New("Database not opened")
+	}
+	return deleteApiKey(db.db, DIALECT_SQLITE, id)
+}
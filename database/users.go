@@ -0,0 +1,143 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+package database
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/evolbioinfo/booster-web/model"
+)
+
+var ErrUserNotFound = errors.New("User does not exist")
+
+// Row of the users table, shared by sql databases ("user" is a
+// reserved word in postgres)
+type dbuser struct {
+	id           string       // Id of the user
+	login        string       // Login of the user
+	passwordhash string       // bcrypt hash of the password
+	role         string       // admin or user
+	created      sql.NullTime // date of account creation
+	provider     string       // external provider of the user (ldap, oidc), empty for local accounts
+	subject      string       // id of the user at its provider
+}
+
+// Columns of the users table, in the order expected by scanUser
+const userColumns = "id,login,passwordhash,role,created,provider,subject"
+
+func scanUser(rows *sql.Rows) (u *model.User, err error) {
+	dbu := dbuser{}
+	if err = rows.Scan(&dbu.id, &dbu.login, &dbu.passwordhash, &dbu.role, &dbu.created, &dbu.provider, &dbu.subject); err != nil {
+		return
+	}
+	u = &model.User{
+		Id:           dbu.id,
+		Login:        dbu.login,
+		PasswordHash: dbu.passwordhash,
+		Role:         dbu.role,
+		Created:      dbu.created.Time,
+		Provider:     dbu.provider,
+		Subject:      dbu.subject,
+	}
+	return
+}
+
+// Selects the users returned by the given query and arguments
+func queryUsers(db *sql.DB, query string, args ...interface{}) (users []*model.User, err error) {
+	var rows *sql.Rows
+	var u *model.User
+
+	users = make([]*model.User, 0)
+	if rows, err = db.Query(query, args...); err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if u, err = scanUser(rows); err != nil {
+			return
+		}
+		users = append(users, u)
+	}
+	err = rows.Err()
+	return
+}
+
+// Selects the user whose column (id or login) has the given value
+func queryUser(db *sql.DB, dialect, column, value string) (u *model.User, err error) {
+	var users []*model.User
+	if users, err = queryUsers(db, "SELECT "+userColumns+" FROM users WHERE "+column+" = "+placeholder(dialect, 1), value); err != nil {
+		return
+	}
+	if len(users) == 0 {
+		return nil, ErrUserNotFound
+	}
+	return users[0], nil
+}
+
+// Selects the user authenticated by the external provider with the given subject
+func queryUserBySubject(db *sql.DB, dialect, provider, subject string) (u *model.User, err error) {
+	var users []*model.User
+	if provider == "" {
+		return nil, ErrUserNotFound
+	}
+	if users, err = queryUsers(db, "SELECT "+userColumns+" FROM users WHERE provider = "+placeholder(dialect, 1)+
+		" AND subject = "+placeholder(dialect, 2), provider, subject); err != nil {
+		return
+	}
+	if len(users) == 0 {
+		return nil, ErrUserNotFound
+	}
+	return users[0], nil
+}
+
+/* Updates a user or inserts it if it does not exist */
+func updateUser(db *sql.DB, dialect string, u *model.User) (err error) {
+	query := "INSERT INTO users (" + userColumns + ") VALUES (" +
+		placeholder(dialect, 1) + "," + placeholder(dialect, 2) + "," + placeholder(dialect, 3) + "," +
+		placeholder(dialect, 4) + "," + placeholder(dialect, 5) + "," + placeholder(dialect, 6) + "," +
+		placeholder(dialect, 7) + ") "
+	if dialect == DIALECT_MYSQL {
+		query += "ON DUPLICATE KEY UPDATE login=values(login), passwordhash=values(passwordhash), role=values(role), " +
+			"provider=values(provider), subject=values(subject)"
+	} else {
+		query += "ON CONFLICT (id) DO UPDATE SET login=EXCLUDED.login, passwordhash=EXCLUDED.passwordhash, role=EXCLUDED.role, " +
+			"provider=EXCLUDED.provider, subject=EXCLUDED.subject"
+	}
+	_, err = db.Exec(query, u.Id, u.Login, u.PasswordHash, u.Role, dbtime(u.Created), u.Provider, u.Subject)
+	return
+}
+
+func deleteUser(db *sql.DB, dialect, id string) (err error) {
+	var res sql.Result
+	var n int64
+	if res, err = db.Exec("DELETE FROM users WHERE id = "+placeholder(dialect, 1), id); err != nil {
+		return
+	}
+	if n, err = res.RowsAffected(); err == nil && n == 0 {
+		err = ErrUserNotFound
+	}
+	return
+}
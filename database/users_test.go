@@ -0,0 +1,75 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+package database
+
+import (
+	"testing"
+
+	"github.com/evolbioinfo/booster-web/model"
+)
+
+func TestUsers(t *testing.T) {
+	for name, db := range testDatabases(t) {
+		local, _ := model.NewUser("u1", "alice", model.ROLE_ADMIN)
+		external, _ := model.NewUser("u2", "bob", model.ROLE_USER)
+		external.Provider = model.PROVIDER_OIDC
+		external.Subject = "248289761001"
+		for _, u := range []*model.User{local, external} {
+			if err := db.UpdateUser(u); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if u, err := db.GetUserByLogin("bob"); err != nil || u.Id != "u2" || u.Provider != model.PROVIDER_OIDC || u.Subject != "248289761001" {
+			t.Errorf("%s: wrong user %+v (%v)", name, u, err)
+		}
+		if u, err := db.GetUserBySubject(model.PROVIDER_OIDC, "248289761001"); err != nil || u.Id != "u2" {
+			t.Errorf("%s: expected user u2, got %+v (%v)", name, u, err)
+		}
+		if _, err := db.GetUserBySubject(model.PROVIDER_LDAP, "248289761001"); err != ErrUserNotFound {
+			t.Errorf("%s: expected ErrUserNotFound for another provider, got %v", name, err)
+		}
+		// Local accounts have no subject
+		if _, err := db.GetUserBySubject("", ""); err != ErrUserNotFound {
+			t.Errorf("%s: expected ErrUserNotFound without provider, got %v", name, err)
+		}
+
+		// Updates keep the identity of the user
+		updated := *external
+		updated.Role = model.ROLE_ADMIN
+		if err := db.UpdateUser(&updated); err != nil {
+			t.Fatal(err)
+		}
+		if u, err := db.GetUser("u2"); err != nil || u.Role != model.ROLE_ADMIN || u.Subject != "248289761001" {
+			t.Errorf("%s: wrong updated user %+v (%v)", name, u, err)
+		}
+
+		if err := db.DeleteUser("u2"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.GetUser("u2"); err != ErrUserNotFound {
+			t.Errorf("%s: expected ErrUserNotFound, got %v", name, err)
+		}
+	}
+}
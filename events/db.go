@@ -0,0 +1,66 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+package events
+
+import (
+	"github.com/evolbioinfo/booster-web/database"
+	"github.com/evolbioinfo/booster-web/model"
+)
+
+// Database given to the processors: publishes the updates of
+// analyses on the bus, once they are saved.
+type PublishingDB struct {
+	database.BoosterwebDB
+	bus *Bus
+}
+
+func NewPublishingDB(db database.BoosterwebDB, bus *Bus) *PublishingDB {
+	return &PublishingDB{BoosterwebDB: db, bus: bus}
+}
+
+func (db *PublishingDB) UpdateAnalysis(a *model.Analysis) (err error) {
+	if err = db.BoosterwebDB.UpdateAnalysis(a); err == nil {
+		db.bus.Publish(NewStatusEvent(a))
+	}
+	return
+}
+
+func (db *PublishingDB) UpdateProgress(id string, nboot int) (err error) {
+	if err = db.BoosterwebDB.UpdateProgress(id, nboot); err == nil {
+		db.bus.Publish(Event{Type: EVENT_PROGRESS, Id: id, Nboot: nboot})
+	}
+	return
+}
+
+func (db *PublishingDB) UpdateStatus(id string, status int, message string) (err error) {
+	if err = db.BoosterwebDB.UpdateStatus(id, status, message); err == nil {
+		a := model.NewAnalysis()
+		a.Id = id
+		a.Status = status
+		a.Message = message
+		a.Nboot = -1
+		db.bus.Publish(NewStatusEvent(a))
+	}
+	return
+}
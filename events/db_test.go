@@ -0,0 +1,81 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+package events
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/evolbioinfo/booster-web/database"
+	"github.com/evolbioinfo/booster-web/model"
+)
+
+func TestPublishingDB(t *testing.T) {
+	mem := database.NewMemoryBoosterWebDB()
+	if err := mem.InitDatabase(); err != nil {
+		t.Fatal(err)
+	}
+	a := model.NewAnalysis()
+	a.Id = "a"
+	if err := mem.UpdateAnalysis(a); err != nil {
+		t.Fatal(err)
+	}
+	running := model.NewAnalysis()
+	running.Id = "a"
+	running.Status = model.STATUS_RUNNING
+	running.Nboot = 3
+	running.Message = "Running"
+
+	for _, test := range []struct {
+		name     string
+		update   func(db *PublishingDB) error
+		expected []Event
+	}{
+		{"update analysis", func(db *PublishingDB) error { return db.UpdateAnalysis(running) },
+			[]Event{{Type: EVENT_STATUS, Id: "a", Status: model.STATUS_RUNNING, StatusStr: running.StatusStr(), Nboot: 3, Message: "Running"}}},
+		{"update progress", func(db *PublishingDB) error { return db.UpdateProgress("a", 5) },
+			[]Event{{Type: EVENT_PROGRESS, Id: "a", Nboot: 5}}},
+		{"update status", func(db *PublishingDB) error { return db.UpdateStatus("a", model.STATUS_FINISHED, "Done") },
+			[]Event{{Type: EVENT_STATUS, Id: "a", Status: model.STATUS_FINISHED, StatusStr: "Finished", Nboot: -1, Message: "Done"}}},
+		{"unknown analysis progress", func(db *PublishingDB) error { return db.UpdateProgress("unknown", 5) }, nil},
+		{"unknown analysis status", func(db *PublishingDB) error { return db.UpdateStatus("unknown", model.STATUS_ERROR, "") }, nil},
+	} {
+		bus := NewBus()
+		db := NewPublishingDB(mem, bus)
+		c, cancel := bus.Subscribe("a")
+		unknown, cancelUnknown := bus.Subscribe("unknown")
+		err := test.update(db)
+		if (err != nil) != (test.expected == nil) {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		}
+		if events := received(c); !reflect.DeepEqual(events, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, events)
+		}
+		if events := received(unknown); len(events) != 0 {
+			t.Errorf("%s: failed update should not be published, got %v", test.name, events)
+		}
+		cancel()
+		cancelUnknown()
+	}
+}
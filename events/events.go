@@ -0,0 +1,129 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+// This package encapsulates the in-process bus of analysis
+// events: changes of status, message and progress published
+// by the processors, and streamed to clients.
+package events
+
+import (
+	"sync"
+
+	"github.com/evolbioinfo/booster-web/model"
+)
+
+const (
+	EVENT_STATUS   = "status"   // Change of status or message of the analysis
+	EVENT_PROGRESS = "progress" // Number of bootstrap trees analyzed so far
+)
+
+// Event of an analysis. Nboot is -1 when it is not known by the
+// publisher (status updated alone)
+type Event struct {
+	Type      string `json:"-"`
+	Id        string `json:"id"`
+	Status    int    `json:"status"`
+	StatusStr string `json:"statusstr"`
+	Nboot     int    `json:"nboot"`
+	Message   string `json:"message"`
+}
+
+// Returns a status event with the current state of the analysis
+func NewStatusEvent(a *model.Analysis) Event {
+	return Event{
+		Type:      EVENT_STATUS,
+		Id:        a.Id,
+		Status:    a.Status,
+		StatusStr: a.StatusStr(),
+		Nboot:     a.Nboot,
+		Message:   a.Message,
+	}
+}
+
+// If no other event will follow (the analysis is over)
+func (e Event) Final() bool {
+	return e.Type == EVENT_STATUS && e.Status != model.STATUS_PENDING && e.Status != model.STATUS_RUNNING
+}
+
+// Dispatches the events of analyses to their subscribers.
+// Publishing never blocks on slow subscribers (see send).
+type Bus struct {
+	lock        sync.Mutex
+	subscribers map[string]map[chan Event]bool // Subscribers per analysis id
+}
+
+// Number of events kept for slow subscribers
+const subscriberBuffer = 16
+
+func NewBus() *Bus {
+	return &Bus{subscribers: make(map[string]map[chan Event]bool)}
+}
+
+// Subscribes to the events of the given analysis. cancel must be
+// called when events are no longer read.
+func (b *Bus) Subscribe(id string) (events <-chan Event, cancel func()) {
+	c := make(chan Event, subscriberBuffer)
+	b.lock.Lock()
+	if _, ok := b.subscribers[id]; !ok {
+		b.subscribers[id] = make(map[chan Event]bool)
+	}
+	b.subscribers[id][c] = true
+	b.lock.Unlock()
+
+	return c, func() {
+		b.lock.Lock()
+		defer b.lock.Unlock()
+		delete(b.subscribers[id], c)
+		if len(b.subscribers[id]) == 0 {
+			delete(b.subscribers, id)
+		}
+	}
+}
+
+func (b *Bus) Publish(e Event) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for c := range b.subscribers[e.Id] {
+		send(c, e)
+	}
+}
+
+// Sends the event without blocking. If the channel is full, progress
+// events are dropped (the next one will follow), and room is made for
+// status events by dropping the oldest event.
+func send(c chan Event, e Event) {
+	for {
+		select {
+		case c <- e:
+			return
+		default:
+		}
+		if e.Type == EVENT_PROGRESS {
+			return
+		}
+		select {
+		case <-c:
+		default:
+		}
+	}
+}
@@ -0,0 +1,108 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+package events
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/evolbioinfo/booster-web/model"
+)
+
+func TestBus(t *testing.T) {
+	b := NewBus()
+	a1, cancel1 := b.Subscribe("a")
+	a2, cancel2 := b.Subscribe("a")
+	other, cancelOther := b.Subscribe("b")
+	defer cancelOther()
+
+	b.Publish(progress("a", 1))
+	for name, c := range map[string]<-chan Event{"first": a1, "second": a2} {
+		if events := received(c); !reflect.DeepEqual(events, []Event{progress("a", 1)}) {
+			t.Errorf("%s subscriber: expected one progress event, got %v", name, events)
+		}
+	}
+	if events := received(other); len(events) != 0 {
+		t.Errorf("subscriber of another analysis: expected no event, got %v", events)
+	}
+
+	cancel1()
+	b.Publish(progress("a", 2))
+	if events := received(a1); len(events) != 0 {
+		t.Errorf("canceled subscriber: expected no event, got %v", events)
+	}
+	if events := received(a2); !reflect.DeepEqual(events, []Event{progress("a", 2)}) {
+		t.Errorf("remaining subscriber: expected one progress event, got %v", events)
+	}
+
+	cancel2()
+	if _, ok := b.subscribers["a"]; ok {
+		t.Error("analysis without subscriber should be removed from the bus")
+	}
+}
+
+// Slow subscribers miss progress events, but not status events
+func TestBusFullSubscriber(t *testing.T) {
+	b := NewBus()
+	c, cancel := b.Subscribe("a")
+	defer cancel()
+
+	for i := 0; i < subscriberBuffer+5; i++ {
+		b.Publish(progress("a", i))
+	}
+	b.Publish(status("a", model.STATUS_FINISHED))
+
+	events := received(c)
+	if len(events) != subscriberBuffer {
+		t.Fatalf("expected %d events, got %d", subscriberBuffer, len(events))
+	}
+	for i, e := range events[:subscriberBuffer-1] {
+		// The oldest progress event made room for the status event
+		if expected := progress("a", i+1); e != expected {
+			t.Errorf("event %d: expected %v, got %v", i, expected, e)
+		}
+	}
+	if last := events[subscriberBuffer-1]; last != status("a", model.STATUS_FINISHED) {
+		t.Errorf("expected the status event last, got %v", last)
+	}
+}
+
+func TestEventFinal(t *testing.T) {
+	for _, test := range []struct {
+		event Event
+		final bool
+	}{
+		{status("a", model.STATUS_PENDING), false},
+		{status("a", model.STATUS_RUNNING), false},
+		{status("a", model.STATUS_FINISHED), true},
+		{status("a", model.STATUS_ERROR), true},
+		{status("a", model.STATUS_CANCELED), true},
+		{status("a", model.STATUS_TIMEOUT), true},
+		{progress("a", 10), false},
+	} {
+		if final := test.event.Final(); final != test.final {
+			t.Errorf("%v: expected final=%t, got %t", test.event, test.final, final)
+		}
+	}
+}
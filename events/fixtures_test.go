@@ -0,0 +1,44 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+package events
+
+// Events waiting in the channel
+func received(c <-chan Event) (events []Event) {
+	for {
+		select {
+		case e := <-c:
+			events = append(events, e)
+		default:
+			return
+		}
+	}
+}
+
+func progress(id string, nboot int) Event {
+	return Event{Type: EVENT_PROGRESS, Id: id, Nboot: nboot}
+}
+
+func status(id string, status int) Event {
+	return Event{Type: EVENT_STATUS, Id: id, Status: status}
+}
@@ -5,6 +5,7 @@ go 1.16
 require (
 	github.com/ajstarks/svgo v0.0.0-20181006003313-6ce6a3bcf6cd // indirect
 	github.com/armon/go-radix v1.0.0 // indirect
+	github.com/coreos/go-oidc/v3 v3.6.0
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
 	github.com/elazarl/go-bindata-assetfs v1.0.0
 	github.com/evolbioinfo/goalign v0.3.2
@@ -13,18 +14,24 @@ require (
 	github.com/fredericlemoine/golaxy v0.1.0
 	github.com/fredericlemoine/gostats v0.1.1-0.20190718132557-e750742f8b05 // indirect
 	github.com/go-bindata/go-bindata v3.1.2+incompatible // indirect
+	github.com/go-ldap/ldap/v3 v3.4.6
 	github.com/go-sql-driver/mysql v1.3.0
 	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0 // indirect
 	github.com/jlaffaye/ftp v0.0.0-20190126081051-8019e6774408 // indirect
+	github.com/lib/pq v1.10.0
 	github.com/llgcode/draw2d v0.0.0-20180124133339-274031cf2abe // indirect
 	github.com/llgcode/ps v0.0.0-20210114104736-f4b0c5d1e02e // indirect
+	github.com/mattn/go-sqlite3 v1.14.15
 	github.com/nu7hatch/gouuid v0.0.0-20131221200532-179d4d0c4d8d
 	github.com/russross/blackfriday v1.5.2
 	github.com/spf13/afero v1.2.1 // indirect
 	github.com/spf13/cobra v0.0.5
 	github.com/spf13/jwalterweatherman v1.1.0 // indirect
 	github.com/spf13/viper v1.6.0
+	github.com/stretchr/objx v0.5.1 // indirect
+	github.com/stretchr/testify v1.8.2 // indirect
+	golang.org/x/crypto v0.14.0
 	golang.org/x/image v0.0.0-20190227222117-0694c2d4d067 // indirect
-	golang.org/x/sys v0.0.0-20190306220723-b294cbcfc56d // indirect
+	golang.org/x/oauth2 v0.6.0
 	gopkg.in/ini.v1 v1.62.0 // indirect
 )
@@ -45,7 +45,10 @@ func ExitWithMessage(err error) {
 
 func LogError(err error) {
 	_, fn, line, _ := runtime.Caller(1)
-	name := strings.Split(fn, "/booster-web/")[1]
+	name := fn
+	if i := strings.LastIndex(fn, "/booster-web/"); i >= 0 {
+		name = fn[i+len("/booster-web/"):]
+	}
 	log.Printf("[Error] in %s (line %d), message: %v\n", name, line, err)
 }
 func LogInfo(message string) {
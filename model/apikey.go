@@ -0,0 +1,72 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+package model
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+)
+
+const APIKEY_PREFIX = "bwk_"
+
+// Long-lived api key of a user, given in the "Authorization: ApiKey <key>"
+// header. Only the sha256 hash of the key is stored.
+type ApiKey struct {
+	Id       string    `json:"id"`
+	UserId   string    `json:"userid"`   // Id of the user owning the key
+	Name     string    `json:"name"`     // Name given at creation (ex: name of the pipeline)
+	Prefix   string    `json:"prefix"`   // First characters of the key, to recognize it
+	Hash     string    `json:"-"`        // Hex encoded sha256 hash of the key
+	Created  time.Time `json:"created"`  // Creation time
+	LastUsed time.Time `json:"lastused"` // Last use (zero if never used)
+}
+
+// Generates a new random api key of the user, and returns it with the
+// key itself, that is not kept and must be given to the user.
+func NewApiKey(id, userid, name string) (k *ApiKey, key string, err error) {
+	secret := make([]byte, 32)
+	if _, err = rand.Read(secret); err != nil {
+		return
+	}
+	key = APIKEY_PREFIX + base64.RawURLEncoding.EncodeToString(secret)
+	k = &ApiKey{
+		Id:      id,
+		UserId:  userid,
+		Name:    name,
+		Prefix:  key[:len(APIKEY_PREFIX)+6],
+		Hash:    HashApiKey(key),
+		Created: time.Now(),
+	}
+	return
+}
+
+// Keys are random and long enough for a fast hash: it allows
+// to find the key by its hash
+func HashApiKey(key string) string {
+	h := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(h[:])
+}
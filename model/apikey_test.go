@@ -0,0 +1,53 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewApiKey(t *testing.T) {
+	k, key, err := NewApiKey("id", "u1", "pipeline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(key, APIKEY_PREFIX) || !strings.HasPrefix(key, k.Prefix) || len(k.Prefix) != len(APIKEY_PREFIX)+6 {
+		t.Errorf("Wrong key %q or prefix %q", key, k.Prefix)
+	}
+	if k.Hash != HashApiKey(key) || strings.Contains(k.Hash, key) {
+		t.Errorf("Expected the hash of the key, got %q", k.Hash)
+	}
+	if k.UserId != "u1" || k.Name != "pipeline" || k.Created.IsZero() || !k.LastUsed.IsZero() {
+		t.Errorf("Wrong api key %+v", k)
+	}
+
+	_, key2, err := NewApiKey("id2", "u1", "pipeline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key2 == key {
+		t.Error("Two api keys are identical")
+	}
+}
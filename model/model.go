@@ -24,12 +24,14 @@ Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
 package model
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -46,9 +48,13 @@ const (
 	WORKFLOW_NIL       = -1
 	WORKFLOW_PHYML_SMS = 8
 	WORKFLOW_FASTTREE  = 9
+	WORKFLOW_IQTREE    = 10
+	WORKFLOW_RAXMLNG   = 11
 
 	ALIGN_AMINOACIDS = 0
 	ALIGN_NUCLEOTIDS = 1
+
+	TBE_TRANSFER_CUTOFF = 0.3 // Default transfer cutoff of the taxa transfer index
 )
 
 type Analysis struct {
@@ -65,20 +71,78 @@ type Analysis struct {
 	AlignNbSeq    int    `json:"nbseqs"`    // Number of sequences in the given alignment
 	AlignLength   int    `json:"length"`    // Length of the given alignment
 
-	Reffile       string `json:"reftreefile"`  // reftree original file path
-	Bootfile      string `json:"boottreefile"` // bootstrap original file path
-	FbpTree       string `json:"fbptree"`      // Tree with Fbp supports
-	TbeNormTree   string `json:"tbenormtree"`  // resulting newick tree with support
-	TbeRawTree    string `json:"tberawtree"`   // result tree with raw <id|avg_dist|depth> as branch names
-	TbeLogs       string `json:"tbelogs"`      // log file
-	Status        int    `json:"status"`       // status code of the analysis
-	JobId         string `json:jobid`          // Galaxy or Local JobId
-	GalaxyHistory string `json:galaxyhistory`  // Galaxy History
-	Message       string `json:"message"`      // error message if any
-	Nboot         int    `json:"nboot"`        // number of trees that have been processed
-	StartPending  string `json:"startpending"` // Analysis queue time
-	StartRunning  string `json:"startrunning"` // Analysis Start running time
-	End           string `json:"end"`          // Analysis End time
+	// Optional parameters of the tree inference
+	InferenceParams
+
+	// Parameters of the TBE computation
+	TBEParams
+
+	Reffile       string    `json:"reftreefile"`   // reftree original file path
+	Bootfile      string    `json:"boottreefile"`  // bootstrap original file path
+	FbpTree       string    `json:"fbptree"`       // Tree with Fbp supports
+	TbeNormTree   string    `json:"tbenormtree"`   // resulting newick tree with support
+	TbeRawTree    string    `json:"tberawtree"`    // result tree with raw <id|avg_dist|depth> as branch names
+	TbeLogs       string    `json:"tbelogs"`       // log file
+	Status        int       `json:"status"`        // status code of the analysis
+	JobId         string    `json:"jobid"`         // Galaxy or Local JobId
+	GalaxyHistory string    `json:"galaxyhistory"` // Galaxy History
+	Message       string    `json:"message"`       // error message if any
+	Nboot         int       `json:"nboot"`         // number of trees that have been processed
+	StartPending  time.Time `json:"startpending"`  // Analysis queue time (zero if not set)
+	StartRunning  time.Time `json:"startrunning"`  // Analysis Start running time (zero if not set)
+	End           time.Time `json:"end"`           // Analysis End time (zero if not set)
+	Owner         string    `json:"owner"`         // Id of the user who submitted the analysis (empty without authentication)
+}
+
+// Optional parameters of the tree inference, chosen by the user.
+// Empty values: defaults of the workflow. Supported parameters
+// and values depend on the workflow.
+type InferenceParams struct {
+	Criterion string `json:"criterion"` // Model selection criterion: AIC or BIC
+	Moves     string `json:"moves"`     // Tree search moves: NNI or SPR
+	Model     string `json:"model"`     // Substitution model (ex: GTR, LG)
+	NoGamma   bool   `json:"nogamma"`   // No Gamma distributed rates across sites
+}
+
+// Human readable parameters, "default" if none is given
+func (p InferenceParams) InferenceStr() string {
+	params := make([]string, 0)
+	if p.Criterion != "" {
+		params = append(params, "criterion="+p.Criterion)
+	}
+	if p.Moves != "" {
+		params = append(params, "moves="+p.Moves)
+	}
+	if p.Model != "" {
+		params = append(params, "model="+p.Model)
+	}
+	if p.NoGamma {
+		params = append(params, "no gamma")
+	}
+	if len(params) == 0 {
+		return "default"
+	}
+	return strings.Join(params, ", ")
+}
+
+// Parameters of the TBE computation, chosen by the user. The tree
+// with TBE normalized supports is always computed.
+type TBEParams struct {
+	TransferCutoff float64 `json:"transfercutoff"` // Max normalized transfer distance of the branches counted in the taxa transfer index, in ]0,1]
+	NoRawTree      bool    `json:"norawtree"`      // No tree with raw average transfer distances
+	NoMovedTaxa    bool    `json:"nomovedtaxa"`    // No taxa transfer indexes (TBE logs)
+}
+
+// Human readable parameters
+func (p TBEParams) TBEStr() string {
+	params := []string{fmt.Sprintf("transfer cutoff=%g", p.TransferCutoff)}
+	if p.NoRawTree {
+		params = append(params, "no raw tree")
+	}
+	if p.NoMovedTaxa {
+		params = append(params, "no moved taxa")
+	}
+	return strings.Join(params, ", ")
 }
 
 func NewAnalysis() (a *Analysis) {
@@ -100,13 +164,39 @@ func NewAnalysis() (a *Analysis) {
 		GalaxyHistory: "",
 		Message:       "",
 		Nboot:         0,
-		StartPending:  "",
-		StartRunning:  "",
-		End:           "",
+		StartPending:  time.Time{},
+		StartRunning:  time.Time{},
+		End:           time.Time{},
+		Owner:         "",
+		TBEParams:     TBEParams{TransferCutoff: TBE_TRANSFER_CUTOFF},
 	}
 	return
 }
 
+// Dates are exported in ISO-8601 (RFC3339) format,
+// and dates that are not set yet are exported as null
+func (a Analysis) MarshalJSON() ([]byte, error) {
+	type analysis Analysis
+	return json.Marshal(&struct {
+		analysis
+		StartPending *time.Time `json:"startpending"`
+		StartRunning *time.Time `json:"startrunning"`
+		End          *time.Time `json:"end"`
+	}{
+		analysis(a),
+		jsonDate(a.StartPending),
+		jsonDate(a.StartRunning),
+		jsonDate(a.End),
+	})
+}
+
+func jsonDate(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
 func (a *Analysis) StatusStr() (st string) {
 	switch a.Status {
 	case STATUS_NOT_EXISTS:
@@ -131,31 +221,6 @@ func (a *Analysis) StatusStr() (st string) {
 	return
 }
 
-func (a *Analysis) WorkflowStr() string {
-	switch a.Workflow {
-	case WORKFLOW_PHYML_SMS:
-		return "PhyML-SMS"
-	case WORKFLOW_FASTTREE:
-		return "FastTree"
-	case WORKFLOW_NIL:
-		return "Bootstrap alone"
-	default:
-		return "Unknown"
-	}
-}
-
-func WorkflowConst(workflow string) (w int, err error) {
-	switch workflow {
-	case "PhyML-SMS":
-		w = WORKFLOW_PHYML_SMS
-	case "FastTree":
-		w = WORKFLOW_FASTTREE
-	default:
-		err = errors.New(fmt.Sprintf("Phylogenetic workflow does not exist: %s", workflow))
-	}
-	return
-}
-
 func (a *Analysis) DelTemp() {
 	var dir string
 	if a.SeqAlign != "" {
@@ -185,48 +250,33 @@ func (a *Analysis) DelTemp() {
 }
 
 // Returns the run time of the analysis from the start pending time
-// If end date is not filled yet, takes now(). If some dates have
-// format issues: returns "?"
+// If end date is not filled yet, takes now(). If start date is not
+// filled: returns "?"
 func (a *Analysis) RunTime() string {
-	var start, end time.Time
-	var delta time.Duration
-	var err error
-
-	if start, err = time.Parse(time.RFC1123, a.StartPending); err != nil {
+	delta, err := a.RunTimeDuration()
+	if err != nil {
 		return "?"
 	}
-
-	if a.End == "" {
-		end = time.Now()
-	} else {
-		if end, err = time.Parse(time.RFC1123, a.End); err != nil {
-			return "?"
-		}
-	}
-
-	delta = end.Sub(start).Round(time.Second)
 	return delta.String()
 }
 
 // Returns the run time of the analysis from the start pending time
-// If end date is not filled yet, takes now(). If some dates have
-// format issues: returns "?"
+// If end date is not filled yet, takes now(). If start date is not
+// filled: returns an error
 func (a *Analysis) RunTimeDuration() (delta time.Duration, err error) {
-	var start, end time.Time
+	var end time.Time
 
-	if start, err = time.Parse(time.RFC1123, a.StartPending); err != nil {
+	if a.StartPending.IsZero() {
+		err = errors.New("Analysis has no submission date")
 		return
 	}
 
-	if a.End == "" {
+	end = a.End
+	if end.IsZero() {
 		end = time.Now()
-	} else {
-		if end, err = time.Parse(time.RFC1123, a.End); err != nil {
-			return
-		}
 	}
 
-	delta = end.Sub(start).Round(time.Second)
+	delta = end.Sub(a.StartPending).Round(time.Second)
 	return
 }
 
@@ -237,13 +287,12 @@ func (a *Analysis) RunTimeDuration() (delta time.Duration, err error) {
 func (a *Analysis) TimedOut(timeout time.Duration) (timedout bool, err error) {
 	timedout = true
 
-	var start, end time.Time
-	if start, err = time.Parse(time.RFC1123, a.StartPending); err != nil {
+	if a.StartPending.IsZero() {
+		err = errors.New("Analysis has no submission date")
 		return
 	}
-	end = time.Now()
 
-	timedout = timeout != 0 && end.After(start.Add(timeout))
+	timedout = timeout != 0 && time.Now().After(a.StartPending.Add(timeout))
 	return
 }
 
@@ -253,14 +302,34 @@ func (a *Analysis) TimedOut(timeout time.Duration) (timedout bool, err error) {
 func (a *Analysis) OlderThan(agelimit time.Duration) (old bool, err error) {
 	old = true
 
-	var end time.Time
-	if end, err = time.Parse(time.RFC1123, a.End); err != nil {
+	if a.End.IsZero() {
+		err = errors.New("Analysis has no end date")
 		return
 	}
-	old = agelimit != 0 && time.Now().After(end.Add(agelimit))
+	old = agelimit != 0 && time.Now().After(a.End.Add(agelimit))
 	return
 }
 
+// Dates formatted for display, empty if not set
+func (a *Analysis) StartPendingStr() string {
+	return dateStr(a.StartPending)
+}
+
+func (a *Analysis) StartRunningStr() string {
+	return dateStr(a.StartRunning)
+}
+
+func (a *Analysis) EndStr() string {
+	return dateStr(a.End)
+}
+
+func dateStr(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Local().Format(time.RFC1123)
+}
+
 func (a *Analysis) ReffileName() string {
 	return path.Base(a.Reffile)
 }
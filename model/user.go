@@ -0,0 +1,95 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	ROLE_ADMIN = "admin" // Sees and cancels all analyses
+	ROLE_USER  = "user"  // Sees and cancels only its own analyses
+)
+
+// External providers of user identities (local accounts have no provider)
+const (
+	PROVIDER_LDAP = "ldap"
+	PROVIDER_OIDC = "oidc"
+)
+
+// Account of a user, when authentication is activated
+type User struct {
+	Id           string    `json:"id"`
+	Login        string    `json:"login"`
+	PasswordHash string    `json:"-"`                  // bcrypt hash of the password
+	Role         string    `json:"role"`               // ROLE_ADMIN or ROLE_USER
+	Created      time.Time `json:"created"`            // Account creation time
+	Provider     string    `json:"provider,omitempty"` // PROVIDER_LDAP or PROVIDER_OIDC for external users, empty for local accounts
+	Subject      string    `json:"-"`                  // Stable id of the external user at its provider (LDAP dn, OpenID Connect sub)
+}
+
+func NewUser(id, login, role string) (u *User, err error) {
+	if login == "" {
+		return nil, errors.New("User login must not be empty")
+	}
+	if !ValidRole(role) {
+		return nil, errors.New(fmt.Sprintf("User role does not exist: %s", role))
+	}
+	u = &User{
+		Id:      id,
+		Login:   login,
+		Role:    role,
+		Created: time.Now(),
+	}
+	return
+}
+
+func ValidRole(role string) bool {
+	return role == ROLE_ADMIN || role == ROLE_USER
+}
+
+func (u *User) IsAdmin() bool {
+	return u.Role == ROLE_ADMIN
+}
+
+// Replaces the password hash by the bcrypt hash of password
+func (u *User) SetPassword(password string) (err error) {
+	var hash []byte
+	if password == "" {
+		return errors.New("Password must not be empty")
+	}
+	if hash, err = bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost); err != nil {
+		return
+	}
+	u.PasswordHash = string(hash)
+	return
+}
+
+func (u *User) CheckPassword(password string) bool {
+	return u.PasswordHash != "" && bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) == nil
+}
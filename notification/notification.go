@@ -29,6 +29,10 @@ import (
 	"fmt"
 	"net/smtp"
 	"regexp"
+	"strings"
+
+	"github.com/evolbioinfo/booster-web/model"
+	"github.com/evolbioinfo/booster-web/workflow"
 )
 
 var emailRegexp = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
@@ -67,21 +71,28 @@ func (n *NullNotifier) Notify(status string, analysisId string, runName string,
 	return
 }
 
-// Workflow may be FastTree or PhyML-SMS
-func (n *EmailNotifier) Notify(status string, analysisId string, runName string, workflow string, email string) (err error) {
+// Workflow is the name of the workflow of the analysis (ex: FastTree)
+func (n *EmailNotifier) Notify(status string, analysisId string, runName string, workflowname string, email string) (err error) {
 	// Connect to the remote SMTP server.
 	if email != "" && n.server != "" && n.user != "" && n.pass != "" && n.sender != "" && validateEmail(email) {
-		ref := "Lemoine, F., Domelevo-Entfellner, J.-B., Wilkinson, E., Correia, D., Davila Felipe, M., De Oliveira, T., Gascuel, O. (2018). Renewing Felsenstein's Phylogenetic Bootstrap in the Era of Big Data, Nature 556, 452-45."
-		jobstr := "Booster[1]"
-		if workflow == "PhyML-SMS" {
-			ref = "[1] Lefort, V., Longueville, J. E., & Gascuel, O. (2017). SMS: Smart Model Selection in PhyML. Molecular Biology and Evolution.\n[2] " + ref
-			jobstr = "PhyML-SMS[1]+Booster[2]"
-		} else if workflow == "FastTree" {
-			ref = "[1] Price, M. N., Dehal, P. S., & Arkin, A. P. (2009). FastTree: computing large minimum evolution trees with profiles instead of a distance matrix. Molecular biology and evolution, 26(7), 1641-1650.\n[2] " + ref
-			jobstr = "FastTree[1]+Booster[2]"
-		} else {
-			ref = "[1] " + ref
+		var citations []string
+		jobstr := ""
+		if wf, er := workflow.ByName(workflowname); er == nil {
+			// ex: IQ-TREE[1,2]+Booster[3]
+			citations = wf.Citations()
+			indexes := make([]string, len(citations))
+			for i := range citations {
+				indexes[i] = fmt.Sprintf("%d", i+1)
+			}
+			jobstr = workflowname + "[" + strings.Join(indexes, ",") + "]+"
+		}
+		citations = append(citations, model.CITATION_BOOSTER)
+		jobstr += fmt.Sprintf("Booster[%d]", len(citations))
+		refs := make([]string, len(citations))
+		for i, c := range citations {
+			refs[i] = fmt.Sprintf("[%d] %s", i+1, c)
 		}
+		ref := strings.Join(refs, "\n")
 
 		runnamestr := " "
 		if runName != "" {
@@ -0,0 +1,82 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+package processor
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/evolbioinfo/booster-web/database"
+	"github.com/evolbioinfo/booster-web/model"
+	"github.com/evolbioinfo/booster-web/notification"
+	"github.com/evolbioinfo/gotree/support"
+	"github.com/fredericlemoine/golaxy"
+)
+
+// Returns a new in memory database
+func newTestDB(t *testing.T) database.BoosterwebDB {
+	db := database.NewMemoryBoosterWebDB()
+	if err := db.InitDatabase(); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// Pending analysis, to launch
+func newQueuedAnalysis(id string) *model.Analysis {
+	a := model.NewAnalysis()
+	a.Id = id
+	a.Status = model.STATUS_PENDING
+	return a
+}
+
+// Local processor with a queue of 2 analyses, without runners
+func newTestLocalProcessor(t *testing.T) *LocalProcessor {
+	return &LocalProcessor{
+		db:          newTestDB(t),
+		notifier:    notification.NewNullNotifier(),
+		queue:       make(chan *model.Analysis, 2),
+		runningJobs: make(map[string]*model.Analysis),
+		supporters:  make(map[string]*support.Supporter),
+		inferences:  make(map[string]context.CancelFunc),
+		canceled:    make(map[string]bool),
+	}
+}
+
+// Galaxy processor with a queue of 2 analyses, connected to the given
+// Galaxy server, without launcher nor monitor
+func newTestGalaxyProcessor(t *testing.T, galaxy http.Handler) *GalaxyProcessor {
+	server := httptest.NewServer(galaxy)
+	t.Cleanup(server.Close)
+	return &GalaxyProcessor{
+		galaxy:      golaxy.NewGalaxy(server.URL, "key", true),
+		db:          newTestDB(t),
+		notifier:    notification.NewNullNotifier(),
+		queue:       make(chan *model.Analysis, 2),
+		runningJobs: make(map[string]*model.Analysis),
+		queuesize:   2,
+	}
+}
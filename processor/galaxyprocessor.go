@@ -33,10 +33,11 @@ import (
 	"sync"
 	"time"
 
+	"github.com/evolbioinfo/booster-web/artifact"
 	"github.com/evolbioinfo/booster-web/database"
 	"github.com/evolbioinfo/booster-web/model"
 	"github.com/evolbioinfo/booster-web/notification"
-	"github.com/evolbioinfo/goalign/align"
+	"github.com/evolbioinfo/booster-web/workflow"
 	"github.com/evolbioinfo/gotree/io/newick"
 	"github.com/evolbioinfo/gotree/tree"
 	"github.com/fredericlemoine/golaxy"
@@ -48,18 +49,19 @@ import (
 type GalaxyProcessor struct {
 	runningJobs map[string]*model.Analysis // All running jobs key:job id, value:Job
 
-	galaxy     *golaxy.Galaxy        // Connection to Galaxy
-	queue      chan *model.Analysis  // Queue of analyses
-	boosterid  string                // Galaxy ID of booster tool
-	phymlid    string                // Galaxy ID of phyml Workflow
-	fasttreeid string                // Galaxy ID of fasttree Workflow
-	db         database.BoosterwebDB // Connection to database to save results
-	notifier   notification.Notifier // For email notifications
-	lock       sync.RWMutex          // Lock to modify running jobs
-	timeout    int                   // Timeout in seconds: jobs are timedout after this time
-	memlimit   int                   // Memory limit for jobs in Bytes. If jobs are estimated to consume more, they are not launched
-	queuesize  int                   // Max queue size
-	stopping   bool                  // If the server is stopping
+	galaxy    *golaxy.Galaxy        // Connection to Galaxy
+	queue     chan *model.Analysis  // Queue of analyses
+	waiting   waitingList           // Analyses waiting in the queue
+	boosterid string                // Galaxy ID of booster tool
+	toolids   map[int]string        // Galaxy IDs of the workflow tools, key: workflow code
+	db        database.BoosterwebDB // Connection to database to save results
+	store     artifact.Store        // Store of result trees and logs, nil: kept in the database
+	notifier  notification.Notifier // For email notifications
+	lock      sync.RWMutex          // Lock to modify running jobs
+	timeout   int                   // Timeout in seconds: jobs are timedout after this time
+	memlimit  int                   // Memory limit for jobs in Bytes. If jobs are estimated to consume more, they are not launched
+	queuesize int                   // Max queue size
+	stopping  bool                  // If the server is stopping
 }
 
 // It will add the Analysis to the Queue and store it in the database
@@ -71,17 +73,21 @@ func (p *GalaxyProcessor) LaunchAnalysis(a *model.Analysis) (err error) {
 	if len(p.runningJobs) >= p.queuesize {
 		full = true
 	}
-	select {
-	case p.queue <- a: // Put a in the channel unless it is full
-	default:
-		full = true
+	if !full {
+		p.waiting.push(a)
+		select {
+		case p.queue <- a: // Put a in the channel unless it is full
+		default:
+			p.waiting.remove(a.Id)
+			full = true
+		}
 	}
 
 	if full {
 		log.Print("Queue is full, cancelling job " + a.Id)
 		//Channel full. Discarding value
 		a.Status = model.STATUS_CANCELED
-		a.End = time.Now().Format(time.RFC1123)
+		a.End = time.Now()
 		a.Message = "Computing queue is full, please try again in a few minutes"
 		/* Insert analysis */
 		err = p.db.UpdateAnalysis(a)
@@ -91,7 +97,10 @@ func (p *GalaxyProcessor) LaunchAnalysis(a *model.Analysis) (err error) {
 }
 
 // Initializes the Galaxy Processor
-func (p *GalaxyProcessor) InitProcessor(url, apikey, boosterid, phymlid, fasttreeid string, galaxyrequestattempts int, db database.BoosterwebDB, notifier notification.Notifier, queuesize, timeout, memlimit int) {
+//
+// toolids gives the galaxy ids of the workflow tools, by workflow code.
+// Workflows without tool id are not available.
+func (p *GalaxyProcessor) InitProcessor(url, apikey, boosterid string, toolids map[int]string, galaxyrequestattempts int, db database.BoosterwebDB, store artifact.Store, notifier notification.Notifier, queuesize, timeout, memlimit int) {
 
 	var tool golaxy.ToolInfo
 	var err error
@@ -99,12 +108,12 @@ func (p *GalaxyProcessor) InitProcessor(url, apikey, boosterid, phymlid, fasttre
 	p.stopping = false
 	p.notifier = notifier
 	p.db = db
+	p.store = store
 	p.runningJobs = make(map[string]*model.Analysis)
 	p.galaxy = golaxy.NewGalaxy(url, apikey, true)
 	p.galaxy.SetNbRequestAttempts(galaxyrequestattempts)
 	p.boosterid = boosterid
-	p.phymlid = phymlid
-	p.fasttreeid = fasttreeid
+	p.toolids = make(map[int]string)
 	p.timeout = timeout
 	p.memlimit = memlimit
 
@@ -130,21 +139,17 @@ func (p *GalaxyProcessor) InitProcessor(url, apikey, boosterid, phymlid, fasttre
 
 	log.Print(fmt.Sprintf("Booster galaxy tool id: %s", p.boosterid))
 
-	// Searches the PhyML-SMS workflow with given id (checks that it exists)
-	if tool, err = p.galaxy.GetToolById(phymlid); err != nil {
-		log.Fatal("Error while getting phyml workflow id: " + err.Error())
-	}
-	p.phymlid = tool.Id
-
-	log.Print(fmt.Sprintf("PhyML-SMS galaxy tool id: %s", p.phymlid))
-
-	// Searches the FastTree workflow with given id (checks that it exists)
-	if tool, err = p.galaxy.GetToolById(fasttreeid); err != nil {
-		log.Fatal("Error while getting fasttree workflow id: " + err.Error())
+	// Searches the workflow tools with given ids (checks that they exist)
+	for _, w := range workflow.All() {
+		if toolids[w.Id()] == "" {
+			continue
+		}
+		if tool, err = p.galaxy.GetToolById(toolids[w.Id()]); err != nil {
+			log.Fatal("Error while getting " + w.Name() + " workflow id: " + err.Error())
+		}
+		p.toolids[w.Id()] = tool.Id
+		log.Print(fmt.Sprintf("%s galaxy tool id: %s", w.Name(), tool.Id))
 	}
-	p.fasttreeid = tool.Id
-
-	log.Print(fmt.Sprintf("FastTree galaxy tool id: %s", p.fasttreeid))
 
 	p.queue = make(chan *model.Analysis, queuesize)
 
@@ -163,6 +168,9 @@ func (p *GalaxyProcessor) submitBooster(a *model.Analysis, reffileid, bootfileid
 	tl := p.galaxy.NewToolLauncher(a.GalaxyHistory, p.boosterid)
 	tl.AddFileInput("ref", reffileid, "hda")
 	tl.AddFileInput("boot", bootfileid, "hda")
+	for name, value := range galaxyTBEParameters(a) {
+		tl.AddParameter(name, value)
+	}
 
 	_, jobs, err = p.galaxy.LaunchTool(tl)
 	if err != nil {
@@ -181,6 +189,26 @@ func (p *GalaxyProcessor) submitBooster(a *model.Analysis, reffileid, bootfileid
 	return
 }
 
+// Parameters of the booster tool, that computes TBE. They are also
+// given to the workflow tools, that run booster on the inferred trees.
+// Only the parameters that differ from the defaults are given, so that
+// tools which do not declare the inputs dist_cutoff (float), raw_tree and
+// moved_taxa (booleans) still run analyses with default TBE parameters.
+// The normalized TBE tree is always computed.
+func galaxyTBEParameters(a *model.Analysis) map[string]string {
+	params := make(map[string]string)
+	if a.TransferCutoff != 0 && a.TransferCutoff != model.TBE_TRANSFER_CUTOFF {
+		params["dist_cutoff"] = fmt.Sprintf("%g", a.TransferCutoff)
+	}
+	if a.NoRawTree {
+		params["raw_tree"] = "false"
+	}
+	if a.NoMovedTaxa {
+		params["moved_taxa"] = "false"
+	}
+	return params
+}
+
 func (p *GalaxyProcessor) checkJob(a *model.Analysis) (state, fbptreeid, tbenormtreeid, tberawtreeid, tbelogid string, err error) {
 	var files map[string]string
 	var fbptreename, tbenormtreename, tberawtreename, tbelogname string
@@ -194,14 +222,14 @@ func (p *GalaxyProcessor) checkJob(a *model.Analysis) (state, fbptreeid, tbenorm
 
 	// Now check status of galaxy job
 	if state, files, err = p.galaxy.CheckJob(a.JobId); err != nil {
-		log.Print("Error while checking " + a.WorkflowStr() + " workflow status : " + err.Error())
+		log.Print("Error while checking " + workflow.Name(a.Workflow) + " workflow status : " + err.Error())
 		return
 	}
 
-	if a.SeqAlign == "" {
-		fbptreename = "fbp_tree"
+	if w, ok := workflow.Get(a.Workflow); ok && a.SeqAlign != "" {
+		fbptreename = w.GalaxyFbpOutput()
 	} else {
-		fbptreename = "out_tree"
+		fbptreename = "fbp_tree"
 	}
 	tbenormtreename = "tbe_norm_tree"
 	tberawtreename = "tbe_raw_tree"
@@ -226,19 +254,20 @@ func (p *GalaxyProcessor) checkJob(a *model.Analysis) (state, fbptreeid, tbenorm
 			a.Message = err.Error()
 			state = "error"
 			a.Status = model.STATUS_ERROR
-		} else if tberawtreeid, ok = files[tberawtreename]; !ok {
+		} else if tberawtreeid, ok = files[tberawtreename]; !ok && !a.NoRawTree {
 			err = errors.New("Error while getting raw distance tree output file id of workflow" + a.Id)
 			log.Print(err.Error())
 			a.Message = err.Error()
 			state = "error"
 			a.Status = model.STATUS_ERROR
-		} else if tbelogid, ok = files[tbelogname]; !ok {
+		} else if tbelogid, ok = files[tbelogname]; !ok && !a.NoMovedTaxa {
 			err = errors.New("Error while getting tbe log file id workflow " + a.Id)
 			log.Print(err.Error())
 			a.Message = err.Error()
 			state = "error"
+			a.Status = model.STATUS_ERROR
 		}
-		a.End = time.Now().Format(time.RFC1123)
+		a.End = time.Now()
 	case "queued":
 		a.Status = model.STATUS_PENDING
 		a.Message = "queued"
@@ -247,8 +276,8 @@ func (p *GalaxyProcessor) checkJob(a *model.Analysis) (state, fbptreeid, tbenorm
 		a.Message = "waiting"
 	case "running":
 		a.Status = model.STATUS_RUNNING
-		if a.StartRunning == "" {
-			a.StartRunning = time.Now().Format(time.RFC1123)
+		if a.StartRunning.IsZero() {
+			a.StartRunning = time.Now()
 		}
 		a.Message = "running"
 	case "new":
@@ -264,64 +293,27 @@ func (p *GalaxyProcessor) checkJob(a *model.Analysis) (state, fbptreeid, tbenorm
 	return
 }
 
-func (p *GalaxyProcessor) submitPhyML(a *model.Analysis, alignfileid string) (err error) {
+// Launches the galaxy tool of the workflow on the uploaded alignment
+func (p *GalaxyProcessor) submitWorkflow(a *model.Analysis, w workflow.Workflow, alignfileid string) (err error) {
 	var jobs []string
+	var params map[string]string
 
-	tl := p.galaxy.NewToolLauncher(a.GalaxyHistory, p.phymlid)
-	tl.AddFileInput("input_align", alignfileid, "hda")
-
-	if a.AlignAlphabet == model.ALIGN_AMINOACIDS {
-		tl.AddParameter("sequence|seqtype", "aa")
-	} else if a.AlignAlphabet == model.ALIGN_NUCLEOTIDS {
-		tl.AddParameter("sequence|seqtype", "nt")
-	} else {
-		err = errors.New("Unkown sequence alphabet in alignment")
-		return
-	}
-	tl.AddParameter("stat_crit", "aic")
-	tl.AddParameter("move", "SPR")
-	tl.AddParameter("bootstrap|support", "boot")
-	tl.AddParameter("bootstrap|replicates", fmt.Sprintf("%d", a.NbootRep))
-
-	_, jobs, err = p.galaxy.LaunchTool(tl)
-	if err != nil {
-		log.Print("Error while launching PhyML-SMS: " + err.Error())
-		return
-	}
-
-	if len(jobs) != 1 {
-		log.Print("Galaxy Error: No jobs in the list")
-		err = errors.New("Galaxy error: No jobs in the list")
+	if params, err = w.GalaxyParameters(a); err != nil {
 		return
 	}
-	a.JobId = jobs[0]
-	p.db.UpdateAnalysis(a)
-	return
-}
 
-func (p *GalaxyProcessor) submitFastTree(a *model.Analysis, alignfileid string) (err error) {
-	var jobs []string
-
-	tl := p.galaxy.NewToolLauncher(a.GalaxyHistory, p.fasttreeid)
+	tl := p.galaxy.NewToolLauncher(a.GalaxyHistory, p.toolids[w.Id()])
 	tl.AddFileInput("input_align", alignfileid, "hda")
-
-	if a.AlignAlphabet == model.ALIGN_AMINOACIDS {
-		tl.AddParameter("sequence_type|seqtype", "")
-	} else if a.AlignAlphabet == model.ALIGN_NUCLEOTIDS {
-		tl.AddParameter("sequence_type|seqtype", "-nt")
-	} else {
-		err = errors.New("Unkown sequence alphabet in alignment")
-		return
+	for name, value := range params {
+		tl.AddParameter(name, value)
+	}
+	for name, value := range galaxyTBEParameters(a) {
+		tl.AddParameter(name, value)
 	}
-	tl.AddParameter("sequence_type|modelprot", "-lg")
-	tl.AddParameter("sequence_type|modeldna", "-gtr")
-	tl.AddParameter("gamma", "-gamma")
-	tl.AddParameter("bootstrap|do_bootstrap", "true")
-	tl.AddParameter("bootstrap|replicates", fmt.Sprintf("%d", a.NbootRep))
 
 	_, jobs, err = p.galaxy.LaunchTool(tl)
 	if err != nil {
-		log.Print("Error while launching booster: " + err.Error())
+		log.Print("Error while launching " + w.Name() + ": " + err.Error())
 		return
 	}
 
@@ -330,7 +322,6 @@ func (p *GalaxyProcessor) submitFastTree(a *model.Analysis, alignfileid string)
 		err = errors.New("Galaxy error: No jobs in the list")
 		return
 	}
-
 	a.JobId = jobs[0]
 	p.db.UpdateAnalysis(a)
 	return
@@ -359,7 +350,7 @@ func (p *GalaxyProcessor) submitToGalaxy(a *model.Analysis) (err error) {
 	p.db.UpdateAnalysis(a)
 
 	// If we have a sequence file, then we build the trees from it
-	// and compute supports using the PHYML-SMS oneclick workflow from galaxy
+	// and compute supports using the oneclick workflow tool from galaxy
 	if a.SeqAlign != "" {
 
 		if a.Workflow == model.WORKFLOW_NIL {
@@ -367,44 +358,29 @@ func (p *GalaxyProcessor) submitToGalaxy(a *model.Analysis) (err error) {
 			log.Print("Error while Uploading reference sequence file: " + err.Error())
 			return
 		}
-		boostermem, boostercpu := estimateBoosterRunStats(a)
-		if a.Workflow == model.WORKFLOW_PHYML_SMS {
-			if mem, cpu := estimatePhyMLRunStats(a); (p.memlimit > 0 && math.Max(mem, boostermem) > float64(p.memlimit)) || (p.timeout > 0 && cpu+boostercpu > float64(p.timeout)) {
-				err = errors.New("The given multiple alignment is too large to be analyzed online with PhyML-SMS, please consider using PhyML-SMS locally or using FastTree workflow")
-				log.Print(fmt.Sprintf("%s: Tree: mem=%.2f,cpu=%2f; Booster: mem=%.2f,cpu=%2f", err.Error(), mem, cpu, boostermem, boostercpu))
-				return
-			}
-
-			// The alignment was converted to phylip by server:newAnalysis function, now we upload it to history
-			if seqid, _, err = p.galaxy.UploadFile(history.Id, a.SeqAlign, "phylip"); err != nil {
-				log.Print("Error while Uploading reference sequence file: " + err.Error())
-				return
-			}
-			if err = p.submitPhyML(a, seqid); err != nil {
-				log.Print("Error while launching PhyML-SMS workflow : " + err.Error())
-				return
-			}
-		} else if a.Workflow == model.WORKFLOW_FASTTREE {
-			if mem, cpu := estimateFastTreeRunStats(a); (p.timeout > 0 && cpu+boostercpu > float64(p.timeout)) || (p.memlimit > 0 && math.Max(mem, boostermem) > float64(p.memlimit)) {
-				err = errors.New("The given multiple alignment is too large to be analyzed online with FastTree, please consider using FastTree locally")
-				log.Print(fmt.Sprintf("%s: Tree: mem=%.2f,cpu=%2f; Booster: mem=%.2f,cpu=%2f", err.Error(), mem, cpu, boostermem, boostercpu))
-				return
-			}
-
-			// We upload the ref fasta sequence file to history
-			if seqid, _, err = p.galaxy.UploadFile(history.Id, a.SeqAlign, "fasta"); err != nil {
-				log.Print("Error while Uploading reference sequence file: " + err.Error())
-				return
-			}
-			if err = p.submitFastTree(a, seqid); err != nil {
-				log.Print("Error while launching FastTree workflow : " + err.Error())
-				return
-			}
-		} else {
+		w, ok := workflow.Get(a.Workflow)
+		if !ok || p.toolids[a.Workflow] == "" {
 			err = errors.New("Error while launching workflow, unkown workflow")
 			log.Print(err.Error())
 			return
 		}
+
+		boostermem, boostercpu := estimateBoosterRunStats(a)
+		if mem, cpu := w.EstimateRunStats(a); (p.memlimit > 0 && math.Max(mem, boostermem) > float64(p.memlimit)) || (p.timeout > 0 && cpu+boostercpu > float64(p.timeout)) {
+			err = errors.New(fmt.Sprintf("The given multiple alignment is too large to be analyzed online with %s, please consider using %s locally or using a faster workflow", w.Name(), w.Name()))
+			log.Print(fmt.Sprintf("%s: Tree: mem=%.2f,cpu=%2f; Booster: mem=%.2f,cpu=%2f", err.Error(), mem, cpu, boostermem, boostercpu))
+			return
+		}
+
+		// The alignment was written in the input format of the workflow by server:newAnalysis function, now we upload it to history
+		if seqid, _, err = p.galaxy.UploadFile(history.Id, a.SeqAlign, w.InputFormat()); err != nil {
+			log.Print("Error while Uploading reference sequence file: " + err.Error())
+			return
+		}
+		if err = p.submitWorkflow(a, w, seqid); err != nil {
+			log.Print("Error while launching " + w.Name() + " workflow : " + err.Error())
+			return
+		}
 	} else if a.Reffile != "" && a.Bootfile != "" {
 		// Otherwise we upload the given ref and boot files
 		// We upload ref tree to history
@@ -443,18 +419,41 @@ func (p *GalaxyProcessor) newRunningJob(a *model.Analysis) {
 	p.runningJobs[a.Id] = a
 }
 
-func (p *GalaxyProcessor) rmRunningJob(a *model.Analysis) {
+// Takes the job out of the waiting list to submit it, and keeps track of
+// it as running under the same lock, so that CancelAnalysis always finds
+// it in one of them. Returns false if it has been canceled while in the queue.
+func (p *GalaxyProcessor) startJob(a *model.Analysis) bool {
 	p.lock.Lock()
 	defer p.lock.Unlock()
+
+	if _, ok := p.waiting.remove(a.Id); !ok {
+		return false
+	}
+	p.runningJobs[a.Id] = a
+	return true
+}
+
+// Returns false if the job was not running (already removed)
+func (p *GalaxyProcessor) rmRunningJob(a *model.Analysis) (removed bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if _, removed = p.runningJobs[a.Id]; !removed {
+		return
+	}
 	// we delete the history
 	if a.GalaxyHistory != "" {
 		p.galaxy.DeleteHistory(a.GalaxyHistory)
 	}
 	// And delete the job from the running jobs
 	delete(p.runningJobs, a.Id)
+	return
 }
 
-func (p *GalaxyProcessor) allRunningJobs() []*model.Analysis {
+func (p *GalaxyProcessor) QueuePosition(id string) (position int, queued bool) {
+	return p.waiting.position(id)
+}
+
+func (p *GalaxyProcessor) RunningAnalyses() []*model.Analysis {
 	p.lock.RLock()
 	defer p.lock.RUnlock()
 	v := make([]*model.Analysis, 0)
@@ -464,12 +463,66 @@ func (p *GalaxyProcessor) allRunningJobs() []*model.Analysis {
 	return v
 }
 
+func (p *GalaxyProcessor) Workflows() (workflows []int) {
+	workflows = make([]int, 0)
+	for _, w := range workflow.All() {
+		if p.toolids[w.Id()] != "" {
+			workflows = append(workflows, w.Id())
+		}
+	}
+	return
+}
+
+func (p *GalaxyProcessor) isRunningJob(id string) (ok bool) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	_, ok = p.runningJobs[id]
+	return
+}
+
+// Cancels the analysis with the given id.
+//
+// If it is waiting in the queue, it is removed from the queue. If it is
+// already submitted, its galaxy history is deleted, which stops the job.
+func (p *GalaxyProcessor) CancelAnalysis(id string) (err error) {
+	var a *model.Analysis
+	var queued, ok bool
+
+	// The launcher takes jobs out of the queue under the same lock
+	p.lock.Lock()
+	if a, queued = p.waiting.remove(id); !queued {
+		a, ok = p.runningJobs[id]
+	}
+	p.lock.Unlock()
+
+	if queued {
+		log.Print("Cancelling queued job : " + a.Id)
+	} else {
+		if !ok || !p.rmRunningJob(a) {
+			return ErrNotCancelable
+		}
+		log.Print("Cancelling running job : " + a.Id)
+	}
+
+	a.Status = model.STATUS_CANCELED
+	a.End = time.Now()
+	a.Message = "Canceled by user"
+	if err = p.db.UpdateAnalysis(a); err != nil {
+		return
+	}
+	a.DelTemp()
+	if err = p.notifier.Notify(a.StatusStr(), a.Id, a.RunName, workflow.Name(a.Workflow), a.EMail); err != nil {
+		log.Print(err)
+	}
+	return nil
+}
+
 func (p *GalaxyProcessor) CancelAnalyses() (err error) {
 	p.stopping = true
-	for _, a := range p.allRunningJobs() {
+	for _, a := range p.RunningAnalyses() {
 		log.Print("Cancelling job : " + a.Id)
 		a.Status = model.STATUS_CANCELED
-		a.End = time.Now().Format(time.RFC1123)
+		a.End = time.Now()
 		a.Message = "Canceled after a server restart"
 		if err = p.db.UpdateAnalysis(a); err != nil {
 			log.Print(err)
@@ -487,15 +540,32 @@ func (p *GalaxyProcessor) initJobLauncher() {
 			if p.stopping {
 				break
 			}
+			if !p.startJob(a) {
+				// Analysis has been canceled while in the queue
+				continue
+			}
 			log.Print(fmt.Sprintf("New analysis : id=%s", a.Id))
 			err := p.submitToGalaxy(a)
-			p.newRunningJob(a)
+			if !p.isRunningJob(a.Id) {
+				// Analysis has been canceled while being submitted:
+				// its history may have been created in the meantime
+				if a.GalaxyHistory != "" {
+					p.galaxy.DeleteHistory(a.GalaxyHistory)
+				}
+				if err = p.db.UpdateAnalysis(a); err != nil {
+					log.Print("Problem updating job: " + err.Error())
+				}
+				continue
+			}
 			if err != nil {
 				log.Print("Error while submitting to galaxy: " + err.Error())
+				if !p.rmRunningJob(a) {
+					// Canceled in the meantime
+					continue
+				}
 				a.Status = model.STATUS_ERROR
-				a.End = time.Now().Format(time.RFC1123)
+				a.End = time.Now()
 				a.Message = err.Error()
-				p.rmRunningJob(a)
 				if err = p.db.UpdateAnalysis(a); err != nil {
 					log.Print("Problem updating job: " + err.Error())
 				}
@@ -510,12 +580,25 @@ func (p *GalaxyProcessor) initJobMonitor() {
 		var state, fbptreeid, tbenormtreeid, tberawtreeid, tbelogid string
 		var err error
 		for !p.stopping {
-			for _, job := range p.allRunningJobs() {
+			for _, job := range p.RunningAnalyses() {
+				if !p.isRunningJob(job.Id) {
+					// Job has been canceled in the meantime
+					continue
+				}
+				if job.JobId == "" {
+					// Job is being submitted
+					continue
+				}
+				started := job.StartRunning
 				state, fbptreeid, tbenormtreeid, tberawtreeid, tbelogid, err = p.checkJob(job)
+				removed := false
 
 				if state == "error" || job.Status == model.STATUS_ERROR {
-					p.rmRunningJob(job)
-					if err = p.notifier.Notify(job.StatusStr(), job.Id, job.RunName, job.WorkflowStr(), job.EMail); err != nil {
+					if removed = p.rmRunningJob(job); !removed {
+						// Job has been canceled while being checked
+						continue
+					}
+					if err = p.notifier.Notify(job.StatusStr(), job.Id, job.RunName, workflow.Name(job.Workflow), job.EMail); err != nil {
 						log.Print(err)
 					}
 				} else if state == "ok" {
@@ -527,8 +610,11 @@ func (p *GalaxyProcessor) initJobMonitor() {
 						job.Status = model.STATUS_FINISHED
 						log.Print(fmt.Sprintf("Job %s finished successfully", job.Id))
 					}
-					p.rmRunningJob(job)
-					if err = p.notifier.Notify(job.StatusStr(), job.Id, job.RunName, job.WorkflowStr(), job.EMail); err != nil {
+					if removed = p.rmRunningJob(job); !removed {
+						// Job has been canceled while being checked
+						continue
+					}
+					if err = p.notifier.Notify(job.StatusStr(), job.Id, job.RunName, workflow.Name(job.Workflow), job.EMail); err != nil {
 						log.Print(err)
 					}
 				} else if t, _ := job.TimedOut(time.Duration(p.timeout) * time.Second); t {
@@ -536,8 +622,11 @@ func (p *GalaxyProcessor) initJobMonitor() {
 					job.Status = model.STATUS_TIMEOUT
 					job.Message = "Time out: Job canceled"
 					log.Print(fmt.Sprintf("Job %s timedout", job.Id))
-					p.rmRunningJob(job)
-					if err = p.notifier.Notify(job.StatusStr(), job.Id, job.RunName, job.WorkflowStr(), job.EMail); err != nil {
+					if removed = p.rmRunningJob(job); !removed {
+						// Job has been canceled while being checked
+						continue
+					}
+					if err = p.notifier.Notify(job.StatusStr(), job.Id, job.RunName, workflow.Name(job.Workflow), job.EMail); err != nil {
 						log.Print(err)
 					}
 				} else if err != nil {
@@ -546,7 +635,18 @@ func (p *GalaxyProcessor) initJobMonitor() {
 					continue
 				}
 
-				if err = p.db.UpdateAnalysis(job); err != nil {
+				if !removed && !p.isRunningJob(job.Id) {
+					// Job has been canceled while being checked
+					continue
+				}
+
+				if !removed && job.StartRunning.Equal(started) {
+					// Job is still running: only its status may have changed
+					err = p.db.UpdateStatus(job.Id, job.Status, job.Message)
+				} else {
+					err = p.db.UpdateAnalysis(job)
+				}
+				if err != nil {
 					log.Print(fmt.Sprintf("Problem updating job %s: %s", job.Id, err.Error()))
 				}
 				time.Sleep(1 * time.Second)
@@ -575,51 +675,54 @@ func (p *GalaxyProcessor) downloadResults(a *model.Analysis, fbptreeid, tbenormt
 	if outcontent, err = p.galaxy.DownloadFile(a.GalaxyHistory, fbptreeid); err != nil {
 		log.Print("Error while downloading fbp tree file: " + err.Error())
 	}
-	a.FbpTree = string(outcontent)
+	fbptree := string(outcontent)
 
-	// We scale branch supports from [0,nbootrep] to [0,1] for phyml
-	if a.Workflow == model.WORKFLOW_PHYML_SMS {
+	// We scale branch supports to [0,1] (ex: from [0,nbootrep] for phyml)
+	if w, ok := workflow.Get(a.Workflow); ok && w.GalaxyFbpScale(a) != 1.0 {
 		var t *tree.Tree
-		if t, err = newick.NewParser(strings.NewReader(a.FbpTree)).Parse(); err != nil {
-			log.Print("Error while scaling phyml branch supports to [0,1]: " + err.Error())
+		if t, err = newick.NewParser(strings.NewReader(fbptree)).Parse(); err != nil {
+			log.Print("Error while scaling " + w.Name() + " branch supports to [0,1]: " + err.Error())
 			return
 		} else {
-			t.ScaleSupports(1.0 / float64(a.NbootRep))
-			a.FbpTree = t.Newick()
+			t.ScaleSupports(w.GalaxyFbpScale(a))
+			fbptree = t.Newick()
 		}
 	}
+	if err = artifact.Save(p.store, a, artifact.FBP_TREE, fbptree); err != nil {
+		log.Print("Error while storing fbp tree: " + err.Error())
+		return
+	}
 
 	if outcontent, err = p.galaxy.DownloadFile(a.GalaxyHistory, tbenormtreeid); err != nil {
 		log.Print("Error while downloading support file: " + err.Error())
 		return
 	}
-	a.TbeNormTree = string(outcontent)
-
-	if outcontent, err = p.galaxy.DownloadFile(a.GalaxyHistory, tberawtreeid); err != nil {
-		log.Print("Error while downloading avg dist tree file: " + err.Error())
+	if err = artifact.Save(p.store, a, artifact.TBE_NORM_TREE, string(outcontent)); err != nil {
+		log.Print("Error while storing support tree: " + err.Error())
 		return
 	}
-	a.TbeRawTree = string(outcontent)
 
-	if outcontent, err = p.galaxy.DownloadFile(a.GalaxyHistory, tbelogid); err != nil {
-		log.Print("Error while downloading log file: " + err.Error())
-		return
+	// Raw tree and logs are not kept if the user did not ask for them
+	if !a.NoRawTree {
+		if outcontent, err = p.galaxy.DownloadFile(a.GalaxyHistory, tberawtreeid); err != nil {
+			log.Print("Error while downloading avg dist tree file: " + err.Error())
+			return
+		}
+		if err = artifact.Save(p.store, a, artifact.TBE_RAW_TREE, string(outcontent)); err != nil {
+			log.Print("Error while storing avg dist tree: " + err.Error())
+			return
+		}
 	}
-	a.TbeLogs = cleanTBELogs(string(outcontent))
-	return
-}
 
-func estimateFastTreeRunStats(a *model.Analysis) (mem, time float64) {
-	alphabetsize := 4.0
-	if a.AlignAlphabet == align.AMINOACIDS {
-		alphabetsize = 20.0
+	if !a.NoMovedTaxa {
+		if outcontent, err = p.galaxy.DownloadFile(a.GalaxyHistory, tbelogid); err != nil {
+			log.Print("Error while downloading log file: " + err.Error())
+			return
+		}
+		if err = artifact.Save(p.store, a, artifact.TBE_LOGS, cleanTBELogs(string(outcontent))); err != nil {
+			log.Print("Error while storing log file: " + err.Error())
+		}
 	}
-
-	time = 0.5071 +
-		0.00000006141*math.Pow(float64(a.AlignNbSeq), 1.5)*math.Log(float64(a.AlignNbSeq))*float64(a.AlignLength)*alphabetsize
-	mem = 2872 +
-		0.003412*(math.Pow(float64(a.AlignNbSeq), 1.5)+float64(a.AlignNbSeq)*float64(a.AlignLength)*alphabetsize)
-	time *= float64(a.NbootRep)
 	return
 }
 
@@ -633,28 +736,6 @@ func cleanTBELogs(log string) (cleanlog string) {
 	return
 }
 
-func estimatePhyMLRunStats(a *model.Analysis) (mem, time float64) {
-	alphabetweight := 0.0
-	if a.AlignAlphabet == align.AMINOACIDS {
-		alphabetweight = 1.1
-	}
-
-	time = 3.526 + 30.18*alphabetweight +
-		0.00002227*float64(a.AlignNbSeq*a.AlignNbSeq*a.AlignLength) +
-		0.00006672*alphabetweight*float64(a.AlignNbSeq*a.AlignNbSeq*a.AlignLength)
-	mem = 3352.7636 -
-		884.7005*alphabetweight +
-		158.6359*float64(a.AlignNbSeq) -
-		5.0467*float64(a.AlignLength) +
-		81.0603*float64(a.AlignNbSeq)*alphabetweight -
-		51.2838*float64(a.AlignLength)*alphabetweight +
-		0.3754*float64(a.AlignLength*a.AlignNbSeq) +
-		1.7922*float64(a.AlignLength*a.AlignNbSeq)*alphabetweight
-
-	time *= float64(a.NbootRep)
-	return
-}
-
 func estimateBoosterRunStats(a *model.Analysis) (mem, time float64) {
 	time = math.Pow(-1.370621+
 		0.002035*float64(a.AlignNbSeq), 2.0)
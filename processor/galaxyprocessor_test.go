@@ -0,0 +1,149 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+package processor
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/evolbioinfo/booster-web/model"
+)
+
+// Galaxy server answering the state and the outputs of any job
+func jobServer(state string, outputs ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		files := make(map[string]map[string]string)
+		for _, name := range outputs {
+			files[name] = map[string]string{"id": name + "_id", "src": "hda"}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": "job", "state": state, "outputs": files})
+	}
+}
+
+func TestGalaxyCheckJob(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		params  model.TBEParams
+		outputs []string
+		status  int
+	}{
+		{"all outputs", model.TBEParams{}, []string{"fbp_tree", "tbe_norm_tree", "tbe_raw_tree", "tbe_log"}, model.STATUS_FINISHED},
+		{"no raw tree", model.TBEParams{NoRawTree: true}, []string{"fbp_tree", "tbe_norm_tree", "tbe_log"}, model.STATUS_FINISHED},
+		{"no moved taxa", model.TBEParams{NoMovedTaxa: true}, []string{"fbp_tree", "tbe_norm_tree", "tbe_raw_tree"}, model.STATUS_FINISHED},
+		{"missing normalized tree", model.TBEParams{NoRawTree: true, NoMovedTaxa: true}, []string{"fbp_tree"}, model.STATUS_ERROR},
+		{"missing raw tree", model.TBEParams{}, []string{"fbp_tree", "tbe_norm_tree", "tbe_log"}, model.STATUS_ERROR},
+		{"missing logs", model.TBEParams{}, []string{"fbp_tree", "tbe_norm_tree", "tbe_raw_tree"}, model.STATUS_ERROR},
+	} {
+		p := newTestGalaxyProcessor(t, jobServer("ok", test.outputs...))
+		a := model.NewAnalysis()
+		a.JobId = "job"
+		a.TBEParams = test.params
+		state, _, _, _, _, err := p.checkJob(a)
+		if a.Status != test.status {
+			t.Errorf("%s: expected status %d, got %d (%v)", test.name, test.status, a.Status, err)
+		}
+		if test.status == model.STATUS_ERROR && (state != "error" || err == nil) {
+			t.Errorf("%s: expected an error state, got %q", test.name, state)
+		}
+	}
+}
+
+func TestGalaxyTBEParameters(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		params   model.TBEParams
+		expected map[string]string
+	}{
+		{"defaults", model.TBEParams{TransferCutoff: model.TBE_TRANSFER_CUTOFF}, map[string]string{}},
+		{"no cutoff", model.TBEParams{}, map[string]string{}},
+		{"cutoff", model.TBEParams{TransferCutoff: 0.25}, map[string]string{"dist_cutoff": "0.25"}},
+		{"no raw tree", model.TBEParams{TransferCutoff: model.TBE_TRANSFER_CUTOFF, NoRawTree: true}, map[string]string{"raw_tree": "false"}},
+		{"cutoff and no moved taxa", model.TBEParams{TransferCutoff: 0.25, NoMovedTaxa: true}, map[string]string{"dist_cutoff": "0.25", "moved_taxa": "false"}},
+	} {
+		a := model.NewAnalysis()
+		a.TBEParams = test.params
+		if params := galaxyTBEParameters(a); !reflect.DeepEqual(params, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, params)
+		}
+	}
+}
+
+// Analyses canceled while being submitted keep their canceled status,
+// and their history is deleted once created
+func TestGalaxyCancelSubmittingAnalysis(t *testing.T) {
+	creating := make(chan bool)
+	release := make(chan bool)
+	deleted := make(chan string, 1)
+	p := newTestGalaxyProcessor(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/api/histories":
+			creating <- true
+			<-release
+			json.NewEncoder(w).Encode(map[string]string{"id": "h1"})
+		case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/api/histories/"):
+			deleted <- strings.TrimPrefix(r.URL.Path, "/api/histories/")
+			json.NewEncoder(w).Encode(map[string]string{})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	p.initJobLauncher()
+	defer close(p.queue)
+
+	// The upload of the trees fails once the history is created
+	a := newQueuedAnalysis("a")
+	a.Reffile = filepath.Join(t.TempDir(), "missing_ref.nhx")
+	a.Bootfile = a.Reffile
+	if err := p.LaunchAnalysis(a); err != nil {
+		t.Fatal(err)
+	}
+	<-creating
+	if err := p.CancelAnalysis("a"); err != nil {
+		t.Fatalf("canceling an analysis being submitted: %v", err)
+	}
+	release <- true
+
+	select {
+	case id := <-deleted:
+		if id != "h1" {
+			t.Errorf("expected history h1 to be deleted, got %s", id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("history of the canceled analysis was not deleted")
+	}
+	// The launcher is done with a once it submits the next analysis
+	if err := p.LaunchAnalysis(newQueuedAnalysis("b")); err != nil {
+		t.Fatal(err)
+	}
+	<-creating
+	release <- true
+	if saved, err := p.db.GetAnalysis("a"); err != nil || saved.Status != model.STATUS_CANCELED {
+		t.Errorf("expected canceled status in database, got %v (%v)", saved, err)
+	}
+}
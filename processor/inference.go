@@ -0,0 +1,147 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/evolbioinfo/booster-web/model"
+	"github.com/evolbioinfo/booster-web/workflow"
+)
+
+// Names of the inferred trees, in the directory of the alignment
+const (
+	INFERRED_REFTREE  = "ref.nh"
+	INFERRED_BOOTTREE = "boot.nh"
+)
+
+// Infers the reference and bootstrap trees of the analysis from its alignment,
+// with the local executable of its workflow. They are written next to the
+// alignment, and set as Reffile and Bootfile of the analysis, so that
+// supports are then computed as for already inferred trees.
+//
+// Intermediate files of the tools are written in a temp directory
+// that is removed afterwards.
+func (p *LocalProcessor) inferTrees(ctx context.Context, a *model.Analysis, jobThreads int) (err error) {
+	var workdir string
+
+	w, ok := workflow.Get(a.Workflow)
+	if !ok || p.executables[a.Workflow] == "" {
+		return errors.New("Error while launching workflow, unkown workflow")
+	}
+
+	// The tools run in workdir: the alignment is given by its absolute path
+	if a.SeqAlign, err = filepath.Abs(a.SeqAlign); err != nil {
+		return
+	}
+	dir := filepath.Dir(a.SeqAlign)
+	if workdir, err = ioutil.TempDir(dir, "inference"); err != nil {
+		return
+	}
+	defer os.RemoveAll(workdir)
+
+	reffile := filepath.Join(dir, INFERRED_REFTREE)
+	bootfile := filepath.Join(dir, INFERRED_BOOTTREE)
+
+	r := &localRunner{p: p, a: a, executable: p.executables[a.Workflow], threads: jobThreads}
+	if err = w.Infer(ctx, r, a, workdir, reffile, bootfile); err != nil {
+		// Partial outputs, not removed by DelTemp
+		os.Remove(reffile)
+		os.Remove(bootfile)
+		return
+	}
+
+	a.Reffile = reffile
+	a.Bootfile = bootfile
+	a.Message = "Trees inferred, computing supports"
+	err = p.db.UpdateAnalysis(a)
+	return
+}
+
+// Runs the executable of the workflow of the analysis (workflow.Runner)
+type localRunner struct {
+	p          *LocalProcessor
+	a          *model.Analysis
+	executable string
+	threads    int
+}
+
+func (r *localRunner) Run(ctx context.Context, dir, out string, env []string, args ...string) error {
+	return runCommand(ctx, dir, out, env, r.executable, args...)
+}
+
+func (r *localRunner) SetMessage(message string) {
+	r.a.Message = message
+	r.p.db.UpdateStatus(r.a.Id, r.a.Status, r.a.Message)
+}
+
+func (r *localRunner) Threads() int {
+	return r.threads
+}
+
+// Runs the command in dir, and writes its standard output in the file
+// out (discarded if empty). The command is killed if ctx is canceled.
+//
+// Its standard error is written in a file of dir rather than in a pipe, so
+// that a killed command does not wait for its children. If it fails, the
+// error gives the last line of its standard error.
+func runCommand(ctx context.Context, dir, out string, env []string, name string, args ...string) (err error) {
+	var stderr, f *os.File
+	var log []byte
+
+	if stderr, err = ioutil.TempFile(dir, "stderr"); err != nil {
+		return
+	}
+	defer os.Remove(stderr.Name())
+	defer stderr.Close()
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stderr = stderr
+	if out != "" {
+		if f, err = os.Create(out); err != nil {
+			return
+		}
+		defer f.Close()
+		cmd.Stdout = f
+	}
+
+	if err = cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log, _ = ioutil.ReadFile(stderr.Name())
+		lines := strings.Split(strings.TrimSpace(string(log)), "\n")
+		err = fmt.Errorf("Error while running %s: %s (%s)", filepath.Base(name), err.Error(), lines[len(lines)-1])
+	}
+	return
+}
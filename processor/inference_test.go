@@ -0,0 +1,164 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+package processor
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/evolbioinfo/booster-web/database"
+	"github.com/evolbioinfo/booster-web/model"
+)
+
+// Writes an executable shell script standing for a tool
+func writeStub(t *testing.T, script string) string {
+	stub := filepath.Join(t.TempDir(), "stub")
+	if err := ioutil.WriteFile(stub, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return stub
+}
+
+// Analysis of an alignment given by a path relative to the current
+// directory, as with a relative runners.workdir
+func newInferenceAnalysis(t *testing.T, db database.BoosterwebDB) *model.Analysis {
+	dir := t.TempDir()
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(cwd) })
+
+	if err = os.MkdirAll(filepath.Join("work", "a1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	a := model.NewAnalysis()
+	a.Id = "a1"
+	a.Status = model.STATUS_RUNNING
+	a.Workflow = model.WORKFLOW_FASTTREE
+	a.AlignAlphabet = model.ALIGN_NUCLEOTIDS
+	a.NbootRep = 2
+	a.SeqAlign = filepath.Join("work", "a1", "align.fa")
+	if err = ioutil.WriteFile(a.SeqAlign, []byte(">A\nACGT\n>B\nACGA\n>C\nACTT\n>D\nTCTT\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.UpdateAnalysis(a); err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+// Local processor running FastTree analyses with the given executable
+func newInferenceProcessor(t *testing.T, executable string) *LocalProcessor {
+	p := newTestLocalProcessor(t)
+	p.executables = map[int]string{model.WORKFLOW_FASTTREE: executable}
+	return p
+}
+
+func TestInferTrees(t *testing.T) {
+	// The tool finds its input from its own directory
+	p := newInferenceProcessor(t, writeStub(t, `for last; do :; done
+if [ ! -f "$last" ]; then echo "$last: file not found" >&2; exit 1; fi
+echo "(A,B,(C,D));"
+`))
+	a := newInferenceAnalysis(t, p.db)
+	if err := p.inferTrees(context.Background(), a, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, _ := filepath.Abs(filepath.Join("work", "a1"))
+	if a.Reffile != filepath.Join(dir, INFERRED_REFTREE) || a.Bootfile != filepath.Join(dir, INFERRED_BOOTTREE) {
+		t.Errorf("Expected inferred trees in %s, got %s and %s", dir, a.Reffile, a.Bootfile)
+	}
+	for _, file := range []string{a.Reffile, a.Bootfile} {
+		if content, err := ioutil.ReadFile(file); err != nil || string(content) != "(A,B,(C,D));\n" {
+			t.Errorf("%s: expected the output of the tool, got %q (%v)", file, content, err)
+		}
+	}
+	// Intermediate files are removed
+	if files, _ := filepath.Glob(filepath.Join(dir, "inference*")); len(files) != 0 {
+		t.Errorf("Expected the work directory of the tool to be removed, got %v", files)
+	}
+	saved, err := p.db.GetAnalysis("a1")
+	if err != nil || saved.Reffile != a.Reffile || saved.Message != "Trees inferred, computing supports" {
+		t.Errorf("Expected the inferred trees in the database, got %+v (%v)", saved, err)
+	}
+}
+
+func TestInferTreesError(t *testing.T) {
+	p := newInferenceProcessor(t, writeStub(t, `echo "(A,B"
+echo "Reading alignment" >&2
+echo "Unknown model" >&2
+exit 2
+`))
+	a := newInferenceAnalysis(t, p.db)
+	err := p.inferTrees(context.Background(), a, 1)
+	if err == nil || !strings.Contains(err.Error(), "(Unknown model)") {
+		t.Errorf("Expected the last line of the standard error, got %v", err)
+	}
+	if _, err = os.Stat(filepath.Join("work", "a1", INFERRED_REFTREE)); !os.IsNotExist(err) {
+		t.Errorf("Expected the partial tree to be removed, got %v", err)
+	}
+	if a.Reffile != "" {
+		t.Errorf("Expected no reference tree, got %s", a.Reffile)
+	}
+
+	a.Workflow = model.WORKFLOW_IQTREE
+	if err = p.inferTrees(context.Background(), a, 1); err == nil {
+		t.Error("Expected an error for a workflow without executable")
+	}
+}
+
+func TestRunCommand(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out")
+	if err := runCommand(context.Background(), dir, out, []string{"NAME=value"}, "sh", "-c", `echo "$NAME $(pwd)"`); err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := ioutil.ReadFile(out); string(content) != "value "+dir+"\n" {
+		t.Errorf("Expected the output of the command run in %s, got %q", dir, content)
+	}
+	// The standard error file is removed
+	if files, _ := filepath.Glob(filepath.Join(dir, "stderr*")); len(files) != 0 {
+		t.Errorf("Expected no standard error file left, got %v", files)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := runCommand(ctx, dir, "", nil, "sleep", "10"); err != context.DeadlineExceeded {
+		t.Errorf("Expected the command to be killed, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("Command killed after %v", time.Since(start))
+	}
+}
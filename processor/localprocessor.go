@@ -25,20 +25,25 @@ package processor
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	goio "io"
 	"io/ioutil"
 	"log"
 	"os"
+	"os/exec"
 	"runtime"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/evolbioinfo/booster-web/artifact"
 	"github.com/evolbioinfo/booster-web/database"
 	"github.com/evolbioinfo/booster-web/io"
 	"github.com/evolbioinfo/booster-web/model"
 	"github.com/evolbioinfo/booster-web/notification"
+	"github.com/evolbioinfo/booster-web/workflow"
 	"github.com/evolbioinfo/gotree/io/utils"
 	"github.com/evolbioinfo/gotree/support"
 	"github.com/evolbioinfo/gotree/tree"
@@ -53,24 +58,37 @@ const (
 
 type LocalProcessor struct {
 	runningJobs map[string]*model.Analysis
-	queue       chan *model.Analysis // queue of analyses
+	supporters  map[string]*support.Supporter // Supporters of running jobs, to cancel them
+	inferences  map[string]context.CancelFunc // Stop the tree inference of running jobs
+	canceled    map[string]bool               // Running jobs canceled by the user
+	executables map[int]string                // Executables of the available workflows, key: workflow code
+	queue       chan *model.Analysis          // queue of analyses
+	waiting     waitingList                   // analyses waiting in the queue
 	db          database.BoosterwebDB
+	store       artifact.Store // Store of result trees and logs, nil: kept in the database
 	notifier    notification.Notifier
 	lock        sync.RWMutex
 }
 
 func (p *LocalProcessor) LaunchAnalysis(a *model.Analysis) (err error) {
-	if a.SeqAlign != "" {
-		err = errors.New("Local processor cannot infer trees, sequence alignment file won't be analyzed")
+	if a.SeqAlign != "" && !p.hasWorkflow(a.Workflow) {
+		err = errors.New("Local processor cannot infer trees with " + workflow.Name(a.Workflow) + ", sequence alignment file won't be analyzed")
 		a.DelTemp()
 		return
 	}
+	// The analysis is stored before being queued, in order
+	// to be restored if the server restarts before it is run
+	if err = p.db.UpdateAnalysis(a); err != nil {
+		return
+	}
+	p.waiting.push(a)
 	select {
 	case p.queue <- a: // Put a in the channel unless it is full
 	default:
 		//Channel full. Discarding value
+		p.waiting.remove(a.Id)
 		a.Status = model.STATUS_CANCELED
-		a.End = time.Now().Format(time.RFC1123)
+		a.End = time.Now()
 		a.Message = "Computing queue is full, please try again in a few minutes"
 		/* Insert analysis */
 		err = p.db.UpdateAnalysis(a)
@@ -79,12 +97,32 @@ func (p *LocalProcessor) LaunchAnalysis(a *model.Analysis) (err error) {
 	return
 }
 
-func (p *LocalProcessor) InitProcessor(nbrunners, queuesize, timeout, jobthreads int, db database.BoosterwebDB, notifier notification.Notifier) {
+// executables gives the executables used to infer trees from alignments,
+// by workflow code (ex: sms.sh for PhyML-SMS). Workflows without
+// executable are not available.
+func (p *LocalProcessor) InitProcessor(nbrunners, queuesize, timeout, jobthreads int, executables map[int]string, db database.BoosterwebDB, store artifact.Store, notifier notification.Notifier) {
 	var maxcpus int = runtime.NumCPU() // max number of cpus
+	var err error
 
 	p.db = db
+	p.store = store
 	p.notifier = notifier
 	p.runningJobs = make(map[string]*model.Analysis)
+	p.supporters = make(map[string]*support.Supporter)
+	p.inferences = make(map[string]context.CancelFunc)
+	p.canceled = make(map[string]bool)
+
+	p.executables = make(map[int]string)
+
+	// Checks that the executables exist
+	for _, w := range workflow.All() {
+		if executables[w.Id()] == "" {
+			continue
+		}
+		if p.executables[w.Id()], err = exec.LookPath(executables[w.Id()]); err != nil {
+			log.Fatal("Error while looking for " + w.Name() + " executable: " + err.Error())
+		}
+	}
 
 	if jobthreads == 0 {
 		jobthreads = RUNNERS_JOBTHREADS_DEFAULT
@@ -111,6 +149,9 @@ func (p *LocalProcessor) InitProcessor(nbrunners, queuesize, timeout, jobthreads
 	log.Print(fmt.Sprintf("Queue size: %d", queuesize))
 	log.Print(fmt.Sprintf("Job timeout: %ds", timeout))
 	log.Print(fmt.Sprintf("Job threads: %d", jobthreads))
+	for _, w := range workflow.All() {
+		log.Print(fmt.Sprintf("%s executable: %s", w.Name(), p.executables[w.Id()]))
+	}
 
 	p.queue = make(chan *model.Analysis, queuesize)
 
@@ -120,39 +161,53 @@ func (p *LocalProcessor) InitProcessor(nbrunners, queuesize, timeout, jobthreads
 
 			for a := range p.queue {
 				sup := support.NewSupporter()
+				ctx, stop := context.WithCancel(context.Background())
+				if !p.newRunningJob(a, sup, stop) {
+					// Analysis has been canceled while in the queue
+					stop()
+					continue
+				}
 				log.Print(fmt.Sprintf("CPU=%d | New analysis, id=%s", cpu, a.Id))
 
 				a.Status = model.STATUS_RUNNING
-				a.StartRunning = time.Now().Format(time.RFC1123)
+				a.StartRunning = time.Now()
 
 				finished := false
 				er := p.db.UpdateAnalysis(a)
 				if er != nil {
 					io.LogError(er)
+					p.rmRunningJob(a)
+					stop()
 					continue
 				}
-				p.newRunningJob(a)
 				var wg sync.WaitGroup // For waiting end of step computation
 				wg.Add(1)
 				go func() {
 					defer wg.Done()
 
 					var err error
-					if err = p.computeSupport(sup, a, jobthreads); err != nil {
+					// It may have been canceled since it left the queue
+					if err = ctx.Err(); err == nil {
+						err = p.runAnalysis(ctx, sup, a, jobthreads)
+					}
+					if err != nil {
 						io.LogError(err)
 						a.Message = err.Error()
 						a.Status = model.STATUS_ERROR
-						return
 					}
 
-					if err = p.db.UpdateAnalysis(a); err != nil {
-						io.LogError(er)
+					if p.rmRunningJob(a) {
+						a.Status = model.STATUS_CANCELED
+						a.End = time.Now()
+						a.Message = "Canceled by user"
 					}
 
-					p.rmRunningJob(a)
+					if err = p.db.UpdateAnalysis(a); err != nil {
+						io.LogError(err)
+					}
 
 					a.DelTemp()
-					if err = p.notifier.Notify(a.StatusStr(), a.Id, a.RunName, a.WorkflowStr(), a.EMail); err != nil {
+					if err = p.notifier.Notify(a.StatusStr(), a.Id, a.RunName, workflow.Name(a.Workflow), a.EMail); err != nil {
 						io.LogError(err)
 					}
 				}()
@@ -160,7 +215,9 @@ func (p *LocalProcessor) InitProcessor(nbrunners, queuesize, timeout, jobthreads
 				go func() {
 					for {
 						a.Nboot = sup.Progress()
-						p.db.UpdateAnalysis(a)
+						// Only the progress is written, so that results
+						// saved concurrently are not overwritten
+						p.db.UpdateProgress(a.Id, a.Nboot)
 						if finished {
 							break
 						}
@@ -173,38 +230,128 @@ func (p *LocalProcessor) InitProcessor(nbrunners, queuesize, timeout, jobthreads
 						time.Sleep(time.Duration(timeout) * time.Second)
 						if !finished {
 							sup.Cancel()
+							stop()
 						}
 					}()
 				}
 				wg.Wait()
 				a.Nboot = sup.Progress()
-				p.db.UpdateAnalysis(a)
+				p.db.UpdateProgress(a.Id, a.Nboot)
 				finished = true
+				stop()
 			}
 			log.Print(fmt.Sprintf("CPU %d : End", cpu))
 		}(cpu)
 	}
+
+	// We restore analyses that were pending or running
+	// when the server stopped
+	p.restoreJobs()
+}
+
+// Puts back in the queue the analyses that were pending in the database.
+//
+// Analyses that were running when the server stopped are restarted from the
+// beginning. If their input files do not exist anymore (not in a persistent
+// work directory), they are set in error.
+func (p *LocalProcessor) restoreJobs() {
+	an, err := p.db.GetRunningAnalyses()
+	if err != nil {
+		log.Print(err.Error())
+		return
+	}
+	// Analyses are queued in their submission order
+	sort.SliceStable(an, func(i, j int) bool {
+		return an[i].StartPending.Before(an[j].StartPending)
+	})
+
+	log.Print(fmt.Sprintf("Restoring %d local jobs", len(an)))
+	for _, a := range an {
+		if !inputsExist(a) {
+			log.Print("Input files of job " + a.Id + " do not exist anymore, cannot restore it")
+			a.Status = model.STATUS_ERROR
+			a.End = time.Now()
+			a.Message = "Input files lost after a server restart"
+			if err = p.db.UpdateAnalysis(a); err != nil {
+				log.Print(err)
+			}
+			continue
+		}
+		if a.Status == model.STATUS_RUNNING {
+			log.Print("Restarting job interrupted by a server restart : " + a.Id)
+			a.Status = model.STATUS_PENDING
+			a.StartRunning = time.Time{}
+			a.Nboot = 0
+			a.Message = "Restarted after a server restart"
+		}
+		if err = p.LaunchAnalysis(a); err != nil {
+			log.Print(err)
+			a.Status = model.STATUS_ERROR
+			a.End = time.Now()
+			a.Message = err.Error()
+			if err = p.db.UpdateAnalysis(a); err != nil {
+				log.Print(err)
+			}
+		}
+	}
+}
+
+// Trees inferred from an alignment before a restart are inferred again:
+// only the alignment is needed
+func inputsExist(a *model.Analysis) bool {
+	if a.SeqAlign != "" {
+		return fileExists(a.SeqAlign)
+	}
+	return fileExists(a.Reffile) && fileExists(a.Bootfile)
+}
+
+func fileExists(path string) bool {
+	if path == "" {
+		return false
+	}
+	_, err := os.Stat(path)
+	return err == nil
 }
 
 /**
 Keep a trace of currently running jobs
 In order to cancel them when the server stops
+
+The job leaves the waiting list under the same lock, so that
+CancelAnalysis always finds it in one of them. Returns false if
+it has been canceled while in the queue.
 */
-func (p *LocalProcessor) newRunningJob(a *model.Analysis) {
+func (p *LocalProcessor) newRunningJob(a *model.Analysis, sup *support.Supporter, stop context.CancelFunc) bool {
 	p.lock.Lock()
 	defer p.lock.Unlock()
 
+	if _, ok := p.waiting.remove(a.Id); !ok {
+		return false
+	}
 	p.runningJobs[a.Id] = a
+	p.supporters[a.Id] = sup
+	p.inferences[a.Id] = stop
+	return true
 }
 
-func (p *LocalProcessor) rmRunningJob(a *model.Analysis) {
+// Returns true if the job has been canceled by the user
+func (p *LocalProcessor) rmRunningJob(a *model.Analysis) (canceled bool) {
 	p.lock.Lock()
 	defer p.lock.Unlock()
 
+	canceled = p.canceled[a.Id]
 	delete(p.runningJobs, a.Id)
+	delete(p.supporters, a.Id)
+	delete(p.inferences, a.Id)
+	delete(p.canceled, a.Id)
+	return
+}
+
+func (p *LocalProcessor) QueuePosition(id string) (position int, queued bool) {
+	return p.waiting.position(id)
 }
 
-func (p *LocalProcessor) allRunningJobs() []*model.Analysis {
+func (p *LocalProcessor) RunningAnalyses() []*model.Analysis {
 	p.lock.RLock()
 	defer p.lock.RUnlock()
 	v := make([]*model.Analysis, 0)
@@ -214,11 +361,66 @@ func (p *LocalProcessor) allRunningJobs() []*model.Analysis {
 	return v
 }
 
+// Cancels the analysis with the given id.
+//
+// If it is waiting in the queue, it is removed from the queue. If it is running,
+// its computation is stopped, and the runner saves its canceled state.
+func (p *LocalProcessor) CancelAnalysis(id string) (err error) {
+	// The runners take analyses out of the queue under the same lock
+	p.lock.Lock()
+	a, queued := p.waiting.remove(id)
+	if !queued {
+		defer p.lock.Unlock()
+		sup, ok := p.supporters[id]
+		if !ok {
+			return ErrNotCancelable
+		}
+		log.Print("Cancelling running job : " + id)
+		p.canceled[id] = true
+		sup.Cancel()
+		p.inferences[id]()
+		return
+	}
+	p.lock.Unlock()
+
+	log.Print("Cancelling queued job : " + a.Id)
+	a.Status = model.STATUS_CANCELED
+	a.End = time.Now()
+	a.Message = "Canceled by user"
+	if err = p.db.UpdateAnalysis(a); err != nil {
+		return
+	}
+	a.DelTemp()
+	if err = p.notifier.Notify(a.StatusStr(), a.Id, a.RunName, workflow.Name(a.Workflow), a.EMail); err != nil {
+		io.LogError(err)
+	}
+	return nil
+}
+
+func (p *LocalProcessor) Workflows() (workflows []int) {
+	workflows = make([]int, 0)
+	for _, w := range workflow.All() {
+		if p.executables[w.Id()] != "" {
+			workflows = append(workflows, w.Id())
+		}
+	}
+	return
+}
+
+func (p *LocalProcessor) hasWorkflow(workflow int) bool {
+	for _, w := range p.Workflows() {
+		if w == workflow {
+			return true
+		}
+	}
+	return false
+}
+
 func (p *LocalProcessor) CancelAnalyses() (err error) {
-	for _, a := range p.allRunningJobs() {
+	for _, a := range p.RunningAnalyses() {
 		log.Print("Cancelling job : " + a.Id)
 		a.Status = model.STATUS_CANCELED
-		a.End = time.Now().Format(time.RFC1123)
+		a.End = time.Now()
 		a.Message = "Canceled after a server restart"
 		if err = p.db.UpdateAnalysis(a); err != nil {
 			log.Print(err)
@@ -227,6 +429,24 @@ func (p *LocalProcessor) CancelAnalyses() (err error) {
 	return
 }
 
+// Infers the reference and bootstrap trees if the analysis gives an
+// alignment, and then computes the supports
+func (p *LocalProcessor) runAnalysis(ctx context.Context, sup *support.Supporter, a *model.Analysis, jobThreads int) (err error) {
+	if a.SeqAlign != "" {
+		if err = p.inferTrees(ctx, a, jobThreads); err != nil {
+			if sup.Canceled() {
+				// Timeout or canceled by the user
+				a.Status = model.STATUS_TIMEOUT
+				a.End = time.Now()
+				a.Message = "Tree inference canceled during analysis"
+				err = nil
+			}
+			return
+		}
+	}
+	return p.computeSupport(sup, a, jobThreads)
+}
+
 func (p *LocalProcessor) computeSupport(sup *support.Supporter, a *model.Analysis, jobThreads int) (err error) {
 	var refTree *tree.Tree
 	var tmpFile *os.File
@@ -258,14 +478,17 @@ func (p *LocalProcessor) computeSupport(sup *support.Supporter, a *model.Analysi
 	}
 
 	err = support.FBP(refTree, treeChannel, jobThreads, sup)
-	a.End = time.Now().Format(time.RFC1123)
+	a.End = time.Now()
 	if err != nil {
 		io.LogError(err)
 		return
 	}
 
 	refTree.ClearPvalues()
-	a.FbpTree = refTree.Newick()
+	if err = artifact.Save(p.store, a, artifact.FBP_TREE, refTree.Newick()); err != nil {
+		io.LogError(err)
+		return
+	}
 	if sup.Canceled() {
 		a.Status = model.STATUS_TIMEOUT
 		a.Message = "FBP Canceled during analysis"
@@ -284,22 +507,36 @@ func (p *LocalProcessor) computeSupport(sup *support.Supporter, a *model.Analysi
 	treeChannel = utils.ReadMultiTrees(treeReader, utils.FORMAT_NEWICK)
 	var raw *tree.Tree
 	if raw, err = support.TBE(refTree, treeChannel, jobThreads,
-		true, true, true, 0.3, tmpFile, sup); err != nil {
+		!a.NoRawTree, !a.NoMovedTaxa, !a.NoMovedTaxa, a.TransferCutoff, tmpFile, sup); err != nil {
 		io.LogError(err)
 		return
 	}
 
 	// We  print the raw support tree first
-	a.TbeRawTree = raw.Newick()
+	if raw != nil {
+		if err = artifact.Save(p.store, a, artifact.TBE_RAW_TREE, raw.Newick()); err != nil {
+			io.LogError(err)
+			return
+		}
+	}
 
-	if dat, err = ioutil.ReadFile(tmpFile.Name()); err != nil {
+	// Logs only contain the taxa transfer indexes
+	if !a.NoMovedTaxa {
+		if dat, err = ioutil.ReadFile(tmpFile.Name()); err != nil {
+			io.LogError(err)
+			return
+		}
+
+		if err = artifact.Save(p.store, a, artifact.TBE_LOGS, cleanTBELogs(string(dat))); err != nil {
+			io.LogError(err)
+			return
+		}
+	}
+	if err = artifact.Save(p.store, a, artifact.TBE_NORM_TREE, refTree.Newick()); err != nil {
 		io.LogError(err)
 		return
 	}
 
-	a.TbeLogs = cleanTBELogs(string(dat))
-	a.TbeNormTree = refTree.Newick()
-
 	if sup.Canceled() {
 		a.Status = model.STATUS_TIMEOUT
 		a.Message = a.Message + ", TBE Canceled during analysis"
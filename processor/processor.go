@@ -24,10 +24,26 @@ Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
 package processor
 
 import (
+	"errors"
+
 	"github.com/evolbioinfo/booster-web/model"
 )
 
+// Returned by CancelAnalysis if the analysis is neither
+// pending nor running in the processor
+var ErrNotCancelable = errors.New("Analysis is not pending nor running, it can not be canceled")
+
 type Processor interface {
 	LaunchAnalysis(a *model.Analysis) error
+	// Cancels the pending or running analysis with the given id
+	CancelAnalysis(id string) error
 	CancelAnalyses() error
+	// Position (starting at 1) of the analysis in the queue of
+	// analyses waiting to be launched, false if it is not waiting
+	QueuePosition(id string) (position int, queued bool)
+	// Analyses currently running (or launched on galaxy)
+	RunningAnalyses() []*model.Analysis
+	// Phylogenetic workflows (model.WORKFLOW_*) that can infer
+	// trees from an alignment, none if only supports are computed
+	Workflows() []int
 }
@@ -0,0 +1,75 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+package processor
+
+import (
+	"sync"
+
+	"github.com/evolbioinfo/booster-web/model"
+)
+
+// Ordered list of the analyses waiting in a processor queue.
+//
+// Processor queues are channels, which can not be inspected
+// nor modified. This list keeps track of the analyses that
+// are still waiting, in order to cancel them before they
+// are taken by a runner.
+type waitingList struct {
+	lock     sync.RWMutex
+	analyses []*model.Analysis
+}
+
+func (l *waitingList) push(a *model.Analysis) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.analyses = append(l.analyses, a)
+}
+
+// Removes the analysis with the given id from the list.
+//
+// Returns false if the analysis was not in the list, i.e.
+// it was already removed (canceled) before.
+func (l *waitingList) remove(id string) (a *model.Analysis, ok bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	for i, w := range l.analyses {
+		if w.Id == id {
+			l.analyses = append(l.analyses[:i], l.analyses[i+1:]...)
+			return w, true
+		}
+	}
+	return nil, false
+}
+
+// Position of the analysis in the list, starting at 1.
+func (l *waitingList) position(id string) (pos int, ok bool) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	for i, w := range l.analyses {
+		if w.Id == id {
+			return i + 1, true
+		}
+	}
+	return 0, false
+}
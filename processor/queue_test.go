@@ -0,0 +1,133 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+package processor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/evolbioinfo/booster-web/model"
+	"github.com/evolbioinfo/gotree/support"
+)
+
+func TestWaitingList(t *testing.T) {
+	var l waitingList
+
+	for _, id := range []string{"a", "b", "c"} {
+		l.push(newQueuedAnalysis(id))
+	}
+	if pos, ok := l.position("c"); !ok || pos != 3 {
+		t.Errorf("position of c: expected 3, got %d (%t)", pos, ok)
+	}
+	if a, ok := l.remove("b"); !ok || a.Id != "b" {
+		t.Errorf("remove b: expected b, got %v (%t)", a, ok)
+	}
+	if _, ok := l.remove("b"); ok {
+		t.Error("b should not be removed twice")
+	}
+	if pos, ok := l.position("c"); !ok || pos != 2 {
+		t.Errorf("position of c after removing b: expected 2, got %d (%t)", pos, ok)
+	}
+	if _, ok := l.position("z"); ok {
+		t.Error("z should not be in the list")
+	}
+}
+
+// Queued analyses are canceled before being taken by a runner
+func TestLocalCancelQueuedAnalysis(t *testing.T) {
+	p := newTestLocalProcessor(t)
+	a, b, c := newQueuedAnalysis("a"), newQueuedAnalysis("b"), newQueuedAnalysis("c")
+	for _, an := range []*model.Analysis{a, b} {
+		if err := p.LaunchAnalysis(an); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The queue is full
+	if err := p.LaunchAnalysis(c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Status != model.STATUS_CANCELED {
+		t.Errorf("analysis launched in a full queue: expected status canceled, got %s", c.StatusStr())
+	}
+
+	if pos, ok := p.QueuePosition("b"); !ok || pos != 2 {
+		t.Errorf("queue position of b: expected 2, got %d (%t)", pos, ok)
+	}
+	if err := p.CancelAnalysis("a"); err != nil {
+		t.Fatal(err)
+	}
+	if saved, err := p.db.GetAnalysis("a"); err != nil || saved.Status != model.STATUS_CANCELED {
+		t.Errorf("canceled analysis: expected canceled status in database, got %v (%v)", saved, err)
+	}
+	if pos, ok := p.QueuePosition("b"); !ok || pos != 1 {
+		t.Errorf("queue position of b after cancel: expected 1, got %d (%t)", pos, ok)
+	}
+	if err := p.CancelAnalysis("a"); err != ErrNotCancelable {
+		t.Errorf("canceling twice: expected ErrNotCancelable, got %v", err)
+	}
+	if len(p.RunningAnalyses()) != 0 {
+		t.Errorf("no analysis should be running")
+	}
+}
+
+// Analyses canceled after being taken from the queue, but before running
+func TestLocalCancelStartingAnalysis(t *testing.T) {
+	p := newTestLocalProcessor(t)
+
+	// Canceled before the runner registers it
+	a := newQueuedAnalysis("a")
+	if err := p.LaunchAnalysis(a); err != nil {
+		t.Fatal(err)
+	}
+	<-p.queue
+	if err := p.CancelAnalysis("a"); err != nil {
+		t.Fatal(err)
+	}
+	_, stop := context.WithCancel(context.Background())
+	defer stop()
+	if p.newRunningJob(a, support.NewSupporter(), stop) {
+		t.Error("analysis canceled while taken from the queue should not be started")
+	}
+
+	// Canceled once registered, before its inference starts
+	b := newQueuedAnalysis("b")
+	if err := p.LaunchAnalysis(b); err != nil {
+		t.Fatal(err)
+	}
+	<-p.queue
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	if !p.newRunningJob(b, support.NewSupporter(), stop) {
+		t.Fatal("queued analysis should be started")
+	}
+	if err := p.CancelAnalysis("b"); err != nil {
+		t.Fatal(err)
+	}
+	if ctx.Err() == nil {
+		t.Error("inference context of the canceled analysis should be canceled")
+	}
+	if !p.rmRunningJob(b) {
+		t.Error("the runner should find the analysis canceled")
+	}
+}
@@ -0,0 +1,262 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	goio "io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/evolbioinfo/booster-web/artifact"
+	"github.com/evolbioinfo/booster-web/io"
+	"github.com/evolbioinfo/booster-web/model"
+	"github.com/evolbioinfo/booster-web/workflow"
+	"github.com/evolbioinfo/gotree/tree"
+)
+
+// Description of the analysis given in its result bundle (manifest.json)
+type BundleManifest struct {
+	Id        string   `json:"id"`
+	RunName   string   `json:"runname,omitempty"`
+	Status    string   `json:"status"`
+	Message   string   `json:"message,omitempty"`
+	Workflow  string   `json:"workflow"`
+	NbootRep  int      `json:"nbootrep,omitempty"`  // Number of bootstrap trees built by the workflow
+	Inference string   `json:"inference,omitempty"` // Parameters of the tree inference (ex: "criterion=BIC, moves=NNI")
+	TBE       string   `json:"tbe"`                 // Parameters of the TBE computation (ex: "transfer cutoff=0.3")
+	Alphabet  string   `json:"alphabet,omitempty"`  // Alphabet of the input alignment: nt or aa
+	NbSeqs    int      `json:"nbseqs,omitempty"`
+	Length    int      `json:"length,omitempty"`
+	Submitted string   `json:"submitted"`
+	Started   string   `json:"started,omitempty"`
+	Ended     string   `json:"ended,omitempty"`
+	RunTime   string   `json:"runtime"`
+	Files     []string `json:"files"` // Files of the bundle, in addition to manifest.json and README.txt
+	Citations []string `json:"citations"`
+}
+
+// Description of the files of the bundle, given in its README.txt
+var bundleFileDescriptions = map[string]string{
+	artifact.ALIGNMENT:     "Alignment built by the workflow",
+	artifact.FBP_TREE:      "Tree with FBP supports (newick)",
+	artifact.TBE_NORM_TREE: "Tree with TBE normalized supports (newick)",
+	artifact.TBE_RAW_TREE:  "Tree with TBE raw average transfer distances and branch ids: \"Branch ID|Average transfer Distance|Size of the light side\" (newick)",
+	artifact.TBE_LOGS:      "TBE logs: global and per branch taxa transfer scores",
+	MERGED_TREE:            "Tree with FBP, TBE normalized supports, average transfer distances, sizes of the light side and branch ids as NHX comments of its internal branches (newick)",
+}
+
+// Streams a zip of the results of the analysis: result trees, TBE logs,
+// input files that are still kept, and a manifest (manifest.json and
+// README.txt) giving its parameters, workflow, timings and citations.
+func apiAnalysisBundleHandler(w http.ResponseWriter, r *http.Request, id string) {
+	var a *model.Analysis
+	var err error
+
+	if r.Method != http.MethodGet {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Allow", http.MethodGet)
+		apiErrorStatus(w, http.StatusMethodNotAllowed, errors.New("Method not allowed: "+r.Method))
+		return
+	}
+	if a, err = getAnalysis(id); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		apiErrorStatus(w, http.StatusNotFound, err)
+		return
+	}
+	if a.Status == model.STATUS_PENDING || a.Status == model.STATUS_RUNNING {
+		w.Header().Set("Content-Type", "application/json")
+		apiErrorStatus(w, http.StatusConflict, errors.New("Analysis is not over"))
+		return
+	}
+
+	dir := "boosterweb_" + id + "/"
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", "attachment; filename=\"boosterweb_"+id+".zip\"")
+	zw := zip.NewWriter(w)
+	manifest := newBundleManifest(a)
+
+	// An error after the first file gives an incomplete zip: the
+	// response cannot be changed anymore, so it is only logged
+	for _, name := range artifact.Names {
+		var f goio.ReadCloser
+		if f, err = artifact.Open(store, a, name); err == artifact.ErrNotFound {
+			continue
+		} else if err != nil {
+			io.LogError(err)
+			return
+		}
+		err = addToZip(zw, dir+name, f)
+		f.Close()
+		if err != nil {
+			io.LogError(err)
+			return
+		}
+		manifest.Files = append(manifest.Files, name)
+	}
+
+	// Tree with all the supports, built from the result trees
+	if a.Status == model.STATUS_FINISHED {
+		var t *tree.Tree
+		var supports map[*tree.Edge]*branchSupports
+		if t, supports, err = mergedTree(a); err != nil {
+			io.LogError(err)
+		} else if err = addToZip(zw, dir+MERGED_TREE, strings.NewReader(writeNHX(t, supports))); err != nil {
+			io.LogError(err)
+			return
+		} else {
+			manifest.Files = append(manifest.Files, MERGED_TREE)
+		}
+	}
+
+	// Input files are kept on disk until they are cleaned
+	for _, input := range []string{a.SeqAlign, a.Reffile, a.Bootfile} {
+		var f *os.File
+		if input == "" {
+			continue
+		}
+		if f, err = os.Open(input); err != nil {
+			continue
+		}
+		name := "inputs/" + filepath.Base(input)
+		err = addToZip(zw, dir+name, f)
+		f.Close()
+		if err != nil {
+			io.LogError(err)
+			return
+		}
+		manifest.Files = append(manifest.Files, name)
+	}
+
+	var data bytes.Buffer
+	enc := json.NewEncoder(&data)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(manifest); err != nil {
+		io.LogError(err)
+		return
+	}
+	if err = addToZip(zw, dir+"manifest.json", &data); err != nil {
+		io.LogError(err)
+		return
+	}
+	if err = addToZip(zw, dir+"README.txt", strings.NewReader(manifest.readme())); err != nil {
+		io.LogError(err)
+		return
+	}
+	if err = zw.Close(); err != nil {
+		io.LogError(err)
+	}
+}
+
+func addToZip(zw *zip.Writer, name string, content goio.Reader) (err error) {
+	var f goio.Writer
+	if f, err = zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()}); err != nil {
+		return
+	}
+	_, err = goio.Copy(f, content)
+	return
+}
+
+func newBundleManifest(a *model.Analysis) *BundleManifest {
+	m := &BundleManifest{
+		Id:        a.Id,
+		RunName:   a.RunName,
+		Status:    a.StatusStr(),
+		Message:   a.Message,
+		Workflow:  workflow.Name(a.Workflow),
+		Submitted: bundleDate(a.StartPending),
+		Started:   bundleDate(a.StartRunning),
+		Ended:     bundleDate(a.End),
+		RunTime:   a.RunTime(),
+		TBE:       a.TBEStr(),
+		Files:     make([]string, 0),
+		Citations: append(workflow.Citations(a.Workflow), model.CITATION_BOOSTER),
+	}
+	if a.SeqAlign != "" {
+		m.NbootRep = a.NbootRep
+		m.Inference = a.InferenceStr()
+		m.NbSeqs = a.AlignNbSeq
+		m.Length = a.AlignLength
+		m.Alphabet = "nt"
+		if a.AlignAlphabet == model.ALIGN_AMINOACIDS {
+			m.Alphabet = "aa"
+		}
+	}
+	return m
+}
+
+func bundleDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// Human readable version of the manifest
+func (m *BundleManifest) readme() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "BOOSTER-WEB analysis %s\n\n", m.Id)
+	if m.RunName != "" {
+		fmt.Fprintf(&b, "Run name: %s\n", m.RunName)
+	}
+	fmt.Fprintf(&b, "Status: %s\n", m.Status)
+	if m.Message != "" {
+		fmt.Fprintf(&b, "Message: %s\n", m.Message)
+	}
+	fmt.Fprintf(&b, "Workflow: %s\n", m.Workflow)
+	if m.NbSeqs > 0 {
+		fmt.Fprintf(&b, "Input alignment: %d sequences, length %d (%s)\n", m.NbSeqs, m.Length, m.Alphabet)
+		fmt.Fprintf(&b, "Bootstrap trees built: %d\n", m.NbootRep)
+		fmt.Fprintf(&b, "Inference parameters: %s\n", m.Inference)
+	}
+	fmt.Fprintf(&b, "TBE parameters: %s\n", m.TBE)
+	fmt.Fprintf(&b, "Submitted on: %s\n", m.Submitted)
+	fmt.Fprintf(&b, "Started on: %s\n", m.Started)
+	fmt.Fprintf(&b, "Ended on: %s\n", m.Ended)
+	fmt.Fprintf(&b, "Run time: %s\n", m.RunTime)
+
+	fmt.Fprintf(&b, "\nFiles:\n")
+	for _, f := range m.Files {
+		desc, ok := bundleFileDescriptions[f]
+		if !ok {
+			desc = "Input file"
+		}
+		fmt.Fprintf(&b, "  %s: %s\n", f, desc)
+	}
+	fmt.Fprintf(&b, "  manifest.json: This description (json)\n")
+
+	fmt.Fprintf(&b, "\nPlease cite:\n")
+	for i, c := range m.Citations {
+		fmt.Fprintf(&b, "[%d] %s\n", i+1, c)
+	}
+	return b.String()
+}
@@ -0,0 +1,154 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/evolbioinfo/booster-web/artifact"
+	"github.com/evolbioinfo/booster-web/model"
+)
+
+// Returns the files of the bundle of the analysis, by name
+func getBundle(t *testing.T, id string) (code int, files map[string]string) {
+	w := httptest.NewRecorder()
+	apiAnalysisBundleHandler(w, httptest.NewRequest(http.MethodGet, "/api/analysis/"+id+"/bundle", nil), id)
+	if w.Code != http.StatusOK {
+		return w.Code, nil
+	}
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files = make(map[string]string)
+	for _, f := range zr.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name] = string(content)
+	}
+	return w.Code, files
+}
+
+func TestBundle(t *testing.T) {
+	newTestDB(t)
+	a := insertFinishedAnalysis(t, "finished")
+	a.Reffile = filepath.Join(t.TempDir(), "ref.nw")
+	if err := ioutil.WriteFile(a.Reffile, []byte("(A,B,(C,D),(E,F));"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	a.Bootfile = filepath.Join(t.TempDir(), "removed.nw")
+	if err := db.UpdateAnalysis(a); err != nil {
+		t.Fatal(err)
+	}
+
+	code, files := getBundle(t, "finished")
+	if code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	dir := "boosterweb_finished/"
+	var names []string
+	for name := range files {
+		if !strings.HasPrefix(name, dir) {
+			t.Errorf("File %s is not in directory %s", name, dir)
+		}
+		names = append(names, strings.TrimPrefix(name, dir))
+	}
+	sort.Strings(names)
+	expected := "[README.txt fbp.nh inputs/ref.nw manifest.json merged.nhx tbe_logs.txt tbe_norm.nh tbe_raw.nh]"
+	if fmt.Sprint(names) != expected {
+		t.Errorf("Expected files %s, got %v", expected, names)
+	}
+	if files[dir+artifact.TBE_NORM_TREE] != a.TbeNormTree || files[dir+"inputs/ref.nw"] != "(A,B,(C,D),(E,F));" {
+		t.Error("Wrong content of the bundled files")
+	}
+
+	var manifest BundleManifest
+	if err := json.Unmarshal([]byte(files[dir+"manifest.json"]), &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Id != "finished" || manifest.RunName != "run" || manifest.Status != a.StatusStr() ||
+		manifest.Submitted != "2026-01-02T10:00:00Z" || manifest.Ended != "2026-01-02T11:01:00Z" ||
+		manifest.TBE != a.TBEStr() || len(manifest.Citations) == 0 {
+		t.Errorf("Wrong manifest %+v", manifest)
+	}
+	// The manifest lists the files, except itself and the README
+	if len(manifest.Files) != len(names)-2 {
+		t.Errorf("Expected %d files in the manifest, got %v", len(names)-2, manifest.Files)
+	}
+	readme := files[dir+"README.txt"]
+	for _, line := range []string{"BOOSTER-WEB analysis finished", "Run name: run", "TBE parameters: " + a.TBEStr(), "merged.nhx: "} {
+		if !strings.Contains(readme, line) {
+			t.Errorf("README.txt does not contain %q:\n%s", line, readme)
+		}
+	}
+}
+
+func TestBundleNotOver(t *testing.T) {
+	newTestDB(t)
+	a := insertTestAnalysis(t, "pending", "u1", time.Now())
+	a.Status = model.STATUS_PENDING
+	if err := db.UpdateAnalysis(a); err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := getBundle(t, "pending"); code != http.StatusConflict {
+		t.Errorf("Pending analysis: expected 409, got %d", code)
+	}
+	if code, _ := getBundle(t, "unknown"); code != http.StatusNotFound {
+		t.Errorf("Unknown analysis: expected 404, got %d", code)
+	}
+
+	// Failed analyses are bundled without merged tree
+	a = insertFinishedAnalysis(t, "failed")
+	a.Status = model.STATUS_ERROR
+	a.Message = "Error"
+	if err := db.UpdateAnalysis(a); err != nil {
+		t.Fatal(err)
+	}
+	_, files := getBundle(t, "failed")
+	if _, ok := files["boosterweb_failed/merged.nhx"]; ok {
+		t.Error("Failed analyses should not have a merged tree")
+	}
+	var manifest BundleManifest
+	if err := json.Unmarshal([]byte(files["boosterweb_failed/manifest.json"]), &manifest); err != nil || manifest.Message != "Error" {
+		t.Errorf("Expected the error message in the manifest, got %+v (%v)", manifest, err)
+	}
+}
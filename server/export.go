@@ -0,0 +1,303 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+package server
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/evolbioinfo/booster-web/artifact"
+	"github.com/evolbioinfo/booster-web/io"
+	"github.com/evolbioinfo/booster-web/model"
+	"github.com/evolbioinfo/gotree/io/newick"
+	"github.com/evolbioinfo/gotree/io/nexus"
+	"github.com/evolbioinfo/gotree/tree"
+)
+
+// Export formats of the result tree of an analysis
+const (
+	EXPORT_NEXUS    = "nexus"
+	EXPORT_PHYLOXML = "phyloxml"
+	EXPORT_NHX      = "nhx"
+)
+
+// Name of the merged tree in the result bundle
+const MERGED_TREE = "merged.nhx"
+
+// Supports of a branch of the result tree, gathered from the
+// FBP, TBE normalized and TBE raw trees
+type branchSupports struct {
+	fbp     float64
+	tbe     float64
+	raw     bool // If the TBE raw tree gave the following fields
+	id      int
+	avgdist float64
+	depth   int
+}
+
+// Converts the result tree of a finished analysis into Nexus, PhyloXML or
+// NHX. Supports are given as annotations of the same tree:
+//   - Nexus: [&fbp=...,tbe=...] comments on internal nodes (FigTree style)
+//   - PhyloXML: <confidence type="fbp"> and <confidence type="tbe"> of clades
+//   - NHX: [&&NHX:fbp=...:tbe_norm=...:avg_dist=...:depth=...:id=...]
+//     comments on internal branches
+func apiAnalysisExportHandler(w http.ResponseWriter, r *http.Request, id, format string) {
+	var a *model.Analysis
+	var t *tree.Tree
+	var supports map[*tree.Edge]*branchSupports
+	var out string
+	var err error
+
+	if r.Method != http.MethodGet {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Allow", http.MethodGet)
+		apiErrorStatus(w, http.StatusMethodNotAllowed, errors.New("Method not allowed: "+r.Method))
+		return
+	}
+	if a, err = getAnalysis(id); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		apiErrorStatus(w, http.StatusNotFound, err)
+		return
+	}
+	if a.Status != model.STATUS_FINISHED {
+		w.Header().Set("Content-Type", "application/json")
+		apiErrorStatus(w, http.StatusConflict, errors.New("Analysis is not finished"))
+		return
+	}
+	if t, supports, err = mergedTree(a); err != nil {
+		io.LogError(err)
+		w.Header().Set("Content-Type", "application/json")
+		apiErrorStatus(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	var contenttype, ext string
+	switch format {
+	case EXPORT_NEXUS:
+		contenttype, ext = "text/x-nexus; charset=utf-8", "nex"
+		out, err = writeNexus(t, supports)
+	case EXPORT_PHYLOXML:
+		contenttype, ext = "application/xml; charset=utf-8", "xml"
+		out = writePhyloXML(t, supports)
+	case EXPORT_NHX:
+		contenttype, ext = "text/x-nh; charset=utf-8", "nhx"
+		out = writeNHX(t, supports)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		io.LogError(err)
+		w.Header().Set("Content-Type", "application/json")
+		apiErrorStatus(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", contenttype)
+	w.Header().Set("Content-Disposition", "attachment; filename=\"boosterweb_"+id+"."+ext+"\"")
+	w.Write([]byte(out))
+}
+
+// Returns the FBP tree of the analysis, and the supports of its internal
+// branches. TBE supports are taken from the TBE normalized and raw trees,
+// whose branches are matched by bipartition. The raw tree is optional.
+func mergedTree(a *model.Analysis) (fbp *tree.Tree, supports map[*tree.Edge]*branchSupports, err error) {
+	var tbe, raw *tree.Tree
+	var tbeedges, rawedges []*tree.Edge
+	var tbeindex, rawindex *tree.EdgeIndex
+
+	if fbp, err = readResultTree(a, artifact.FBP_TREE); err != nil {
+		return
+	}
+	if tbe, err = readResultTree(a, artifact.TBE_NORM_TREE); err != nil {
+		return
+	}
+	if fbp == nil || tbe == nil {
+		err = errors.New("Result trees of the analysis are not available")
+		return
+	}
+	if raw, err = readResultTree(a, artifact.TBE_RAW_TREE); err != nil {
+		return
+	}
+	tbeedges = tbe.Edges()
+	if tbeindex, err = edgeIndex(tbeedges); err != nil {
+		return
+	}
+	if raw != nil {
+		rawedges = raw.Edges()
+		if rawindex, err = edgeIndex(rawedges); err != nil {
+			return
+		}
+	}
+
+	supports = make(map[*tree.Edge]*branchSupports)
+	for _, e := range fbp.Edges() {
+		if e.Right().Tip() {
+			continue
+		}
+		s := &branchSupports{fbp: e.Support(), tbe: tree.NIL_SUPPORT}
+		if v, ok := tbeindex.Value(e); ok {
+			s.tbe = tbeedges[v.Count].Support()
+		}
+		if rawindex != nil {
+			if v, ok := rawindex.Value(e); ok {
+				s.id, s.avgdist, s.depth, s.raw = parseRawName(rawedges[v.Count].Right().Name())
+			}
+		}
+		supports[e] = s
+	}
+	return
+}
+
+// Parses the result tree of the analysis, nil if it does not exist
+func readResultTree(a *model.Analysis, name string) (t *tree.Tree, err error) {
+	var s string
+	if s, err = artifact.Read(store, a, name); err != nil || s == "" {
+		return
+	}
+	if t, err = newick.NewParser(strings.NewReader(s)).Parse(); err != nil {
+		return
+	}
+	err = t.ReinitIndexes()
+	return
+}
+
+// Index of the branches by bipartition, giving their position in edges
+func edgeIndex(edges []*tree.Edge) (index *tree.EdgeIndex, err error) {
+	index = tree.NewEdgeIndex(uint64(len(edges)*2), 0.75)
+	for i, e := range edges {
+		if err = index.PutEdgeValue(e, i, e.Length()); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Parses the name of an internal node of the TBE raw tree:
+// "Branch ID|Average transfer Distance|Size of the light side"
+func parseRawName(name string) (id int, avgdist float64, depth int, ok bool) {
+	var err error
+	fields := strings.Split(name, "|")
+	if len(fields) != 3 {
+		return
+	}
+	if id, err = strconv.Atoi(fields[0]); err != nil {
+		return
+	}
+	if avgdist, err = strconv.ParseFloat(fields[1], 64); err != nil {
+		return
+	}
+	if depth, err = strconv.Atoi(fields[2]); err != nil {
+		return
+	}
+	ok = true
+	return
+}
+
+func supportString(support float64) string {
+	if support == tree.NIL_SUPPORT {
+		return "NA"
+	}
+	return strconv.FormatFloat(support, 'f', -1, 64)
+}
+
+// Removes the supports of the internal branches, that are given by comments
+func clearSupports(supports map[*tree.Edge]*branchSupports) {
+	for e := range supports {
+		e.SetSupport(tree.NIL_SUPPORT)
+	}
+}
+
+func writeNexus(t *tree.Tree, supports map[*tree.Edge]*branchSupports) (string, error) {
+	clearSupports(supports)
+	for e, s := range supports {
+		e.Right().AddComment("&fbp=" + supportString(s.fbp) + ",tbe=" + supportString(s.tbe))
+	}
+	c := make(chan tree.Trees, 1)
+	c <- tree.Trees{Tree: t, Id: 1}
+	close(c)
+	return nexus.WriteNexus(c)
+}
+
+// Newick tree with New Hampshire eXtended comments on internal branches
+func writeNHX(t *tree.Tree, supports map[*tree.Edge]*branchSupports) string {
+	clearSupports(supports)
+	for e, s := range supports {
+		comment := "&&NHX:fbp=" + supportString(s.fbp) + ":tbe_norm=" + supportString(s.tbe)
+		if s.raw {
+			comment += fmt.Sprintf(":avg_dist=%s:depth=%d:id=%d",
+				strconv.FormatFloat(s.avgdist, 'f', -1, 64), s.depth, s.id)
+		}
+		e.AddComment(comment)
+	}
+	return t.Newick() + "\n"
+}
+
+// gotree's PhyloXML writer gives only one confidence per clade, and does
+// not escape names: this one gives the fbp and tbe confidences.
+func writePhyloXML(t *tree.Tree, supports map[*tree.Edge]*branchSupports) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<phyloxml xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"
+          xsi:schemaLocation="http://www.phyloxml.org http://www.phyloxml.org/1.10/phyloxml.xsd"
+          xmlns="http://www.phyloxml.org">
+`)
+	fmt.Fprintf(&b, "  <phylogeny rooted=\"%t\">\n", t.Rooted())
+	writePhyloXMLClade(&b, supports, t.Root(), nil, nil, 2)
+	b.WriteString("  </phylogeny>\n")
+	b.WriteString("</phyloxml>\n")
+	return b.String()
+}
+
+func writePhyloXMLClade(b *strings.Builder, supports map[*tree.Edge]*branchSupports, n, prev *tree.Node, e *tree.Edge, level int) {
+	tab := strings.Repeat("  ", level)
+	b.WriteString(tab + "<clade>\n")
+	if n.Name() != "" {
+		b.WriteString(tab + "  <name>")
+		xml.EscapeText(b, []byte(n.Name()))
+		b.WriteString("</name>\n")
+	}
+	if e != nil {
+		if e.Length() != tree.NIL_LENGTH {
+			fmt.Fprintf(b, "%s  <branch_length>%s</branch_length>\n", tab, e.LengthString())
+		}
+		if s, ok := supports[e]; ok {
+			if s.fbp != tree.NIL_SUPPORT {
+				fmt.Fprintf(b, "%s  <confidence type=\"fbp\">%s</confidence>\n", tab, supportString(s.fbp))
+			}
+			if s.tbe != tree.NIL_SUPPORT {
+				fmt.Fprintf(b, "%s  <confidence type=\"tbe\">%s</confidence>\n", tab, supportString(s.tbe))
+			}
+		}
+	}
+	for i, child := range n.Neigh() {
+		if child != prev {
+			writePhyloXMLClade(b, supports, child, n, n.Edges()[i], level+1)
+		}
+	}
+	b.WriteString(tab + "</clade>\n")
+}
@@ -0,0 +1,194 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/evolbioinfo/booster-web/model"
+)
+
+func export(id, format string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	apiAnalysisExportHandler(w, httptest.NewRequest(http.MethodGet, "/api/analysis/"+id+"/export/"+format, nil), id, format)
+	return w
+}
+
+func TestExportNexus(t *testing.T) {
+	newTestDB(t)
+	insertFinishedAnalysis(t, "finished")
+
+	w := export("finished", EXPORT_NEXUS)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d %s", w.Code, w.Body.String())
+	}
+	if d := w.Header().Get("Content-Disposition"); d != `attachment; filename="boosterweb_finished.nex"` {
+		t.Errorf("Wrong Content-Disposition %q", d)
+	}
+	// TBE supports are matched by bipartition, whatever the order of the branches
+	for _, expected := range []string{
+		"#NEXUS",
+		"TAXLABELS A B C D E F;",
+		"TREE tree1 = ((A:1,B:1)[&fbp=0.9,tbe=0.95]:0.5,(C:1,D:1)[&fbp=0.8,tbe=0.85]:0.5,(E:1,F:1)[&fbp=0.7,tbe=0.75]:0.5);",
+	} {
+		if !strings.Contains(w.Body.String(), expected) {
+			t.Errorf("Expected %q in\n%s", expected, w.Body.String())
+		}
+	}
+}
+
+func TestExportPhyloXML(t *testing.T) {
+	newTestDB(t)
+	a := insertFinishedAnalysis(t, "finished")
+	a.FbpTree = "((A&B:1,<C>:1)0.9:0.5,D:1,E:1);"
+	a.TbeNormTree = "((A&B:1,<C>:1)0.95:0.5,D:1,E:1);"
+	a.TbeRawTree = ""
+	if err := db.UpdateAnalysis(a); err != nil {
+		t.Fatal(err)
+	}
+
+	w := export("finished", EXPORT_PHYLOXML)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d %s", w.Code, w.Body.String())
+	}
+	expected := `  <phylogeny rooted="false">
+    <clade>
+      <clade>
+        <branch_length>0.5</branch_length>
+        <confidence type="fbp">0.9</confidence>
+        <confidence type="tbe">0.95</confidence>
+        <clade>
+          <name>A&amp;B</name>
+          <branch_length>1</branch_length>
+        </clade>
+        <clade>
+          <name>&lt;C&gt;</name>
+          <branch_length>1</branch_length>
+        </clade>
+      </clade>
+      <clade>
+        <name>D</name>
+        <branch_length>1</branch_length>
+      </clade>
+      <clade>
+        <name>E</name>
+        <branch_length>1</branch_length>
+      </clade>
+    </clade>
+  </phylogeny>
+`
+	if !strings.Contains(w.Body.String(), expected) {
+		t.Errorf("Expected\n%s\nin\n%s", expected, w.Body.String())
+	}
+}
+
+func TestExportErrors(t *testing.T) {
+	newTestDB(t)
+	insertFinishedAnalysis(t, "finished")
+	a := insertTestAnalysis(t, "running", "u1", time.Now())
+	a.Status = model.STATUS_RUNNING
+	if err := db.UpdateAnalysis(a); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		id, format string
+		code       int
+	}{
+		{"unknown", EXPORT_NEXUS, http.StatusNotFound},
+		{"running", EXPORT_NEXUS, http.StatusConflict},
+		{"finished", "newick", http.StatusNotFound},
+	} {
+		if w := export(test.id, test.format); w.Code != test.code {
+			t.Errorf("%s in %s: expected %d, got %d", test.id, test.format, test.code, w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	apiAnalysisExportHandler(w, httptest.NewRequest(http.MethodPost, "/api/analysis/finished/export/nexus", nil), "finished", EXPORT_NEXUS)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: expected 405, got %d", w.Code)
+	}
+}
+
+func TestExportNHX(t *testing.T) {
+	newTestDB(t)
+	a := insertFinishedAnalysis(t, "finished")
+
+	w := export("finished", EXPORT_NHX)
+	expected := "((A:1,B:1):0.5[&&NHX:fbp=0.9:tbe_norm=0.95:avg_dist=0.05:depth=2:id=1]," +
+		"(C:1,D:1):0.5[&&NHX:fbp=0.8:tbe_norm=0.85:avg_dist=0.15:depth=2:id=2]," +
+		"(E:1,F:1):0.5[&&NHX:fbp=0.7:tbe_norm=0.75:avg_dist=0.25:depth=2:id=3]);\n"
+	if w.Code != http.StatusOK || w.Body.String() != expected {
+		t.Errorf("Expected\n%s\ngot %d\n%s", expected, w.Code, w.Body.String())
+	}
+
+	// Without raw tree, or if a branch misses in the TBE trees
+	a.TbeNormTree = "((A:1,B:1)0.95:0.5,C:1,D:1,(E:1,F:1)0.75:0.5);"
+	a.TbeRawTree = ""
+	if err := db.UpdateAnalysis(a); err != nil {
+		t.Fatal(err)
+	}
+	w = export("finished", EXPORT_NHX)
+	expected = "((A:1,B:1):0.5[&&NHX:fbp=0.9:tbe_norm=0.95]," +
+		"(C:1,D:1):0.5[&&NHX:fbp=0.8:tbe_norm=NA]," +
+		"(E:1,F:1):0.5[&&NHX:fbp=0.7:tbe_norm=0.75]);\n"
+	if w.Code != http.StatusOK || w.Body.String() != expected {
+		t.Errorf("Expected\n%s\ngot %d\n%s", expected, w.Code, w.Body.String())
+	}
+
+	// Branches of other taxa are not matched
+	a.TbeNormTree = "((A:1,B:1)0.95:0.5,(C:1,D:1)0.85:0.5,(E:1,G:1)0.75:0.5);"
+	if err := db.UpdateAnalysis(a); err != nil {
+		t.Fatal(err)
+	}
+	w = export("finished", EXPORT_NHX)
+	if !strings.Contains(w.Body.String(), "(E:1,F:1):0.5[&&NHX:fbp=0.7:tbe_norm=NA]") {
+		t.Errorf("Expected no TBE support for (E,F), got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestParseRawName(t *testing.T) {
+	for name, expected := range map[string]branchSupports{
+		"12|0.25|3":  {id: 12, avgdist: 0.25, depth: 3, raw: true},
+		"12|0.25":    {},
+		"x|0.25|3":   {},
+		"12|NaN|x":   {},
+		"":           {},
+		"0.95":       {},
+		"1|1e-05|10": {id: 1, avgdist: 1e-05, depth: 10, raw: true},
+	} {
+		var s branchSupports
+		if s.id, s.avgdist, s.depth, s.raw = parseRawName(name); !s.raw {
+			s = branchSupports{}
+		}
+		if s != expected {
+			t.Errorf("%q: expected %+v, got %+v", name, expected, s)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/evolbioinfo/booster-web/database"
+	"github.com/evolbioinfo/booster-web/model"
+	"github.com/evolbioinfo/booster-web/processor"
+)
+
+// Sets the database of the server to a new in memory database
+func newTestDB(t *testing.T) {
+	d := database.NewMemoryBoosterWebDB()
+	if err := d.InitDatabase(); err != nil {
+		t.Fatal(err)
+	}
+	db = d
+	t.Cleanup(func() { db = nil })
+}
+
+// Inserts a submitted analysis
+func insertTestAnalysis(t *testing.T, id, owner string, submitted time.Time) *model.Analysis {
+	a := model.NewAnalysis()
+	a.Id = id
+	a.Owner = owner
+	a.EMail = owner + "@example.org"
+	a.StartPending = submitted
+	if err := db.UpdateAnalysis(a); err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+// Returns the request as authenticated by validateHtml/validateApi
+func withClaims(r *http.Request, claims Claims) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), MyKey, claims))
+}
+
+// Inserts a finished analysis, with its result trees and logs. The
+// branches of the TBE trees are not given in the order of the FBP tree.
+func insertFinishedAnalysis(t *testing.T, id string) *model.Analysis {
+	a := insertTestAnalysis(t, id, "u1", time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC))
+	a.RunName = "run"
+	a.Status = model.STATUS_FINISHED
+	a.StartRunning = a.StartPending.Add(time.Minute)
+	a.End = a.StartRunning.Add(time.Hour)
+	a.FbpTree = "((A:1,B:1)0.9:0.5,(C:1,D:1)0.8:0.5,(E:1,F:1)0.7:0.5);"
+	a.TbeNormTree = "((E:1,F:1)0.75:0.5,(C:1,D:1)0.85:0.5,(B:1,A:1)0.95:0.5);"
+	a.TbeRawTree = "((C:1,D:1)2|0.15|2:0.5,(A:1,B:1)1|0.05|2:0.5,(E:1,F:1)3|0.25|2:0.5);"
+	a.TbeLogs = "logs"
+	if err := db.UpdateAnalysis(a); err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+// Database refusing to read whole analyses
+type summaryOnlyDB struct {
+	database.BoosterwebDB
+}
+
+func (d summaryOnlyDB) GetAnalysis(id string) (*model.Analysis, error) {
+	return nil, errors.New("Whole analysis read instead of its summary")
+}
+
+// Processor of FastTree analyses, failing to launch them
+type failingProcessor struct {
+	processor.Processor
+}
+
+func (failingProcessor) LaunchAnalysis(a *model.Analysis) error {
+	return errors.New("Launch error")
+}
+
+func (failingProcessor) Workflows() []int {
+	return []int{model.WORKFLOW_FASTTREE}
+}
+
+// Processor canceling the analyses it is asked to cancel
+type cancelingProcessor struct {
+	processor.Processor
+}
+
+func (cancelingProcessor) CancelAnalysis(id string) error {
+	return db.UpdateStatus(id, model.STATUS_CANCELED, "Canceled")
+}
@@ -24,21 +24,32 @@ Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
 package server
 
 import (
+	"bytes"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"html/template"
+	goio "io"
 	"mime/multipart"
 	"net/http"
+	"net/url"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/evolbioinfo/booster-web/artifact"
+	"github.com/evolbioinfo/booster-web/auth"
+	"github.com/evolbioinfo/booster-web/database"
+	"github.com/evolbioinfo/booster-web/events"
 	"github.com/evolbioinfo/booster-web/io"
 	"github.com/evolbioinfo/booster-web/model"
+	"github.com/evolbioinfo/booster-web/processor"
 	"github.com/evolbioinfo/booster-web/templates"
 	"github.com/evolbioinfo/booster-web/utils"
+	"github.com/evolbioinfo/booster-web/workflow"
 	"github.com/evolbioinfo/gotree/draw"
 	"github.com/evolbioinfo/gotree/io/newick"
 	"github.com/evolbioinfo/gotree/upload"
@@ -48,6 +59,18 @@ type ErrorInfo struct {
 	Message string
 }
 
+// Analyses are only listed with authentication
+var ErrListingDisabled = errors.New("Listing analyses requires authentication")
+
+// Analysis submissions are limited to MAX_REQUEST_SIZE bytes
+var ErrRequestTooLarge = fmt.Errorf("Request is too large (max %d bytes)", MAX_REQUEST_SIZE)
+
+// Returns true if the error comes from reading more than allowed by http.MaxBytesReader
+// (http.MaxBytesError only exists since go 1.19)
+func isRequestTooLarge(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "http: request body too large")
+}
+
 type MarkDownPage struct {
 	Md string
 }
@@ -57,10 +80,89 @@ type GenericResponse struct {
 	Message string `json:"message"`
 }
 
+// Error in the user inputs of a new analysis
+//
+// Field is the name of the form/json field that is wrong
+// (refalign, reftree, boottrees, nboot, workflow), or
+// empty if the error does not concern a particular field.
+type ValidationError struct {
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// Answer of the api when an analysis could not be created
+type ApiErrorResponse struct {
+	Status  int                `json:"status"`
+	Message string             `json:"message"`
+	Errors  []*ValidationError `json:"errors,omitempty"`
+}
+
+// Input file given inline in a json analysis submission
+type ApiInputFile struct {
+	Name     string `json:"name"`     // Original file name (gzipped content if it ends with .gz)
+	Content  string `json:"content"`  // Content of the file
+	Encoding string `json:"encoding"` // "base64" if content is base64 encoded, plain text otherwise
+}
+
+// Json body of a new analysis submission via POST /api/analysis
+type ApiAnalysisRequest struct {
+	RunName   string          `json:"runname"`
+	EMail     string          `json:"email"`
+	Workflow  string          `json:"workflow"`
+	NbootRep  json.RawMessage `json:"nboot"` // Number, or string as in forms
+	RefAlign  *ApiInputFile   `json:"refalign"`
+	RefTree   *ApiInputFile   `json:"reftree"`
+	BootTrees *ApiInputFile   `json:"boottrees"`
+
+	model.InferenceParams // Optional: criterion, moves, model, nogamma
+	model.TBEParams       // Optional: transfercutoff, norawtree, nomovedtaxa
+}
+
+// Analysis given to the view template, with its
+// position in the processor queue if it is waiting
+type AnalysisView struct {
+	*model.Analysis
+	QueuePosition int
+}
+
+// Page of analyses returned by GET /api/analyses
+type ApiAnalysesResponse struct {
+	Analyses []*model.Analysis `json:"analyses"`
+	Next     string            `json:"next,omitempty"` // Cursor of the next page, empty on the last page
+}
+
+// Login page: form, or link to the external login page if
+// the authentication provider is OpenID Connect
+type LoginView struct {
+	Redirect bool
+}
+
+// Option of a select field of the history filter form
+type HistoryOption struct {
+	Value    int
+	Label    string
+	Selected bool
+}
+
+// Analyses given to the history template, with the
+// filter form values, and the url of the next page
+type HistoryView struct {
+	Query     url.Values
+	Statuses  []HistoryOption
+	Workflows []HistoryOption
+	Analyses  []*model.Analysis
+	NextPage  string
+}
+
 // Global informations about server given to different templates
 type GlobalInformation struct {
 	GalaxyProcessor   bool
 	EmailNotification bool
+	Workflows         []workflow.Workflow // Workflows inferring trees from alignments
 }
 
 func errorHandler(w http.ResponseWriter, r *http.Request, err error) {
@@ -88,7 +190,8 @@ func indexHandler(w http.ResponseWriter, r *http.Request) {
 
 func loginHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/html")
-	var info interface{}
+	_, redirect := authenticator.(auth.RedirectAuthenticator)
+	info := LoginView{Redirect: redirect}
 	if t, err := getTemplate("login"); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	} else {
@@ -139,10 +242,61 @@ func viewHandler(w http.ResponseWriter, r *http.Request, id string) {
 		return
 	}
 
+	view := AnalysisView{Analysis: a}
+	if pos, queued := proc.QueuePosition(id); queued {
+		view.QueuePosition = pos
+	}
+
 	if t, err := getTemplate("view"); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	} else {
-		if err := t.ExecuteTemplate(w, "layout", a); err != nil {
+		if err := t.ExecuteTemplate(w, "layout", view); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// Lists past analyses, filtered with the same query parameters as GET /api/analyses
+func historyHandler(w http.ResponseWriter, r *http.Request) {
+	var filter database.AnalysisFilter
+	var ok bool
+	var err error
+
+	w.Header().Set("Content-Type", "text/html")
+	view := HistoryView{Query: r.URL.Query()}
+	if filter, err = analysisFilterFromQuery(view.Query); err != nil {
+		errorHandler(w, r, err)
+		return
+	}
+	if filter.Owner, ok = requestOwnerFilter(r); !ok {
+		errorHandler(w, r, ErrListingDisabled)
+		return
+	}
+	if view.Analyses, view.NextPage, err = listAnalyses(filter); err != nil {
+		io.LogError(err)
+		errorHandler(w, r, err)
+		return
+	}
+	if view.NextPage != "" {
+		next := r.URL.Query()
+		next.Set("cursor", view.NextPage)
+		view.NextPage = "/history?" + next.Encode()
+	}
+
+	for _, st := range []int{model.STATUS_PENDING, model.STATUS_RUNNING, model.STATUS_FINISHED,
+		model.STATUS_ERROR, model.STATUS_CANCELED, model.STATUS_TIMEOUT, model.STATUS_DELETED} {
+		a := model.Analysis{Status: st}
+		view.Statuses = append(view.Statuses, HistoryOption{st, a.StatusStr(), containsInt(filter.Status, st)})
+	}
+	view.Workflows = append(view.Workflows, HistoryOption{model.WORKFLOW_NIL, workflow.Name(model.WORKFLOW_NIL), containsInt(filter.Workflow, model.WORKFLOW_NIL)})
+	for _, wf := range workflow.All() {
+		view.Workflows = append(view.Workflows, HistoryOption{wf.Id(), wf.Name(), containsInt(filter.Workflow, wf.Id())})
+	}
+
+	if t, err := getTemplate("history"); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	} else {
+		if err := t.ExecuteTemplate(w, "layout", view); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
 	}
@@ -159,13 +313,17 @@ func itolHandler(w http.ResponseWriter, r *http.Request, id string, rawdistances
 	}
 	if a.Status == model.STATUS_FINISHED || a.Status == model.STATUS_TIMEOUT {
 		upld := upload.NewItolUploader(iTOLKey, iTOLProject)
-		var uptree string
+		name := artifact.TBE_NORM_TREE
 		if fbptree {
-			uptree = a.FbpTree
+			name = artifact.FBP_TREE
 		} else if rawdistances {
-			uptree = a.TbeRawTree
-		} else {
-			uptree = a.TbeNormTree
+			name = artifact.TBE_RAW_TREE
+		}
+		uptree, err := artifact.Read(store, a, name)
+		if err != nil {
+			io.LogError(err)
+			errorHandler(w, r, err)
+			return
 		}
 		t, err := newick.NewParser(strings.NewReader(uptree)).Parse()
 		if err == nil {
@@ -195,6 +353,7 @@ func newHandler(w http.ResponseWriter, r *http.Request) {
 	info := GlobalInformation{
 		GalaxyProcessor:   galaxyprocessor,
 		EmailNotification: emailnotification,
+		Workflows:         availableWorkflows(),
 	}
 
 	if t, err := getTemplate("inputform"); err != nil {
@@ -207,91 +366,619 @@ func newHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func runHandler(w http.ResponseWriter, r *http.Request) {
+	var err error
+	var a *model.Analysis
+
+	if a, err = newAnalysisFromForm(r); err != nil {
+		err = errors.New("Error while creating a new analysis: " + err.Error())
+		io.LogError(err)
+		errorHandler(w, r, err)
+		//http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/view/"+a.Id, http.StatusSeeOther)
+}
+
+// Creates a new analysis from a multipart form
+// (html form of /run or multipart post to /api/analysis)
+func newAnalysisFromForm(r *http.Request) (a *model.Analysis, err error) {
 	var refalign multipart.File
 	var refalignhandler *multipart.FileHeader
 	var reftree multipart.File
 	var refhandler *multipart.FileHeader
 	var boottree multipart.File
 	var boothandler *multipart.FileHeader
-	var err error
-	var a *model.Analysis
-	var nbootint int64
-	var nbootrep string
+	var nboot int
 	var workflow string
 	var email string
 	var runname string
+	var params model.InferenceParams
+	var tbeparams model.TBEParams
 
-	parserr := r.ParseMultipartForm(32 << 20)
-	if parserr != nil {
-		io.LogError(parserr)
-		errorHandler(w, r, parserr)
-		return
+	if err = r.ParseMultipartForm(32 << 20); err != nil {
+		if isRequestTooLarge(err) {
+			return nil, ErrRequestTooLarge
+		}
+		return nil, &ValidationError{"", err.Error()}
 	}
 
 	if refalign, refalignhandler, err = r.FormFile("refalign"); err != nil || refalignhandler.Size == 0 {
-		err = errors.New("No Sequence file given")
-		io.LogInfo(err.Error())
+		io.LogInfo("No Sequence file given")
+		refalign, refalignhandler = nil, nil
 
 		// No given sequence file
 		// Then we take tree files
 		if reftree, refhandler, err = r.FormFile("reftree"); err != nil || refhandler.Size == 0 {
-			err = errors.New("No reference tree file given (nor sequence file): ")
-			io.LogError(err)
-			errorHandler(w, r, err)
-			return
+			return nil, &ValidationError{"reftree", "No reference tree file given (nor sequence file)"}
 		}
 		defer reftree.Close()
 
 		if boottree, boothandler, err = r.FormFile("boottrees"); err != nil || boothandler.Size == 0 {
-			err = errors.New("No bootstrap tree file given (nor sequence file): " + err.Error())
-			io.LogError(err)
-			errorHandler(w, r, err)
-			return
+			return nil, &ValidationError{"boottrees", "No bootstrap tree file given (nor sequence file)"}
 		}
 		defer boottree.Close()
+	} else {
+		defer refalign.Close()
 	}
 	email = r.FormValue("email")
 	runname = r.FormValue("runname")
 	workflow = r.FormValue("workflow")
+	params.Criterion = r.FormValue("criterion")
+	params.Moves = r.FormValue("moves")
+	params.Model = r.FormValue("model")
+	params.NoGamma = r.FormValue("nogamma") == "true"
+	tbeparams.NoRawTree = r.FormValue("norawtree") == "true"
+	tbeparams.NoMovedTaxa = r.FormValue("nomovedtaxa") == "true"
+	if cutoff := r.FormValue("transfercutoff"); cutoff != "" {
+		if tbeparams.TransferCutoff, err = strconv.ParseFloat(cutoff, 64); err != nil {
+			return nil, &ValidationError{"transfercutoff", "Transfer cutoff must be a number"}
+		}
+	}
 
-	nbootrep = r.FormValue("nboot")
-	if nbootint, err = strconv.ParseInt(nbootrep, 10, 64); err != nil && galaxyprocessor {
-		io.LogError(err)
-		errorHandler(w, r, err)
+	if nboot, err = parseNboot(r.FormValue("nboot"), refalign != nil); err != nil {
 		return
 	}
-	if nbootint > 1000 {
-		nbootint = 1000
+
+	return newAnalysis(refalign, refalignhandler, reftree, refhandler, boottree, boothandler, email, runname, nboot, workflow, params, tbeparams, requestUserId(r))
+}
+
+// Creates a new analysis from a json body
+// (json post to /api/analysis)
+func newAnalysisFromJson(r *http.Request) (a *model.Analysis, err error) {
+	var refalign, reftree, boottree multipart.File
+	var refalignhandler, refhandler, boothandler *multipart.FileHeader
+	var nboot int
+
+	req := ApiAnalysisRequest{}
+	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if isRequestTooLarge(err) {
+			return nil, ErrRequestTooLarge
+		}
+		return nil, &ValidationError{"", "Malformed json request: " + err.Error()}
+	}
+	hasalign := req.RefAlign != nil && req.RefAlign.Content != ""
+	if nboot, err = parseNboot(jsonString(req.NbootRep), hasalign); err != nil {
+		return
 	}
 
-	if a, err = newAnalysis(refalign, refalignhandler, reftree, refhandler, boottree, boothandler, email, runname, int(nbootint), workflow); err != nil {
-		err = errors.New("Error while creating a new analysis: " + err.Error())
+	if hasalign {
+		if refalign, refalignhandler, err = req.RefAlign.open("refalign", "alignment"); err != nil {
+			return
+		}
+	} else {
+		if req.RefTree == nil || req.RefTree.Content == "" {
+			return nil, &ValidationError{"reftree", "No reference tree file given (nor sequence file)"}
+		}
+		if req.BootTrees == nil || req.BootTrees.Content == "" {
+			return nil, &ValidationError{"boottrees", "No bootstrap tree file given (nor sequence file)"}
+		}
+		if reftree, refhandler, err = req.RefTree.open("reftree", "reftree.nw"); err != nil {
+			return
+		}
+		if boottree, boothandler, err = req.BootTrees.open("boottrees", "boottrees.nw"); err != nil {
+			return
+		}
+	}
+
+	return newAnalysis(refalign, refalignhandler, reftree, refhandler, boottree, boothandler, req.EMail, req.RunName, nboot, req.Workflow, req.InferenceParams, req.TBEParams, requestUserId(r))
+}
+
+// Number of bootstrap replicates of a form or json submission.
+// It is only required if an alignment is given.
+func parseNboot(value string, hasalign bool) (nboot int, err error) {
+	if nboot, err = strconv.Atoi(strings.TrimSpace(value)); err != nil {
+		if !hasalign {
+			return 0, nil
+		}
+		return 0, &ValidationError{"nboot", "Number of bootstrap replicates must be an integer"}
+	}
+	return
+}
+
+// Value of a json string or number
+func jsonString(value json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(value, &s); err == nil {
+		return s
+	}
+	return string(value)
+}
+
+// In memory file, implementing multipart.File
+type inlineFile struct {
+	*bytes.Reader
+}
+
+func (f inlineFile) Close() error {
+	return nil
+}
+
+// Returns the inline file as if it was uploaded through a multipart form.
+//
+// field is used in validation errors, and defaultname is the file name
+// used if the request does not give any.
+func (f *ApiInputFile) open(field, defaultname string) (file multipart.File, header *multipart.FileHeader, err error) {
+	var content []byte
+
+	switch f.Encoding {
+	case "base64":
+		if content, err = base64.StdEncoding.DecodeString(f.Content); err != nil {
+			return nil, nil, &ValidationError{field, "Base64 decoding error (" + err.Error() + ")"}
+		}
+	case "", "plain":
+		content = []byte(f.Content)
+	default:
+		return nil, nil, &ValidationError{field, "Unknown file encoding: " + f.Encoding}
+	}
+
+	name := defaultname
+	if f.Name != "" {
+		name = filepath.Base(f.Name)
+	}
+
+	file = inlineFile{bytes.NewReader(content)}
+	header = &multipart.FileHeader{Filename: name, Size: int64(len(content))}
+	return
+}
+
+// Creates a new analysis from a multipart form or from a json body, depending
+// on the request content type, and returns it as json.
+//
+// Input errors are returned with http status 400 and the list of erroneous fields.
+func apiNewAnalysisHandler(w http.ResponseWriter, r *http.Request) {
+	var a *model.Analysis
+	var err error
+
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		apiErrorStatus(w, http.StatusMethodNotAllowed, errors.New("Method not allowed: "+r.Method))
+		return
+	}
+
+	if r.ContentLength > MAX_REQUEST_SIZE {
+		apiErrorStatus(w, http.StatusRequestEntityTooLarge, ErrRequestTooLarge)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, MAX_REQUEST_SIZE)
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		a, err = newAnalysisFromJson(r)
+	} else {
+		a, err = newAnalysisFromForm(r)
+	}
+
+	if err == ErrRequestTooLarge {
+		apiErrorStatus(w, http.StatusRequestEntityTooLarge, err)
+		return
+	}
+	if err != nil {
 		io.LogError(err)
-		errorHandler(w, r, err)
-		//http.Error(w, err.Error(), http.StatusInternalServerError)
+		apiErrorStatus(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	http.Redirect(w, r, "/view/"+a.Id, http.StatusSeeOther)
+	w.Header().Set("Location", "/api/analysis/"+a.Id)
+	w.WriteHeader(http.StatusCreated)
+	if err = json.NewEncoder(w).Encode(a); err != nil {
+		io.LogError(err)
+	}
 }
 
 func apiAnalysisHandler(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method == http.MethodDelete {
+		apiCancelAnalysisHandler(w, r, id)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
 	var a *model.Analysis
-	a, err := getAnalysis(id)
+	var fields []string
+	var err error
+	if f := r.URL.Query().Get("fields"); f != "" {
+		fields = strings.Split(f, ",")
+	}
+	// Alignment, result trees and logs are only read if they are requested
+	full := len(fields) == 0 || containsAny(fields, heavyAnalysisFields)
+	if full {
+		a, err = getAnalysis(id)
+	} else {
+		a, err = getAnalysisSummary(id)
+	}
 	if err != nil {
-		a = model.NewAnalysis()
-		a.Message = err.Error()
+		io.LogError(err)
+		apiErrorStatus(w, http.StatusNotFound, err)
+		return
+	}
+	if full {
+		// Result trees and logs may be in the artifact store
+		if a, err = artifact.Load(store, a); err != nil {
+			io.LogError(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if len(fields) == 0 {
+		json.NewEncoder(w).Encode(a)
+		return
+	}
+	projection, err := projectAnalysis(a, fields, nil)
+	if err != nil {
+		apiErrorStatus(w, http.StatusBadRequest, err)
+		return
+	}
+	json.NewEncoder(w).Encode(projection)
+}
+
+// Returns the analysis without its alignment, result trees and logs,
+// that are downloaded with /api/analysis/{id}/files/{name}
+func apiAnalysisSummaryHandler(w http.ResponseWriter, r *http.Request, id string) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		apiErrorStatus(w, http.StatusMethodNotAllowed, errors.New("Method not allowed: "+r.Method))
+		return
+	}
+	a, err := getAnalysisSummary(id)
+	if err != nil {
+		apiErrorStatus(w, http.StatusNotFound, err)
+		return
+	}
+	projection, err := projectAnalysis(a, nil, heavyAnalysisFields)
+	if err != nil {
+		io.LogError(err)
+		apiErrorStatus(w, http.StatusInternalServerError, err)
+		return
+	}
+	json.NewEncoder(w).Encode(projection)
+}
+
+// Json fields of the analysis holding its alignment, result trees and logs
+var heavyAnalysisFields = []string{"align", "fbptree", "tbenormtree", "tberawtree", "tbelogs"}
+
+// Returns the json fields of the analysis given in fields (all
+// fields if empty), except the fields given in omit
+func projectAnalysis(a *model.Analysis, fields, omit []string) (projection map[string]json.RawMessage, err error) {
+	var data []byte
+	var all map[string]json.RawMessage
+
+	if data, err = json.Marshal(a); err != nil {
+		return
+	}
+	if err = json.Unmarshal(data, &all); err != nil {
+		return
+	}
+	projection = all
+	if len(fields) > 0 {
+		projection = make(map[string]json.RawMessage)
+		for _, f := range fields {
+			v, ok := all[f]
+			if !ok {
+				return nil, &ValidationError{Field: "fields", Message: "Unknown field: " + f}
+			}
+			projection[f] = v
+		}
+	}
+	for _, f := range omit {
+		delete(projection, f)
+	}
+	return
+}
+
+// True if one of the values is in list
+func containsAny(values, list []string) bool {
+	for _, v := range values {
+		for _, l := range list {
+			if v == l {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Lists the analyses selected by the query parameters (see analysisFilterFromQuery),
+// without their alignments, result trees and logs, from the most recent one.
+func apiListAnalysesHandler(w http.ResponseWriter, r *http.Request) {
+	var filter database.AnalysisFilter
+	var answer ApiAnalysesResponse
+	var ok bool
+	var err error
+
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		apiErrorStatus(w, http.StatusMethodNotAllowed, errors.New("Method not allowed: "+r.Method))
+		return
+	}
+	if filter, err = analysisFilterFromQuery(r.URL.Query()); err != nil {
+		apiErrorStatus(w, http.StatusBadRequest, err)
+		return
+	}
+	if filter.Owner, ok = requestOwnerFilter(r); !ok {
+		apiErrorStatus(w, http.StatusNotFound, ErrListingDisabled)
+		return
+	}
+	if answer.Analyses, answer.Next, err = listAnalyses(filter); err != nil {
+		if err == database.ErrInvalidCursor {
+			apiErrorStatus(w, http.StatusBadRequest, &ValidationError{Field: "cursor", Message: err.Error()})
+			return
+		}
+		io.LogError(err)
+		apiErrorStatus(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err = json.NewEncoder(w).Encode(answer); err != nil {
+		io.LogError(err)
+	}
+}
+
+/*
+Builds the filter of listed analyses from the query parameters:
+  - status, workflow: codes of the statuses/workflows, comma separated or repeated
+  - runname: part of the run name
+  - email: email given at submission
+  - from, to: submission dates (YYYY-MM-DD or ISO-8601), to is inclusive for days
+  - cursor: "next" cursor returned with the previous page
+  - limit: number of analyses per page
+*/
+func analysisFilterFromQuery(q url.Values) (f database.AnalysisFilter, err error) {
+	if f.Status, err = queryInts(q, "status"); err != nil {
+		return
+	}
+	if f.Workflow, err = queryInts(q, "workflow"); err != nil {
+		return
+	}
+	f.RunName = q.Get("runname")
+	f.EMail = q.Get("email")
+	if from := q.Get("from"); from != "" {
+		if f.From, err = queryDate(from, "from"); err != nil {
+			return
+		}
+	}
+	if to := q.Get("to"); to != "" {
+		if f.To, err = queryDate(to, "to"); err != nil {
+			return
+		}
+		// A day is included in the range
+		if len(to) == len("2006-01-02") {
+			f.To = f.To.AddDate(0, 0, 1)
+		}
+	}
+	f.Cursor = q.Get("cursor")
+	if limit := q.Get("limit"); limit != "" {
+		if f.Limit, err = strconv.Atoi(limit); err != nil || f.Limit <= 0 {
+			err = &ValidationError{Field: "limit", Message: "limit must be a positive integer"}
+			return
+		}
+	}
+	return
+}
+
+// Integer values of a query parameter, given comma separated or repeated
+func queryInts(q url.Values, name string) (values []int, err error) {
+	var v int
+	for _, param := range q[name] {
+		for _, s := range strings.Split(param, ",") {
+			if s = strings.TrimSpace(s); s == "" {
+				continue
+			}
+			if v, err = strconv.Atoi(s); err != nil {
+				err = &ValidationError{Field: name, Message: fmt.Sprintf("Wrong %s code: %s", name, s)}
+				return
+			}
+			values = append(values, v)
+		}
+	}
+	return
+}
+
+// Date given as YYYY-MM-DD (local time), or in ISO-8601 format
+func queryDate(s, name string) (t time.Time, err error) {
+	if t, err = time.ParseInLocation("2006-01-02", s, time.Local); err != nil {
+		if t, err = time.Parse(time.RFC3339, s); err != nil {
+			err = &ValidationError{Field: name, Message: fmt.Sprintf("Wrong %s date: %s", name, s)}
+		}
+	}
+	return
+}
+
+func containsInt(values []int, v int) bool {
+	for _, val := range values {
+		if val == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Streams a file of the analysis (alignment, result trees or logs)
+// from the artifact store.
+//
+// Only the summary of the analysis is read if the file is in the
+// store. The whole analysis is read otherwise: without store, or for
+// analyses stored before the store was configured.
+func apiAnalysisFileHandler(w http.ResponseWriter, r *http.Request, id, name string) {
+	var a *model.Analysis
+	var f goio.ReadCloser
+	var err error
+
+	if !artifact.ValidName(name) {
+		http.NotFound(w, r)
+		return
+	}
+	if a, err = getAnalysisSummary(id); err != nil {
+		io.LogError(err)
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if f, err = artifact.Open(store, a, name); err == artifact.ErrNotFound {
+		if a, err = getAnalysis(id); err == nil {
+			f, err = artifact.Open(nil, a, name)
+		}
+	}
+	if err != nil {
+		if err == artifact.ErrNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
 		io.LogError(err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	json.NewEncoder(w).Encode(a)
+	defer f.Close()
+
+	w.Header().Set("Content-Type", artifact.ContentType(name))
+	w.Header().Set("Content-Disposition", "attachment; filename=\"boosterweb_"+id+"_"+name+"\"")
+	if _, err = goio.Copy(w, f); err != nil {
+		io.LogError(err)
+	}
+}
+
+// Streams the events of the analysis (Server-Sent Events): a first status
+// event with its current state, then the status and progress events
+// published by the processor, until the analysis is over.
+//
+// Each event gives the whole state: status, statusstr, nboot and message.
+func apiAnalysisEventsHandler(w http.ResponseWriter, r *http.Request, id string) {
+	var a *model.Analysis
+	var err error
+
+	if r.Method != http.MethodGet {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Allow", http.MethodGet)
+		apiErrorStatus(w, http.StatusMethodNotAllowed, errors.New("Method not allowed: "+r.Method))
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		apiErrorStatus(w, http.StatusInternalServerError, errors.New("Streaming not supported"))
+		return
+	}
+
+	// We subscribe before reading the analysis, not to miss events in between
+	evts, cancel := bus.Subscribe(id)
+	defer cancel()
+	if a, err = getAnalysisSummary(id); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		apiErrorStatus(w, http.StatusNotFound, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	last := events.NewStatusEvent(a)
+	if err = writeEvent(w, flusher, last); err != nil || last.Final() {
+		return
+	}
+
+	heartbeat := time.NewTicker(EVENTS_HEARTBEAT)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err = fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case e := <-evts:
+			// Completes the event with the last known state
+			if e.Type == events.EVENT_PROGRESS {
+				e.Status, e.StatusStr, e.Message = last.Status, last.StatusStr, last.Message
+			}
+			if e.Nboot < 0 {
+				e.Nboot = last.Nboot
+			}
+			if err = writeEvent(w, flusher, e); err != nil || e.Final() {
+				return
+			}
+			last = e
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, flusher http.Flusher, e events.Event) (err error) {
+	var data []byte
+	if data, err = json.Marshal(e); err != nil {
+		return
+	}
+	if _, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data); err != nil {
+		return
+	}
+	flusher.Flush()
+	return
+}
+
+// Cancels a pending or running analysis, and returns it with its
+// new status, without its alignment, result trees and logs
+func apiCancelAnalysisHandler(w http.ResponseWriter, r *http.Request, id string) {
+	var a *model.Analysis
+	var projection map[string]json.RawMessage
+	var err error
+
+	w.Header().Set("Content-Type", "application/json")
+	if _, err = getAnalysisSummary(id); err != nil {
+		io.LogError(err)
+		apiErrorStatus(w, http.StatusNotFound, err)
+		return
+	}
+
+	if err = proc.CancelAnalysis(id); err != nil {
+		io.LogError(err)
+		code := http.StatusInternalServerError
+		if err == processor.ErrNotCancelable {
+			code = http.StatusConflict
+		}
+		apiErrorStatus(w, code, err)
+		return
+	}
+
+	if a, err = getAnalysisSummary(id); err != nil {
+		io.LogError(err)
+		apiErrorStatus(w, http.StatusInternalServerError, err)
+		return
+	}
+	if projection, err = projectAnalysis(a, nil, heavyAnalysisFields); err != nil {
+		io.LogError(err)
+		apiErrorStatus(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err = json.NewEncoder(w).Encode(projection); err != nil {
+		io.LogError(err)
+	}
 }
 
 func apiStatus(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	a := &struct{ Status string }{"OK"}
+	a := &struct {
+		Status  string
+		Running int
+	}{"OK", len(proc.RunningAnalyses())}
 	json.NewEncoder(w).Encode(a)
 }
 
@@ -313,18 +1000,23 @@ func apiImageHandler(w http.ResponseWriter, r *http.Request, id string, collapse
 		http.Error(w, e.Error(), http.StatusInternalServerError)
 		return
 	}
-	if a.TbeNormTree == "" {
+	name := artifact.TBE_NORM_TREE
+	if algorithm == "fbp" {
+		name = artifact.FBP_TREE
+	}
+	todraw, err := artifact.Read(store, a, name)
+	if err != nil {
+		io.LogError(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if todraw == "" {
 		e := errors.New("Cannot draw image for an empty resulting tree")
 		io.LogError(e)
 		http.Error(w, e.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	todraw := a.TbeNormTree
-	if algorithm == "fbp" {
-		todraw = a.FbpTree
-	}
-
 	t, err := newick.NewParser(strings.NewReader(todraw)).Parse()
 	if err != nil {
 		io.LogError(err)
@@ -422,6 +1114,101 @@ func makeApiAnalysisHandler(fn func(http.ResponseWriter, *http.Request, string))
 	}
 }
 
+// URL of the form:
+// /api/analysis/analysisid/bundle
+var validApiAnalysisBundlePath = regexp.MustCompile("^/api/analysis/([-a-zA-Z0-9]+)/bundle$")
+
+func makeApiAnalysisBundleHandler(fn func(http.ResponseWriter, *http.Request, string)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		m := validApiAnalysisBundlePath.FindStringSubmatch(r.URL.Path)
+		if m == nil {
+			http.NotFound(w, r)
+			return
+		}
+		fn(w, r, m[1])
+	}
+}
+
+// URL of the form:
+// /api/analysis/analysisid/export/(nexus|phyloxml|nhx)
+var validApiAnalysisExportPath = regexp.MustCompile("^/api/analysis/([-a-zA-Z0-9]+)/export/(nexus|phyloxml|nhx)$")
+
+func makeApiAnalysisExportHandler(fn func(http.ResponseWriter, *http.Request, string, string)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		m := validApiAnalysisExportPath.FindStringSubmatch(r.URL.Path)
+		if m == nil {
+			http.NotFound(w, r)
+			return
+		}
+		fn(w, r, m[1], m[2])
+	}
+}
+
+// URL of the form:
+// /api/analysis/analysisid/summary
+var validApiAnalysisSummaryPath = regexp.MustCompile("^/api/analysis/([-a-zA-Z0-9]+)/summary$")
+
+func makeApiAnalysisSummaryHandler(fn func(http.ResponseWriter, *http.Request, string)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		m := validApiAnalysisSummaryPath.FindStringSubmatch(r.URL.Path)
+		if m == nil {
+			http.NotFound(w, r)
+			return
+		}
+		fn(w, r, m[1])
+	}
+}
+
+// URL of the form:
+// /api/analysis/analysisid/events
+var validApiAnalysisEventsPath = regexp.MustCompile("^/api/analysis/([-a-zA-Z0-9]+)/events$")
+
+func makeApiAnalysisEventsHandler(fn func(http.ResponseWriter, *http.Request, string)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		m := validApiAnalysisEventsPath.FindStringSubmatch(r.URL.Path)
+		if m == nil {
+			http.NotFound(w, r)
+			return
+		}
+		fn(w, r, m[1])
+	}
+}
+
+// URL of the form:
+// /api/analysis/analysisid/files/filename
+var validApiAnalysisFilePath = regexp.MustCompile("^/api/analysis/([-a-zA-Z0-9]+)/files/([-a-zA-Z0-9_.]+)$")
+
+func makeApiAnalysisFileHandler(fn func(http.ResponseWriter, *http.Request, string, string)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		m := validApiAnalysisFilePath.FindStringSubmatch(r.URL.Path)
+		if m == nil {
+			http.NotFound(w, r)
+			return
+		}
+		fn(w, r, m[1], m[2])
+	}
+}
+
+// Handler of the URLs matching path, see makeApiRouter
+type apiRoute struct {
+	path    *regexp.Regexp
+	handler http.HandlerFunc
+}
+
+// Dispatches the requests sharing a common prefix (ex: /api/analysis/)
+// to the handler of the first route whose path matches
+func makeApiRouter(routes ...apiRoute) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for _, route := range routes {
+			if route.path.MatchString(r.URL.Path) {
+				route.handler(w, r)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	}
+}
+
 // URL of the form:
 // /api/image/analysisid/bootstrapcutoff/treelayout/imageformat
 var validApiImagePath = regexp.MustCompile("^/api/image/([-a-zA-Z0-9]+)/([0-9]+)/(circular|radial|normal)/(fbp|tbe)/(svg|png)$")
@@ -471,6 +1258,26 @@ func apiError(res http.ResponseWriter, err error) {
 	}
 }
 
+// Writes an ApiErrorResponse with the given http status code.
+//
+// If err is a *ValidationError, the status code is replaced by
+// http.StatusBadRequest and the error is listed in the response.
+func apiErrorStatus(res http.ResponseWriter, code int, err error) {
+	answer := ApiErrorResponse{
+		Status:  1,
+		Message: err.Error(),
+	}
+	var verr *ValidationError
+	if errors.As(err, &verr) {
+		code = http.StatusBadRequest
+		answer.Errors = []*ValidationError{verr}
+	}
+	res.WriteHeader(code)
+	if err := json.NewEncoder(res).Encode(answer); err != nil {
+		io.LogError(err)
+	}
+}
+
 func generateRunName() string {
 	return utils.GenerateRandomName()
 }
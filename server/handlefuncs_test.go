@@ -0,0 +1,385 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/evolbioinfo/booster-web/artifact"
+	"github.com/evolbioinfo/booster-web/events"
+	"github.com/evolbioinfo/booster-web/model"
+)
+
+func TestParseNboot(t *testing.T) {
+	if n, err := parseNboot(" 100 ", true); err != nil || n != 100 {
+		t.Errorf("parseNboot(100): %d, %v", n, err)
+	}
+	if n, err := parseNboot("", false); err != nil || n != 0 {
+		t.Errorf("parseNboot without alignment: %d, %v", n, err)
+	}
+	if _, err := parseNboot("abc", true); err == nil {
+		t.Error("parseNboot(abc) with alignment should fail")
+	} else if verr, ok := err.(*ValidationError); !ok || verr.Field != "nboot" {
+		t.Errorf("parseNboot(abc): expected a nboot validation error, got %v", err)
+	}
+}
+
+func TestJsonString(t *testing.T) {
+	for raw, exp := range map[string]string{`100`: "100", `"100"`: "100", `null`: "", ``: ""} {
+		if s := jsonString(json.RawMessage(raw)); s != exp {
+			t.Errorf("jsonString(%s): expected %q, got %q", raw, exp, s)
+		}
+	}
+}
+
+// Reader of n times the same byte
+type repeatReader struct {
+	b byte
+	n int64
+}
+
+func (r *repeatReader) Read(p []byte) (n int, err error) {
+	if r.n <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.n {
+		p = p[:r.n]
+	}
+	for i := range p {
+		p[i] = r.b
+	}
+	r.n -= int64(len(p))
+	return len(p), nil
+}
+
+// Body with a file content larger than MAX_REQUEST_SIZE, of unknown length
+func oversizedBody(prefix, suffix string) io.Reader {
+	return io.MultiReader(strings.NewReader(prefix), &repeatReader{'A', MAX_REQUEST_SIZE}, strings.NewReader(suffix))
+}
+
+func TestApiNewAnalysisValidation(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  io.Reader
+		ctype string
+		size  int64
+		code  int
+	}{
+		{"nboot not a number", strings.NewReader(`{"refalign": {"content": ">s1\nACGT\n"}, "workflow": "FastTree", "nboot": "abc"}`), "application/json", 0, http.StatusBadRequest},
+		{"nboot array", strings.NewReader(`{"refalign": {"content": ">s1\nACGT\n"}, "workflow": "FastTree", "nboot": [1]}`), "application/json", 0, http.StatusBadRequest},
+		{"no bootstrap trees", strings.NewReader(`{"reftree": {"content": "(A,B,C);"}}`), "application/json", 0, http.StatusBadRequest},
+		{"malformed json", strings.NewReader(`{"refalign"`), "application/json", 0, http.StatusBadRequest},
+		{"declared size too large", strings.NewReader(`{}`), "application/json", MAX_REQUEST_SIZE + 1, http.StatusRequestEntityTooLarge},
+		{"json body too large", oversizedBody(`{"reftree": {"content": "`, `"}}`), "application/json", 0, http.StatusRequestEntityTooLarge},
+		{"form body too large",
+			oversizedBody("--b\r\nContent-Disposition: form-data; name=\"reftree\"; filename=\"ref.nw\"\r\n\r\n", "\r\n--b--\r\n"),
+			"multipart/form-data; boundary=b", 0, http.StatusRequestEntityTooLarge},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/api/analysis", test.body)
+		r.Header.Set("Content-Type", test.ctype)
+		if test.size > 0 {
+			r.ContentLength = test.size
+		}
+		w := httptest.NewRecorder()
+		apiNewAnalysisHandler(w, r)
+		if w.Code != test.code {
+			t.Errorf("%s: expected status %d, got %d (%s)", test.name, test.code, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestApiListAnalyses(t *testing.T) {
+	newTestDB(t)
+	day := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		owner := "u1"
+		if i%2 == 1 {
+			owner = "u2"
+		}
+		insertTestAnalysis(t, fmt.Sprintf("a%d", i), owner, day.Add(time.Duration(i)*time.Hour))
+	}
+	user := Claims{Username: "user1", UserId: "u1", Role: model.ROLE_USER}
+	admin := Claims{Username: "admin", UserId: "admin", Role: model.ROLE_ADMIN}
+
+	list := func(query string, claims *Claims) (code int, answer ApiAnalysesResponse) {
+		r := httptest.NewRequest(http.MethodGet, "/api/analyses?"+query, nil)
+		if claims != nil {
+			r = withClaims(r, *claims)
+		}
+		w := httptest.NewRecorder()
+		apiListAnalysesHandler(w, r)
+		if w.Code == http.StatusOK {
+			if err := json.NewDecoder(w.Body).Decode(&answer); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return w.Code, answer
+	}
+	ids := func(answer ApiAnalysesResponse) (ids []string) {
+		for _, a := range answer.Analyses {
+			ids = append(ids, a.Id)
+		}
+		return
+	}
+
+	// Without authentication, analyses are not listed, nor searched by email
+	if code, _ := list("", nil); code != http.StatusNotFound {
+		t.Errorf("Expected 404 without authentication, got %d", code)
+	}
+	if code, _ := list("email=u2@example.org", nil); code != http.StatusNotFound {
+		t.Errorf("Expected 404 without authentication, got %d", code)
+	}
+
+	// Users only list their own analyses, page by page
+	var all []string
+	query := "limit=2"
+	for {
+		code, answer := list(query, &user)
+		if code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", code)
+		}
+		all = append(all, ids(answer)...)
+		if answer.Next == "" {
+			break
+		}
+		query = "limit=2&cursor=" + answer.Next
+	}
+	if fmt.Sprint(all) != "[a4 a2 a0]" {
+		t.Errorf("Expected the analyses of user u1, got %v", all)
+	}
+	if _, answer := list("email=u2@example.org", &user); len(answer.Analyses) != 0 {
+		t.Errorf("Users should not find analyses of others by email, got %v", ids(answer))
+	}
+
+	// Admins list all analyses
+	if _, answer := list("", &admin); fmt.Sprint(ids(answer)) != "[a4 a3 a2 a1 a0]" {
+		t.Errorf("Expected all analyses for admins, got %v", ids(answer))
+	}
+	if _, answer := list("email=u2@example.org", &admin); fmt.Sprint(ids(answer)) != "[a3 a1]" {
+		t.Errorf("Expected the analyses of u2 by email, got %v", ids(answer))
+	}
+
+	if code, _ := list("cursor=invalid", &admin); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid cursor, got %d", code)
+	}
+}
+
+func TestProjectAnalysis(t *testing.T) {
+	a := model.NewAnalysis()
+	a.Id = "a1"
+	a.JobId = "job"
+	a.GalaxyHistory = "history"
+	a.TbeNormTree = "(A,B,C);"
+
+	p, err := projectAnalysis(a, []string{"id", "jobid", "galaxyhistory"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(p["jobid"]) != `"job"` || string(p["galaxyhistory"]) != `"history"` || len(p) != 3 {
+		t.Errorf("Wrong projection %s", p)
+	}
+	if _, err = projectAnalysis(a, []string{"JobId"}, nil); err == nil {
+		t.Error("Expected fields to be given by their json name")
+	}
+	if p, err = projectAnalysis(a, nil, heavyAnalysisFields); err != nil || p["tbenormtree"] != nil || p["id"] == nil {
+		t.Errorf("Expected all fields but the heavy ones, got %s (%v)", p, err)
+	}
+}
+
+func TestApiAnalysis(t *testing.T) {
+	newTestDB(t)
+	insertFinishedAnalysis(t, "finished")
+
+	w := httptest.NewRecorder()
+	apiAnalysisHandler(w, httptest.NewRequest(http.MethodGet, "/api/analysis/unknown", nil), "unknown")
+	var answer GenericResponse
+	if err := json.NewDecoder(w.Body).Decode(&answer); w.Code != http.StatusNotFound || err != nil {
+		t.Errorf("Unknown analysis: expected a json 404, got %d %v", w.Code, err)
+	}
+
+	// Canceled analyses are returned without their trees
+	proc = cancelingProcessor{}
+	defer func() { proc = nil }()
+	insertTestAnalysis(t, "pending", "u1", time.Now())
+	db = summaryOnlyDB{db}
+	w = httptest.NewRecorder()
+	apiAnalysisHandler(w, httptest.NewRequest(http.MethodDelete, "/api/analysis/pending", nil), "pending")
+	var canceled map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&canceled); w.Code != http.StatusOK || err != nil {
+		t.Fatalf("Expected the canceled analysis, got %d %v", w.Code, err)
+	}
+	if _, ok := canceled["tbenormtree"]; ok || canceled["status"] != float64(model.STATUS_CANCELED) {
+		t.Errorf("Expected the summary of the canceled analysis, got %v", canceled)
+	}
+}
+
+func TestApiAnalysisFile(t *testing.T) {
+	newTestDB(t)
+	a := insertFinishedAnalysis(t, "old")
+	get := func(name string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		apiAnalysisFileHandler(w, httptest.NewRequest(http.MethodGet, "/api/analysis/old/files/"+name, nil), "old", name)
+		return w
+	}
+
+	// Without store, files are in the database
+	if w := get(artifact.TBE_NORM_TREE); w.Code != http.StatusOK || w.Body.String() != a.TbeNormTree {
+		t.Errorf("Expected the tree of the database, got %d %q", w.Code, w.Body.String())
+	}
+	if w := get(artifact.ALIGNMENT); w.Code != http.StatusNotFound {
+		t.Errorf("Missing file: expected 404, got %d", w.Code)
+	}
+
+	// Files of analyses stored before the store are still in the database
+	var err error
+	if store, err = artifact.NewLocalStore(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { store = nil }()
+	if w := get(artifact.TBE_NORM_TREE); w.Code != http.StatusOK || w.Body.String() != a.TbeNormTree {
+		t.Errorf("Expected the tree of the database, got %d %q", w.Code, w.Body.String())
+	}
+
+	// Files in the store are read without the whole analysis
+	b := insertFinishedAnalysis(t, "stored")
+	if err = artifact.Save(store, b, artifact.TBE_NORM_TREE, "(A,B,C);"); err != nil {
+		t.Fatal(err)
+	}
+	db = summaryOnlyDB{db}
+	w := httptest.NewRecorder()
+	apiAnalysisFileHandler(w, httptest.NewRequest(http.MethodGet, "/api/analysis/stored/files/tbe_norm.nh", nil), "stored", artifact.TBE_NORM_TREE)
+	if w.Code != http.StatusOK || w.Body.String() != "(A,B,C);" {
+		t.Errorf("Expected the tree of the store, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+// Reads the server sent events of the stream until it ends
+func readEvents(t *testing.T, stream *bufio.Reader, n int) (names []string, evts []events.Event) {
+	var name string
+	for len(evts) < n {
+		line, err := stream.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading event %d: %v", len(evts), err)
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			var e events.Event
+			if err = json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e); err != nil {
+				t.Fatal(err)
+			}
+			names = append(names, name)
+			evts = append(evts, e)
+		}
+	}
+	return
+}
+
+func TestApiAnalysisEvents(t *testing.T) {
+	newTestDB(t)
+	finished := insertTestAnalysis(t, "finished", "u1", time.Now())
+	finished.Status = model.STATUS_FINISHED
+	running := insertTestAnalysis(t, "running", "u1", time.Now())
+	running.Status = model.STATUS_RUNNING
+	running.Nboot = 2
+	for _, a := range []*model.Analysis{finished, running} {
+		if err := db.UpdateAnalysis(a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiAnalysisEventsHandler(w, r, strings.TrimPrefix(r.URL.Path, "/"))
+	}))
+	defer server.Close()
+
+	for _, test := range []struct {
+		name    string
+		method  string
+		id      string
+		code    int
+		publish []events.Event // Published once the current state is received
+		names   []string       // Names of the streamed events
+		events  []events.Event // Streamed events, the first one is the current state
+	}{
+		{name: "not a get", method: http.MethodPost, id: "running", code: http.StatusMethodNotAllowed},
+		{name: "unknown analysis", method: http.MethodGet, id: "unknown", code: http.StatusNotFound},
+		{name: "finished analysis", method: http.MethodGet, id: "finished", code: http.StatusOK,
+			names:  []string{"status"},
+			events: []events.Event{{Id: "finished", Status: model.STATUS_FINISHED, StatusStr: "Finished"}},
+		},
+		{name: "running analysis", method: http.MethodGet, id: "running", code: http.StatusOK,
+			publish: []events.Event{
+				{Type: events.EVENT_PROGRESS, Id: "running", Nboot: 5},
+				{Type: events.EVENT_STATUS, Id: "running", Status: model.STATUS_FINISHED, StatusStr: "Finished", Nboot: -1},
+			},
+			names: []string{"status", "progress", "status"},
+			events: []events.Event{
+				{Id: "running", Status: model.STATUS_RUNNING, StatusStr: "Running", Nboot: 2},
+				{Id: "running", Status: model.STATUS_RUNNING, StatusStr: "Running", Nboot: 5},
+				{Id: "running", Status: model.STATUS_FINISHED, StatusStr: "Finished", Nboot: 5},
+			},
+		},
+	} {
+		r, err := http.NewRequest(test.method, server.URL+"/"+test.id, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != test.code {
+			t.Errorf("%s: expected status %d, got %d", test.name, test.code, resp.StatusCode)
+		}
+		if test.code == http.StatusOK {
+			stream := bufio.NewReader(resp.Body)
+			names, evts := readEvents(t, stream, 1)
+			for _, e := range test.publish {
+				bus.Publish(e)
+			}
+			moreNames, moreEvts := readEvents(t, stream, len(test.events)-1)
+			names, evts = append(names, moreNames...), append(evts, moreEvts...)
+			if !reflect.DeepEqual(names, test.names) || !reflect.DeepEqual(evts, test.events) {
+				t.Errorf("%s: expected events %v %v, got %v %v", test.name, test.names, test.events, names, evts)
+			}
+			// The stream ends after the final event
+			if rest, err := io.ReadAll(stream); err != nil || strings.TrimSpace(string(rest)) != "" {
+				t.Errorf("%s: expected the end of the stream, got %q (%v)", test.name, rest, err)
+			}
+		}
+		resp.Body.Close()
+	}
+}
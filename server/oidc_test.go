@@ -0,0 +1,240 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/evolbioinfo/booster-web/auth"
+	"github.com/evolbioinfo/booster-web/model"
+)
+
+// OpenID Connect identity provider, authenticating one user
+type mockIdP struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	claims jwt.MapClaims // Claims of the next id token, iss, aud, exp and iat apart
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &mockIdP{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                idp.server.URL,
+			"authorization_endpoint":                idp.server.URL + "/auth",
+			"token_endpoint":                        idp.server.URL + "/token",
+			"jwks_uri":                              idp.server.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"alg": "RS256",
+				"use": "sig",
+				"kid": "test",
+				"n":   base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.PublicKey.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "code" {
+			http.Error(w, `{"error": "invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		claims := jwt.MapClaims{
+			"iss": idp.server.URL,
+			"aud": "booster-web",
+			"exp": time.Now().Add(time.Hour).Unix(),
+			"iat": time.Now().Unix(),
+		}
+		for k, v := range idp.claims {
+			claims[k] = v
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "test"
+		idtoken, err := token.SignedString(key)
+		if err != nil {
+			t.Error(err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     idtoken,
+		})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+// Starts the login on the provider: returns the state and nonce
+// given to the provider, and the cookies of the browser
+func startOIDCLogin(t *testing.T) (state, nonce string, cookies []*http.Cookie) {
+	w := httptest.NewRecorder()
+	oidcLogin(w, httptest.NewRequest(http.MethodGet, "/oidc/login", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("Expected a redirection to the provider, got %d", w.Code)
+	}
+	loc, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc.Query().Get("state"), loc.Query().Get("nonce"), w.Result().Cookies()
+}
+
+// Returns from the provider, and returns the session cookie (nil if the login failed)
+func finishOIDCLogin(t *testing.T, state string, cookies []*http.Cookie) *http.Cookie {
+	r := httptest.NewRequest(http.MethodGet, "/oidc/callback?code=code&state="+url.QueryEscape(state), nil)
+	for _, c := range cookies {
+		r.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	oidcCallback(w, r)
+	for _, c := range w.Result().Cookies() {
+		if c.Name == "Auth" && c.Value != "" {
+			return c
+		}
+	}
+	return nil
+}
+
+func TestOIDCLogin(t *testing.T) {
+	newTestDB(t)
+	idp := newMockIdP(t)
+	oidcAuthenticator := func(loginclaim string) auth.Authenticator {
+		a, err := auth.NewOIDCAuthenticator(context.Background(), idp.server.URL, "booster-web", "secret",
+			"https://booster.example.org/oidc/callback", nil, loginclaim, nil, db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return a
+	}
+	authenticator = oidcAuthenticator("preferred_username")
+	defer func() { authenticator = nil }()
+
+	// The state and the nonce are independent
+	state, nonce, cookies := startOIDCLogin(t)
+	if state == "" || nonce == "" || state == nonce {
+		t.Fatalf("Expected a state and a different nonce, got %q and %q", state, nonce)
+	}
+
+	// Login, the account is created with the claims of the id token
+	idp.claims = jwt.MapClaims{"sub": "248289761001", "preferred_username": "alice", "nonce": nonce}
+	session := finishOIDCLogin(t, state, cookies)
+	if session == nil {
+		t.Fatal("Expected a session after login")
+	}
+	claims, err := parseToken(session.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := db.GetUserBySubject(model.PROVIDER_OIDC, "248289761001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Login != "alice" || claims.UserId != u.Id || claims.Username != "alice" {
+		t.Errorf("Wrong account %+v for claims %+v", u, claims)
+	}
+
+	// Wrong state
+	state, nonce, cookies = startOIDCLogin(t)
+	idp.claims["nonce"] = nonce
+	if finishOIDCLogin(t, "other state", cookies) != nil {
+		t.Error("Login with a wrong state should fail")
+	}
+	if finishOIDCLogin(t, state, nil) != nil {
+		t.Error("Login without the state cookie should fail")
+	}
+
+	// Wrong nonce: replayed id token, or nonce of another login
+	state, _, cookies = startOIDCLogin(t)
+	if finishOIDCLogin(t, state, cookies) != nil {
+		t.Error("Login with the nonce of a previous login should fail")
+	}
+	state, nonce, cookies = startOIDCLogin(t)
+	delete(idp.claims, "nonce")
+	if finishOIDCLogin(t, state, cookies) != nil {
+		t.Error("Login without nonce should fail")
+	}
+
+	// The login claim is mandatory if it is configured
+	state, nonce, cookies = startOIDCLogin(t)
+	idp.claims = jwt.MapClaims{"sub": "248289761002", "nonce": nonce}
+	if finishOIDCLogin(t, state, cookies) != nil {
+		t.Error("Login without the login claim should fail")
+	}
+
+	// The account is found by subject, the login of a local
+	// account cannot be taken by changing its claim
+	local, _ := model.NewUser("local", "admin", model.ROLE_ADMIN)
+	local.SetPassword("secret")
+	if err = db.UpdateUser(local); err != nil {
+		t.Fatal(err)
+	}
+	state, nonce, cookies = startOIDCLogin(t)
+	idp.claims = jwt.MapClaims{"sub": "248289761001", "preferred_username": "admin", "nonce": nonce}
+	if session = finishOIDCLogin(t, state, cookies); session == nil {
+		t.Fatal("Expected a session after login")
+	}
+	if claims, err = parseToken(session.Value); err != nil || claims.UserId != u.Id || claims.Role != model.ROLE_USER {
+		t.Errorf("Expected the account of the subject, got %+v (%v)", claims, err)
+	}
+	state, nonce, cookies = startOIDCLogin(t)
+	idp.claims = jwt.MapClaims{"sub": "248289761003", "preferred_username": "admin", "nonce": nonce}
+	if finishOIDCLogin(t, state, cookies) != nil {
+		t.Error("A new user should not log in the local account having its login")
+	}
+
+	// Without login claim, the login is the subject
+	authenticator = oidcAuthenticator("")
+	state, nonce, cookies = startOIDCLogin(t)
+	idp.claims = jwt.MapClaims{"sub": "248289761004", "preferred_username": "admin", "nonce": nonce}
+	if finishOIDCLogin(t, state, cookies) == nil {
+		t.Fatal("Expected a session after login")
+	}
+	if u, err = db.GetUserBySubject(model.PROVIDER_OIDC, "248289761004"); err != nil || u.Login != "248289761004" {
+		t.Errorf("Expected the subject as login, got %+v (%v)", u, err)
+	}
+}
@@ -26,6 +26,7 @@ package server
 import (
 	"bufio"
 	"compress/gzip"
+	"context"
 	"errors"
 	"fmt"
 	"html/template"
@@ -44,13 +45,17 @@ import (
 	uuid "github.com/nu7hatch/gouuid"
 	"github.com/russross/blackfriday"
 
+	"github.com/evolbioinfo/booster-web/artifact"
+	"github.com/evolbioinfo/booster-web/auth"
 	"github.com/evolbioinfo/booster-web/config"
 	"github.com/evolbioinfo/booster-web/database"
+	"github.com/evolbioinfo/booster-web/events"
 	"github.com/evolbioinfo/booster-web/model"
 	"github.com/evolbioinfo/booster-web/notification"
 	"github.com/evolbioinfo/booster-web/processor"
 	"github.com/evolbioinfo/booster-web/static"
 	"github.com/evolbioinfo/booster-web/templates"
+	"github.com/evolbioinfo/booster-web/workflow"
 	"github.com/evolbioinfo/goalign/align"
 	"github.com/evolbioinfo/goalign/io/fasta"
 	"github.com/evolbioinfo/goalign/io/phylip"
@@ -62,7 +67,9 @@ import (
 
 const (
 	DATABASE_TYPE_DEFAULT = "memory"
-	HTTP_PORT_DEFAULT     = 8080 // Port 8080
+	HTTP_PORT_DEFAULT     = 8080             // Port 8080
+	EVENTS_HEARTBEAT      = 30 * time.Second // Comment sent on idle event streams, to keep connections open
+	MAX_REQUEST_SIZE      = 128 << 20        // Max size of an analysis submission (files are inline in json submissions)
 )
 
 var templatePath string
@@ -73,6 +80,8 @@ var db database.BoosterwebDB
 
 var proc processor.Processor
 
+var bus = events.NewBus() // Events of analyses published by the processor
+
 var uuids chan string // channel of uuids generated by a go routine
 
 var logfile *os.File = nil
@@ -82,6 +91,10 @@ var emailNotifier notification.Notifier
 var iTOLKey string     // Key of iTOL user
 var iTOLProject string // iTOL Project to which upload the trees
 
+var workDir string // Directory where analysis input files are stored, system temp dir if empty
+
+var store artifact.Store // Store of alignments, result trees and logs, nil: kept in the database
+
 var galaxyprocessor bool // if the processor is a galaxyprocessor
 var emailnotification bool
 
@@ -90,12 +103,51 @@ var emailnotification bool
 // runners.nbrunners: Max number of parallel running jobs (default 1)
 // runners.timeout for each running job in Seconds (default 0=unlimited)
 // runners.jobthreads : Number of cpus per bootstrap runner
-// database.type: mysql or memory (default memory)
-// database.user: user to connect to mysql if type is mysql
-// database.host: host to connect to mysql if type is mysql
-// database.port: port to connect to mysql if type is mysql
-// database.pass: pass to connect to mysql if type is mysql
-// database.dbname: name of db to connect to mysql if type is mysql
+// runners.workdir : Directory where input files are kept until analyses are run (default system temp dir)
+// runners.fasttree : FastTree executable, to run the FastTree workflow with the local processor (default none)
+// runners.phyml : PhyML-SMS executable (sms.sh), to run the PhyML-SMS workflow with the local processor (default none)
+// runners.iqtree : IQ-TREE 2 executable, to run the IQ-TREE workflow with the local processor (default none)
+// runners.raxmlng : RAxML-NG executable, to run the RAxML-NG workflow with the local processor (default none)
+// database.type: mysql, postgres, sqlite or memory (default memory)
+// database.user: user to connect to mysql/postgres if type is mysql or postgres
+// database.host: host to connect to mysql/postgres if type is mysql or postgres
+// database.port: port to connect to mysql/postgres if type is mysql or postgres
+// database.pass: pass to connect to mysql/postgres if type is mysql or postgres
+// database.dbname: name of db to connect to mysql/postgres if type is mysql or postgres
+// database.sslmode: ssl mode of the postgres connection (disable, require, verify-ca, verify-full) if type is postgres
+// database.file: path to the database file if type is sqlite
+// artifacts.type: local or s3 (default none: alignments, result trees and logs are kept in the database)
+// artifacts.dir: directory of the artifacts if type is local
+// artifacts.endpoint: url of the s3 server if type is s3 (ex: https://s3.eu-west-3.amazonaws.com)
+// artifacts.region: region of the bucket if type is s3 (default us-east-1)
+// artifacts.bucket: bucket of the artifacts if type is s3
+// artifacts.prefix: prefix of the object keys if type is s3 (default none)
+// artifacts.accesskey: access key if type is s3
+// artifacts.secretkey: secret key if type is s3
+// authentication.enabled: true to activate authentication with the user accounts of the database (default false)
+// authentication.user: login of an admin account created at startup, activates authentication
+// authentication.password: password of this admin account
+// authentication.key: secret signing the tokens (HS256), random if not given (tokens are invalidated at restart)
+// authentication.keyfile: PEM file of a RSA private key signing the tokens (RS256), instead of authentication.key
+// authentication.issuer: issuer of the tokens (default booster.c3bi.pasteur.fr)
+// authentication.sessionlifetime: lifetime of the web interface session (default 1h)
+// authentication.tokenlifetime: lifetime of the api tokens (default 10h)
+// authentication.refreshlimit: tokens are not refreshed after this time since login (default 168h)
+// authentication.provider: static (user accounts of the database, default), ldap or oidc (activate authentication)
+// authentication.admins: logins given the admin role at their login with ldap or oidc
+// authentication.ldap.url: url of the ldap server (ldap://host:389 or ldaps://host:636)
+// authentication.ldap.starttls: true to use StartTLS with a ldap:// url (default false)
+// authentication.ldap.userdn: dn of the users, %s being the login (ex: uid=%s,ou=people,dc=example,dc=org)
+// authentication.ldap.basedn: base dn to search users in, if userdn is not given
+// authentication.ldap.filter: filter to search users, %s being the login (ex: (uid=%s))
+// authentication.ldap.binddn: dn of the account searching users (default anonymous search)
+// authentication.ldap.bindpassword: password of the account searching users
+// authentication.oidc.issuer: issuer url of the OpenID Connect provider
+// authentication.oidc.clientid: client id of booster-web at the provider
+// authentication.oidc.clientsecret: client secret of booster-web at the provider
+// authentication.oidc.redirecturl: url of the booster-web callback (ex: https://booster.example.org/oidc/callback)
+// authentication.oidc.scopes: scopes requested to the provider (default ["openid", "profile", "email"])
+// authentication.oidc.loginclaim: claim of the id token giving the login (default: sub, the id of the user at the provider)
 // logging.logfile : path to log file: stdout, stderr or any file name (default stderr)
 func InitServer(cfg config.Provider) {
 	initLog(cfg)
@@ -136,51 +188,63 @@ func InitServer(cfg config.Provider) {
 	if err8 != nil {
 		log.Fatal(err8)
 	}
+	historytpl, err9 := templates.Asset(templatePath + "history.html")
+	if err9 != nil {
+		log.Fatal(err9)
+	}
 
 	templatesMap = make(map[string]*template.Template)
+	// Functions of the layout, evaluated when pages are rendered
+	layoutFuncs := template.FuncMap{"authent": func() bool { return Authent }}
 
-	if t, err := template.New("inputform").Parse(string(layouttpl) + string(formtpl)); err != nil {
+	if t, err := template.New("inputform").Funcs(layoutFuncs).Parse(string(layouttpl) + string(formtpl)); err != nil {
 		log.Fatal(err)
 	} else {
 		templatesMap["inputform"] = t
 	}
 
-	if t, err := template.New("error").Parse(string(layouttpl) + string(errtpl)); err != nil {
+	if t, err := template.New("error").Funcs(layoutFuncs).Parse(string(layouttpl) + string(errtpl)); err != nil {
 		log.Fatal(err)
 	} else {
 		templatesMap["error"] = t
 	}
 
-	if t, err := template.New("view").Parse(string(layouttpl) + string(viewtpl)); err != nil {
+	if t, err := template.New("view").Funcs(layoutFuncs).Funcs(template.FuncMap{"workflowName": workflow.Name}).Parse(string(layouttpl) + string(viewtpl)); err != nil {
 		log.Fatal(err)
 	} else {
 		templatesMap["view"] = t
 	}
 
-	if t, err := template.New("index").Parse(string(layouttpl) + string(indextpl)); err != nil {
+	if t, err := template.New("index").Funcs(layoutFuncs).Parse(string(layouttpl) + string(indextpl)); err != nil {
 		log.Fatal(err)
 	} else {
 		templatesMap["index"] = t
 	}
 
-	if t, err := template.New("help").Funcs(template.FuncMap{"markDown": markDowner}).Parse(string(layouttpl) + string(helptpl)); err != nil {
+	if t, err := template.New("help").Funcs(layoutFuncs).Funcs(template.FuncMap{"markDown": markDowner}).Parse(string(layouttpl) + string(helptpl)); err != nil {
 		log.Fatal(err)
 	} else {
 		templatesMap["help"] = t
 	}
 
-	if t, err := template.New("login").Parse(string(layouttpl) + string(logintpl)); err != nil {
+	if t, err := template.New("login").Funcs(layoutFuncs).Parse(string(layouttpl) + string(logintpl)); err != nil {
 		log.Fatal(err)
 	} else {
 		templatesMap["login"] = t
 	}
 
-	if t, err := template.New("maintenance").Parse(string(layouttpl) + string(maintenancetpl)); err != nil {
+	if t, err := template.New("maintenance").Funcs(layoutFuncs).Parse(string(layouttpl) + string(maintenancetpl)); err != nil {
 		log.Fatal(err)
 	} else {
 		templatesMap["maintenance"] = t
 	}
 
+	if t, err := template.New("history").Funcs(layoutFuncs).Funcs(template.FuncMap{"workflowName": workflow.Name}).Parse(string(layouttpl) + string(historytpl)); err != nil {
+		log.Fatal(err)
+	} else {
+		templatesMap["history"] = t
+	}
+
 	/* Static files handlers : js, css, etc. */
 	http.Handle("/static/", http.FileServer(static.AssetFS()))
 	//http.Handle("/", http.RedirectHandler("/new/", http.StatusFound))
@@ -189,6 +253,7 @@ func InitServer(cfg config.Provider) {
 		http.HandleFunc("/", maintenanceHandler) /* Handler for maintenance page  */
 	} else {
 		initUUIDGenerator()
+		initArtifactStore(cfg)
 		initDB(cfg)
 		initEmailNotification(cfg)
 		initProcessor(cfg)
@@ -206,15 +271,28 @@ func InitServer(cfg config.Provider) {
 		http.HandleFunc("/view/", validateHtml(makeHandler(viewHandler)))        /* Handler for viewing analysis results */
 		http.HandleFunc("/itol/", validateHtml(makeRawNormHandler(itolHandler))) /* Handler for uploading tree to itol */
 		http.HandleFunc("/help", validateHtml(helpHandler))                      /* Handler for the help page */
+		http.HandleFunc("/history", validateHtml(historyHandler))                /* Handler for the list of past analyses */
 		http.HandleFunc("/", validateHtml(indexHandler))                         /* Home Page*/
 		http.HandleFunc("/login", loginHandler)                                  /* Handler for login */
 		http.HandleFunc("/settoken", setToken)                                   /* Set token in cookie via form post */
 		http.HandleFunc("/gettoken", getToken)                                   /* get token via api using json post data */
+		http.HandleFunc("/refreshtoken", refreshToken)                           /* get a new token for a valid token */
+		http.HandleFunc("/oidc/login", oidcLogin)                                /* Redirect to the OpenID Connect provider */
+		http.HandleFunc("/oidc/callback", oidcCallback)                          /* Return from the OpenID Connect provider */
 		http.HandleFunc("/logout", validateHtml(logout))                         /* Handler for logout */
 
 		/* Api handlers */
-		http.HandleFunc("/api/analysis/", validateApi(makeApiAnalysisHandler(apiAnalysisHandler))) /* Handler for returning an analysis */
-		http.HandleFunc("/api/image/", validateApi(makeApiImageHandler(apiImageHandler)))          /* Handler for returning a tree image */
+		http.HandleFunc("/api/analysis", validateApi(apiNewAnalysisHandler))  /* Handler for submitting a new analysis */
+		http.HandleFunc("/api/analyses", validateApi(apiListAnalysesHandler)) /* Handler for listing analyses */
+		http.HandleFunc("/api/analysis/", validateApi(makeApiRouter(
+			apiRoute{validApiAnalysisPath, makeApiAnalysisHandler(apiAnalysisHandler)},                      /* Handler for returning (GET) or canceling (DELETE) an analysis */
+			apiRoute{validApiAnalysisFilePath, makeApiAnalysisFileHandler(apiAnalysisFileHandler)},          /* Handler for downloading a file of an analysis */
+			apiRoute{validApiAnalysisEventsPath, makeApiAnalysisEventsHandler(apiAnalysisEventsHandler)},    /* Handler for streaming the events of an analysis */
+			apiRoute{validApiAnalysisSummaryPath, makeApiAnalysisSummaryHandler(apiAnalysisSummaryHandler)}, /* Handler for returning an analysis without its files */
+			apiRoute{validApiAnalysisBundlePath, makeApiAnalysisBundleHandler(apiAnalysisBundleHandler)},    /* Handler for downloading a zip of the results of an analysis */
+			apiRoute{validApiAnalysisExportPath, makeApiAnalysisExportHandler(apiAnalysisExportHandler)},    /* Handler for exporting the result tree in Nexus or PhyloXML */
+		)))
+		http.HandleFunc("/api/image/", validateApi(makeApiImageHandler(apiImageHandler))) /* Handler for returning a tree image */
 		http.HandleFunc("/api/randrunname", validateApi(makeApiHandler(apiRandNameGeneratorHandler)))
 		http.HandleFunc("/status", validateApi(apiStatus)) /* Handler for getting server status */
 	}
@@ -237,8 +315,30 @@ func initProcessor(cfg config.Provider) {
 	proctype := cfg.GetString("runners.type")
 	requestattempts := cfg.GetInt("galaxy.requestattempts")
 	boosterid := cfg.GetString("galaxy.tools.booster")
-	phymlid := cfg.GetString("galaxy.tools.phyml")
-	fasttreeid := cfg.GetString("galaxy.tools.fasttree")
+	workDir = cfg.GetString("runners.workdir")
+
+	// Galaxy tools and local executables of the workflows,
+	// galaxy.tools.<key> and runners.<key>
+	toolids := make(map[int]string)
+	executables := make(map[int]string)
+	for _, w := range workflow.All() {
+		toolids[w.Id()] = cfg.GetString("galaxy.tools." + w.Key())
+		executables[w.Id()] = cfg.GetString("runners." + w.Key())
+	}
+
+	if workDir != "" {
+		var err error
+		// Local tools run in their own directory
+		if workDir, err = filepath.Abs(workDir); err != nil {
+			log.Fatal(err)
+		}
+		if err = os.MkdirAll(workDir, 0755); err != nil {
+			log.Fatal(err)
+		}
+		log.Print("Work directory: " + workDir)
+	} else {
+		log.Print("No work directory given, input files are stored in temp directory, pending analyses may not be restored after a restart")
+	}
 
 	if requestattempts == 0 {
 		requestattempts = 1
@@ -257,20 +357,14 @@ func initProcessor(cfg config.Provider) {
 		if boosterid == "" {
 			log.Fatal("booster tool id  must be provided in configuration file when type=galaxy")
 		}
-		if phymlid == "" {
-			log.Fatal("phyml-sms tool id  must be provided in configuration file when type=galaxy")
-		}
-		if fasttreeid == "" {
-			log.Fatal("fasttree tool id  must be provided in configuration file when type=galaxy")
-		}
 		galproc := &processor.GalaxyProcessor{}
 		galaxyprocessor = true
-		galproc.InitProcessor(galaxyurl, galaxykey, boosterid, phymlid, fasttreeid, requestattempts, db, emailNotifier, queuesize, timeout, memlimit)
+		galproc.InitProcessor(galaxyurl, galaxykey, boosterid, toolids, requestattempts, events.NewPublishingDB(db, bus), store, emailNotifier, queuesize, timeout, memlimit)
 		proc = galproc
 	case "local", "":
 		// Local or not set
 		locproc := &processor.LocalProcessor{}
-		locproc.InitProcessor(nbrunners, queuesize, timeout, jobthreads, db, emailNotifier)
+		locproc.InitProcessor(nbrunners, queuesize, timeout, jobthreads, executables, events.NewPublishingDB(db, bus), store, emailNotifier)
 		proc = locproc
 	default:
 		log.Fatal(errors.New("No processor named " + proctype))
@@ -316,25 +410,52 @@ func initCleanKill() {
 	}()
 }
 
-func initDB(cfg config.Provider) {
+// Returns the database given in the configuration, connected
+// but not initialized (see BoosterwebDB.InitDatabase)
+func NewDatabase(cfg config.Provider) (d database.BoosterwebDB) {
 	dbtype := cfg.GetString("database.type")
 	switch dbtype {
 	case "memory":
-		db = database.NewMemoryBoosterWebDB()
+		d = database.NewMemoryBoosterWebDB()
 	case "mysql":
 		user := cfg.GetString("database.user")
 		host := cfg.GetString("database.host")
 		pass := cfg.GetString("database.pass")
 		dbname := cfg.GetString("database.dbname")
 		port := cfg.GetInt("database.port")
-		db = database.NewMySQLBoosterwebDB(user, pass, host, dbname, port)
-		if err := db.Connect(); err != nil {
+		d = database.NewMySQLBoosterwebDB(user, pass, host, dbname, port)
+		if err := d.Connect(); err != nil {
+			log.Fatal(err)
+		}
+	case "postgres":
+		user := cfg.GetString("database.user")
+		host := cfg.GetString("database.host")
+		pass := cfg.GetString("database.pass")
+		dbname := cfg.GetString("database.dbname")
+		port := cfg.GetInt("database.port")
+		sslmode := cfg.GetString("database.sslmode")
+		d = database.NewPostgresBoosterwebDB(user, pass, host, dbname, port, sslmode)
+		if err := d.Connect(); err != nil {
+			log.Fatal(err)
+		}
+	case "sqlite":
+		file := cfg.GetString("database.file")
+		if file == "" {
+			log.Fatal("database file must be provided in configuration file when type=sqlite")
+		}
+		d = database.NewSQLiteBoosterwebDB(file)
+		if err := d.Connect(); err != nil {
 			log.Fatal(err)
 		}
 	default:
-		db = database.NewMemoryBoosterWebDB()
+		d = database.NewMemoryBoosterWebDB()
 		log.Print("Database type not valid, using default: " + DATABASE_TYPE_DEFAULT)
 	}
+	return
+}
+
+func initDB(cfg config.Provider) {
+	db = NewDatabase(cfg)
 
 	if err := db.InitDatabase(); err != nil {
 		log.Fatal(err)
@@ -342,6 +463,38 @@ func initDB(cfg config.Provider) {
 	initOldAnalysisCleaner(cfg)
 }
 
+func initArtifactStore(cfg config.Provider) {
+	var err error
+
+	storetype := cfg.GetString("artifacts.type")
+	switch storetype {
+	case "":
+		log.Print("No artifact store given, alignments, result trees and logs are kept in the database")
+	case "local":
+		dir := cfg.GetString("artifacts.dir")
+		if dir == "" {
+			log.Fatal("artifacts dir must be provided in configuration file when type=local")
+		}
+		if store, err = artifact.NewLocalStore(dir); err != nil {
+			log.Fatal(err)
+		}
+		log.Print("Artifact directory: " + dir)
+	case "s3":
+		endpoint := cfg.GetString("artifacts.endpoint")
+		region := cfg.GetString("artifacts.region")
+		bucket := cfg.GetString("artifacts.bucket")
+		prefix := cfg.GetString("artifacts.prefix")
+		accesskey := cfg.GetString("artifacts.accesskey")
+		secretkey := cfg.GetString("artifacts.secretkey")
+		if store, err = artifact.NewS3Store(endpoint, region, bucket, prefix, accesskey, secretkey); err != nil {
+			log.Fatal(err)
+		}
+		log.Print("Artifact bucket: " + endpoint + "/" + bucket)
+	default:
+		log.Fatal(errors.New("No artifact store named " + storetype))
+	}
+}
+
 func initOldAnalysisCleaner(cfg config.Provider) {
 	// Will delete old analyses from database
 	// once a day
@@ -349,9 +502,15 @@ func initOldAnalysisCleaner(cfg config.Provider) {
 	if agelimit > 0 {
 		go func() {
 			for {
-				if err := db.DeleteOldAnalyses(agelimit); err != nil {
+				deleted, err := db.DeleteOldAnalyses(agelimit)
+				if err != nil {
 					log.Print("Error while deleting old analyses: " + err.Error())
 				}
+				for _, id := range deleted {
+					if err = artifact.Delete(store, id); err != nil {
+						log.Print("Error while deleting artifacts of analysis " + id + ": " + err.Error())
+					}
+				}
 				time.Sleep(24 * time.Hour)
 			}
 		}()
@@ -381,14 +540,87 @@ func initLog(cfg config.Provider) {
 	log.SetOutput(logfile)
 }
 
+// Authentication is activated if authentication.enabled is true, or if an
+// account is given with authentication.user/password. This account is
+// created as an admin account (its password is updated if it exists).
 func initLogin(cfg config.Provider) {
 	user := cfg.GetString("authentication.user")
 	pass := cfg.GetString("authentication.password")
 	if user != "" && pass != "" {
 		Authent = true
-		Username = user
-		Password = pass
+		if err := initAdminUser(user, pass); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if cfg.GetBool("authentication.enabled") {
+		Authent = true
+	}
+	initAuthenticator(cfg)
+	if Authent {
+		log.Print("Authentication activated")
+	}
+	initTokens(cfg)
+}
+
+// Provider checking the credentials of users: local accounts (static,
+// default), ldap or oidc. External providers activate authentication.
+func initAuthenticator(cfg config.Provider) {
+	var err error
+	admins := cfg.GetStringSlice("authentication.admins")
+	provider := cfg.GetString("authentication.provider")
+	switch provider {
+	case "", "static":
+		authenticator = auth.NewStaticAuthenticator(db)
+	case "ldap":
+		authenticator, err = auth.NewLDAPAuthenticator(
+			cfg.GetString("authentication.ldap.url"),
+			cfg.GetBool("authentication.ldap.starttls"),
+			cfg.GetString("authentication.ldap.userdn"),
+			cfg.GetString("authentication.ldap.basedn"),
+			cfg.GetString("authentication.ldap.filter"),
+			cfg.GetString("authentication.ldap.binddn"),
+			cfg.GetString("authentication.ldap.bindpassword"),
+			admins, db)
+		Authent = true
+	case "oidc":
+		authenticator, err = auth.NewOIDCAuthenticator(
+			context.Background(),
+			cfg.GetString("authentication.oidc.issuer"),
+			cfg.GetString("authentication.oidc.clientid"),
+			cfg.GetString("authentication.oidc.clientsecret"),
+			cfg.GetString("authentication.oidc.redirecturl"),
+			cfg.GetStringSlice("authentication.oidc.scopes"),
+			cfg.GetString("authentication.oidc.loginclaim"),
+			admins, db)
+		Authent = true
+	default:
+		err = errors.New("Unknown authentication provider: " + provider)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if Authent {
+		log.Print("Authentication provider: " + provider)
+	}
+}
+
+func initAdminUser(login, password string) (err error) {
+	var u *model.User
+	if u, err = db.GetUserByLogin(login); err == database.ErrUserNotFound {
+		if u, err = model.NewUser(<-uuids, login, model.ROLE_ADMIN); err != nil {
+			return
+		}
+		log.Print("Creating admin account " + login)
+	} else if err != nil {
+		return
+	} else if u.CheckPassword(password) && u.IsAdmin() {
+		return
+	}
+	u.Role = model.ROLE_ADMIN
+	if err = u.SetPassword(password); err != nil {
+		return
 	}
+	return db.UpdateUser(u)
 }
 
 func initEmailNotification(cfg config.Provider) {
@@ -413,7 +645,7 @@ func initEmailNotification(cfg config.Provider) {
 func newAnalysis(refalign multipart.File, refalignheader *multipart.FileHeader,
 	reffile multipart.File, refheader *multipart.FileHeader,
 	bootfile multipart.File, bootheader *multipart.FileHeader,
-	email, runname string, nbootrep int, workflow string) (a *model.Analysis, err error) {
+	email, runname string, nbootrep int, workflowname string, params model.InferenceParams, tbeparams model.TBEParams, owner string) (a *model.Analysis, err error) {
 
 	var uuid string
 	var dir string
@@ -421,20 +653,42 @@ func newAnalysis(refalign multipart.File, refalignheader *multipart.FileHeader,
 
 	uuid = <-uuids
 
+	if nbootrep > 1000 {
+		nbootrep = 1000
+	}
+
 	a = model.NewAnalysis()
 	a.Id = uuid
 	a.EMail = email
 	a.RunName = runname
+	a.Owner = owner
 	a.NbootRep = nbootrep
 	a.Status = model.STATUS_PENDING
 	a.Nboot = 0
-	a.StartPending = time.Now().Format(time.RFC1123)
+	a.StartPending = time.Now()
+
+	// TBE parameters, default transfer cutoff if not given
+	if tbeparams.TransferCutoff == 0 {
+		tbeparams.TransferCutoff = model.TBE_TRANSFER_CUTOFF
+	}
+	if !(tbeparams.TransferCutoff > 0 && tbeparams.TransferCutoff <= 1) {
+		return nil, &ValidationError{"transfercutoff", "Transfer cutoff must be in ]0,1]"}
+	}
+	a.TBEParams = tbeparams
 
-	/* tmp analysis folder */
-	if dir, err = ioutil.TempDir("", uuid); err != nil {
-		log.Printf("Tmp analysis folder error: %v", err)
+	/* analysis folder and saved alignment, removed if the analysis is rejected */
+	if dir, err = analysisDir(uuid); err != nil {
+		log.Printf("Analysis folder error: %v", err)
 		return
 	}
+	defer func() {
+		if err != nil {
+			os.RemoveAll(dir)
+			if derr := artifact.Delete(store, uuid); derr != nil {
+				log.Printf("Delete artifacts of rejected analysis %s: %v", uuid, derr)
+			}
+		}
+	}()
 
 	// Reference sequences if given
 	if refalignheader != nil && refalignheader.Size != 0 {
@@ -442,55 +696,77 @@ func newAnalysis(refalign multipart.File, refalignheader *multipart.FileHeader,
 		var r *bufio.Reader
 		var al align.Alignment
 
+		var wf workflow.Workflow
+
+		// Given workflow to launch does not exist
+		if wf, err = workflow.ByName(workflowname); err != nil {
+			log.Printf("Workflow: %v", err)
+			return nil, &ValidationError{"workflow", err.Error()}
+		}
+		a.Workflow = wf.Id()
+		if !workflowAvailable(a.Workflow) {
+			return nil, &ValidationError{"workflow", "Phylogenetic workflow is not available on this server: " + workflowname}
+		}
+		if a.NbootRep < 1 {
+			return nil, &ValidationError{"nboot", "Number of bootstrap replicates must be at least 1"}
+		}
+
 		if r, err = utils.GetReaderFromReader(utils.GzipExtension(refalignheader.Filename), refalign); err != nil {
 			log.Printf("GetReaderFromReader: %v", err)
-			log.Print(err)
-			return
+			return nil, &ValidationError{"refalign", "Sequence alignment : " + err.Error()}
 		}
 
 		if al, _, err = utils.ParseAlignmentAuto(r, false); err != nil {
 			log.Printf("ParseAlignmentAuto: %v", err)
-			log.Print(err)
-			return
-		}
-
-		// Write alignment in fasta or in phylip depending on the workflow to launch: phyml or fasttree
-		if seqalignfile, err = writeAlign(al, dir, refalignheader, workflow); err != nil {
-			log.Print("WriteAlign seq: %v", err)
-			log.Print(err)
-			return
+			return nil, &ValidationError{"refalign", "Sequence alignment : format error (" + err.Error() + ")"}
 		}
-
-		a.Alignfile = fasta.WriteAlignment(al)
 		a.AlignAlphabet = al.Alphabet()
 		a.AlignNbSeq = al.NbSequences()
 		a.AlignLength = al.Length()
 
-		// Given workflow to launch does not exist
-		if a.Workflow, err = model.WorkflowConst(workflow); err != nil {
-			log.Print("WorkflowConst: %v", err)
-			log.Print(err)
+		// Inference parameters supported by the workflow,
+		// depending on the alphabet of the alignment
+		params.Criterion = strings.ToUpper(strings.TrimSpace(params.Criterion))
+		params.Moves = strings.ToUpper(strings.TrimSpace(params.Moves))
+		params.Model = strings.ToUpper(strings.TrimSpace(params.Model))
+		a.InferenceParams = params
+		if err = wf.CheckParams(a); err != nil {
+			field := ""
+			if perr, ok := err.(*workflow.ParamError); ok {
+				field = perr.Param
+			}
+			return nil, &ValidationError{field, err.Error()}
+		}
+
+		// Write alignment in the input format of the workflow to launch
+		if seqalignfile, err = writeAlign(al, dir, refalignheader, wf); err != nil {
+			log.Printf("WriteAlign seq: %v", err)
+			return
+		}
+
+		if err = artifact.Save(store, a, artifact.ALIGNMENT, fasta.WriteAlignment(al)); err != nil {
+			log.Printf("Save alignment: %v", err)
 			return
 		}
-		log.Print(fmt.Sprintf("New %s (%d boot) + booster analysis submited | id=%s | ", workflow, a.NbootRep, a.Id))
+		log.Print(fmt.Sprintf("New %s (%d boot, %s) + booster (%s) analysis submited | id=%s | ", workflowname, a.NbootRep, a.InferenceStr(), a.TBEStr(), a.Id))
 
 	} else {
-		log.Print(fmt.Sprintf("New booster analysis submited | id=%s | ", a.Id))
+		log.Print(fmt.Sprintf("New booster analysis (%s) submited | id=%s | ", a.TBEStr(), a.Id))
 
 		if treefile, err = copyTreeFile(dir, reffile, refheader); err != nil {
-			err = errors.New("Reference tree : Newick format error (" + err.Error() + ")")
+			err = &ValidationError{"reftree", "Reference tree : Newick format error (" + err.Error() + ")"}
 			log.Print(err)
 			return nil, err
 		}
 		if boottreefile, err = copyTreeFile(dir, bootfile, bootheader); err != nil {
-			err = errors.New("Bootstrap trees : Newick format error (" + err.Error() + ")")
+			err = &ValidationError{"boottrees", "Bootstrap trees : Newick format error (" + err.Error() + ")"}
 			log.Print(err)
 			return nil, err
 		}
 
 		if err = testSameTips(treefile, boottreefile); err != nil {
 			log.Print(err)
-			err = errors.New("Reference and bootstrap trees do not have the same tip names")
+			err = &ValidationError{"boottrees", "Reference and bootstrap trees do not have the same tip names"}
 			log.Print(err)
 			return nil, err
 		}
@@ -504,11 +780,53 @@ func newAnalysis(refalign multipart.File, refalignheader *multipart.FileHeader,
 	return
 }
 
+// Creates the folder that will store the input files of the analysis:
+// in the work directory if it is configured, in the system temp dir otherwise
+func analysisDir(uuid string) (dir string, err error) {
+	if workDir == "" {
+		return ioutil.TempDir("", uuid)
+	}
+	dir = filepath.Join(workDir, uuid)
+	err = os.Mkdir(dir, 0755)
+	return
+}
+
+// True if the processor can infer trees with the given workflow
+func workflowAvailable(workflow int) bool {
+	for _, w := range proc.Workflows() {
+		if w == workflow {
+			return true
+		}
+	}
+	return false
+}
+
+// Workflows of the processor
+func availableWorkflows() (workflows []workflow.Workflow) {
+	for _, id := range proc.Workflows() {
+		if w, ok := workflow.Get(id); ok {
+			workflows = append(workflows, w)
+		}
+	}
+	return
+}
+
 func getAnalysis(id string) (a *model.Analysis, err error) {
 	a, err = db.GetAnalysis(id)
 	return
 }
 
+// Analysis without its alignment, result trees and logs
+func getAnalysisSummary(id string) (a *model.Analysis, err error) {
+	a, err = db.GetAnalysisSummary(id)
+	return
+}
+
+func listAnalyses(filter database.AnalysisFilter) (analyses []*model.Analysis, next string, err error) {
+	analyses, next, err = db.ListAnalyses(filter)
+	return
+}
+
 func markDowner(args ...interface{}) template.HTML {
 	s := blackfriday.MarkdownCommon([]byte(fmt.Sprintf("%s", args...)))
 	return template.HTML(s)
@@ -583,14 +901,9 @@ func copyTreeFile(tmpdir string, infile multipart.File, infileheader *multipart.
 	return
 }
 
-// Write alignment in fasta or in phylip depending on the workflow to launch: phyml or fasttree
-func writeAlign(al align.Alignment, tmpdir string, infileheader *multipart.FileHeader, workflow string) (fpath string, err error) {
+// Write alignment in fasta or in phylip depending on the input format of the workflow to launch
+func writeAlign(al align.Alignment, tmpdir string, infileheader *multipart.FileHeader, wf workflow.Workflow) (fpath string, err error) {
 	var f *os.File
-	var wf int
-	if wf, err = model.WorkflowConst(workflow); err != nil {
-		log.Print(err)
-		return
-	}
 	if infileheader != nil {
 		fname := strings.TrimSuffix(infileheader.Filename, ".gz")
 		fpath = filepath.Join(tmpdir, fname)
@@ -599,7 +912,7 @@ func writeAlign(al align.Alignment, tmpdir string, infileheader *multipart.FileH
 		} else {
 			// replace special characters from sequence names
 			al.CleanNames(nil)
-			if wf == model.WORKFLOW_PHYML_SMS {
+			if wf.InputFormat() == workflow.FORMAT_PHYLIP {
 				f.WriteString(phylip.WriteAlignment(al, false, false, false))
 			} else {
 				f.WriteString(fasta.WriteAlignment(al))
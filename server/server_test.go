@@ -0,0 +1,94 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+package server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime/multipart"
+	"os"
+	"testing"
+
+	"github.com/evolbioinfo/booster-web/artifact"
+	"github.com/evolbioinfo/booster-web/model"
+)
+
+// Rejected submissions do not leave their folder in the work directory
+func TestNewAnalysisRejectedRemovesDir(t *testing.T) {
+	var err error
+	if workDir, err = ioutil.TempDir("", "workdir"); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(workDir)
+	defer func() { workDir = "" }()
+
+	uuids = make(chan string, 3)
+	uuids <- "rejected1"
+	uuids <- "rejected2"
+	uuids <- "rejected3"
+
+	align := inlineFile{bytes.NewReader([]byte(">s1\nACGT\n>s2\nACGA\n>s3\nACTT\n"))}
+	header := &multipart.FileHeader{Filename: "align.fa", Size: 1}
+	tree := inlineFile{bytes.NewReader([]byte("(s1,s2,s3);"))}
+	treeheader := &multipart.FileHeader{Filename: "ref.nw", Size: 1}
+	badtree := inlineFile{bytes.NewReader([]byte("(s1,s2,s3"))}
+	badtreeheader := &multipart.FileHeader{Filename: "boot.nw", Size: 1}
+
+	if _, err = newAnalysis(align, header, nil, nil, nil, nil, "", "", 100, "Unknown workflow", model.InferenceParams{}, model.TBEParams{}, ""); err == nil {
+		t.Error("Unknown workflow should be rejected")
+	}
+	if _, err = newAnalysis(nil, nil, tree, treeheader, badtree, badtreeheader, "", "", 0, "", model.InferenceParams{}, model.TBEParams{}, ""); err == nil {
+		t.Error("Malformed bootstrap trees should be rejected")
+	}
+	if _, err = newAnalysis(nil, nil, nil, nil, nil, nil, "", "", 0, "", model.InferenceParams{}, model.TBEParams{TransferCutoff: 2}, ""); err == nil {
+		t.Error("Transfer cutoff > 1 should be rejected")
+	}
+
+	files, _ := ioutil.ReadDir(workDir)
+	if len(files) != 0 {
+		t.Errorf("Rejected analyses should not leave folders in the work directory, found %d", len(files))
+	}
+}
+
+// Analyses that fail to launch do not leave their alignment in the store
+func TestNewAnalysisLaunchErrorRemovesArtifacts(t *testing.T) {
+	var err error
+	dir := t.TempDir()
+	if store, err = artifact.NewLocalStore(dir); err != nil {
+		t.Fatal(err)
+	}
+	proc = failingProcessor{}
+	defer func() { store, proc = nil, nil }()
+	uuids = make(chan string, 1)
+	uuids <- "failed"
+
+	align := inlineFile{bytes.NewReader([]byte(">s1\nACGT\n>s2\nACGA\n>s3\nACTT\n>s4\nTCTT\n"))}
+	header := &multipart.FileHeader{Filename: "align.fa", Size: 1}
+	if _, err = newAnalysis(align, header, nil, nil, nil, nil, "", "", 10, "FastTree", model.InferenceParams{}, model.TBEParams{}, ""); err == nil {
+		t.Fatal("Expected the launch error")
+	}
+	if _, err = store.Get(artifact.Key("failed", artifact.ALIGNMENT)); err != artifact.ErrNotFound {
+		t.Errorf("Expected the alignment to be removed from the store, got %v", err)
+	}
+}
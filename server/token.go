@@ -33,78 +33,293 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
+	"regexp"
 	"strings"
 	"time"
 
 	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/evolbioinfo/booster-web/auth"
+	"github.com/evolbioinfo/booster-web/config"
+	"github.com/evolbioinfo/booster-web/model"
 )
 
 type Key int
 
 const MyKey Key = 0
 
+const (
+	TOKEN_ISSUER_DEFAULT          = "booster.c3bi.pasteur.fr"
+	TOKEN_SESSIONLIFETIME_DEFAULT = 1 * time.Hour      // Lifetime of the web interface cookie
+	TOKEN_LIFETIME_DEFAULT        = 10 * time.Hour     // Lifetime of the api tokens
+	TOKEN_REFRESHLIMIT_DEFAULT    = 7 * 24 * time.Hour // Tokens are not refreshed after this time since login
+	APIKEY_USAGE_PRECISION        = 1 * time.Minute    // Last use of api keys is not updated more often
+	OIDC_STATE_LIFETIME           = 10 * time.Minute   // Time to log in on the OpenID Connect provider page
+)
+
 // If authent == true => then we turn authentication on
 var Authent bool = false
-var Username string = ""
-var Password string = ""
-var mySigningKey = []byte(GenerateRandomString(20))
+
+// Provider checking the credentials of users (static, ldap or oidc)
+var authenticator auth.Authenticator
+
+// Key signing the tokens (HS256 secret or RS256 private key), and key
+// verifying them (the same secret or the RS256 public key). A random
+// secret is used if none is configured: tokens are then invalid after a restart.
+var signingMethod jwt.SigningMethod = jwt.SigningMethodHS256
+var signingKey interface{} = []byte(GenerateRandomString(20))
+var verifyingKey interface{} = signingKey
+
+var tokenIssuer = TOKEN_ISSUER_DEFAULT
+var sessionLifetime = TOKEN_SESSIONLIFETIME_DEFAULT
+var tokenLifetime = TOKEN_LIFETIME_DEFAULT
+var refreshLimit = TOKEN_REFRESHLIMIT_DEFAULT
 
 type Claims struct {
 	Username string `json:"username"`
+	UserId   string `json:"uid"`
+	Role     string `json:"role"`
+	// Login time (unix time), kept when the token is refreshed
+	OrigIssuedAt int64 `json:"orig_iat"`
 	// recommended having
 	jwt.StandardClaims
 }
 
+// Urls of the pages and api giving access to a single analysis:
+// the analysis id is the second group
+var validAnalysisPath = regexp.MustCompile("^/(view|itol|api/analysis|api/image)/([-a-zA-Z0-9]+)(/|$)")
+
 type AuthJson struct {
 	Username string `json:"username"`
-	Password string `json:"password`
+	Password string `json:"password"`
 }
 
 type AuthResponse struct {
 	Status  int    `json:"status"`
 	Message string `json:"message"`
 	Token   string `json:"token"`
+	Expires string `json:"expires,omitempty"` // Expiration date of the token (ISO-8601)
+}
+
+/*
+Configures the signing of the tokens:
+  - authentication.key: HS256 secret
+  - authentication.keyfile: PEM file of a RSA private key (RS256)
+  - authentication.issuer: issuer of the tokens
+  - authentication.sessionlifetime, authentication.tokenlifetime: lifetimes
+    of the web interface cookie and of the api tokens (ex: "1h", "30m")
+  - authentication.refreshlimit: tokens are not refreshed after this time since login
+*/
+func initTokens(cfg config.Provider) {
+	key := cfg.GetString("authentication.key")
+	keyfile := cfg.GetString("authentication.keyfile")
+	if key != "" && keyfile != "" {
+		log.Fatal("authentication.key and authentication.keyfile are mutually exclusive")
+	}
+	if key != "" {
+		if len(key) < 32 {
+			log.Print("Warning: authentication.key should be at least 32 characters long")
+		}
+		signingMethod = jwt.SigningMethodHS256
+		signingKey = []byte(key)
+		verifyingKey = signingKey
+	} else if keyfile != "" {
+		pem, err := ioutil.ReadFile(keyfile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		privkey, err := jwt.ParseRSAPrivateKeyFromPEM(pem)
+		if err != nil {
+			log.Fatal(fmt.Sprintf("Cannot read RSA private key %s: %v", keyfile, err))
+		}
+		signingMethod = jwt.SigningMethodRS256
+		signingKey = privkey
+		verifyingKey = &privkey.PublicKey
+	} else if Authent {
+		log.Print("No authentication.key given: tokens will be invalidated at restart")
+	}
+
+	if issuer := cfg.GetString("authentication.issuer"); issuer != "" {
+		tokenIssuer = issuer
+	}
+	sessionLifetime = configDuration(cfg, "authentication.sessionlifetime", TOKEN_SESSIONLIFETIME_DEFAULT)
+	tokenLifetime = configDuration(cfg, "authentication.tokenlifetime", TOKEN_LIFETIME_DEFAULT)
+	refreshLimit = configDuration(cfg, "authentication.refreshlimit", TOKEN_REFRESHLIMIT_DEFAULT)
+	log.Print(fmt.Sprintf("Tokens: %s, issuer %s, lifetime %v (web: %v), refreshed up to %v after login",
+		signingMethod.Alg(), tokenIssuer, tokenLifetime, sessionLifetime, refreshLimit))
+}
+
+// Duration given in the configuration, or def if it is not set
+func configDuration(cfg config.Provider, key string, def time.Duration) time.Duration {
+	if !cfg.IsSet(key) {
+		return def
+	}
+	d, err := time.ParseDuration(cfg.GetString(key))
+	if err != nil || d <= 0 {
+		log.Fatal(fmt.Sprintf("Wrong duration for %s: %s", key, cfg.GetString(key)))
+	}
+	return d
+}
+
+// Signs a new token of the user, valid during lifetime. origiat is the
+// login time of the user (unix time), kept through refreshes.
+func newToken(u *model.User, lifetime time.Duration, origiat int64) (signed string, expires time.Time, err error) {
+	now := time.Now()
+	expires = now.Add(lifetime)
+	claims := Claims{
+		u.Login,
+		u.Id,
+		u.Role,
+		origiat,
+		jwt.StandardClaims{
+			ExpiresAt: expires.Unix(),
+			IssuedAt:  now.Unix(),
+			Issuer:    tokenIssuer,
+		},
+	}
+	signed, err = jwt.NewWithClaims(signingMethod, claims).SignedString(signingKey)
+	return
+}
+
+// Parses and verifies the token: signature, expiration and issuer
+func parseToken(val string) (claims *Claims, err error) {
+	var token *jwt.Token
+	var ok bool
+
+	token, err = jwt.ParseWithClaims(val, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+		// Make sure token's signature wasn't changed
+		if token.Method.Alg() != signingMethod.Alg() {
+			return nil, fmt.Errorf("Unexpected siging method")
+		}
+		return verifyingKey, nil
+	})
+	if err != nil {
+		return
+	}
+	if claims, ok = token.Claims.(*Claims); !ok || !token.Valid || claims.UserId == "" {
+		return nil, errors.New("Problem with authentication token")
+	}
+	if !claims.VerifyIssuer(tokenIssuer, true) {
+		return nil, errors.New("Wrong authentication token issuer")
+	}
+	return
+}
+
+// Claims of the owner of the api key given in the Authorization
+// header (format: Authorization: ApiKey <key>). The last use of
+// the key is updated at most every APIKEY_USAGE_PRECISION.
+func apiKeyClaims(key string) (claims *Claims, err error) {
+	var k *model.ApiKey
+	var u *model.User
+
+	if k, err = db.GetApiKey(model.HashApiKey(key)); err != nil {
+		return nil, errors.New("Invalid api key")
+	}
+	if u, err = db.GetUser(k.UserId); err != nil {
+		return nil, errors.New("Invalid api key")
+	}
+	if now := time.Now(); now.Sub(k.LastUsed) > APIKEY_USAGE_PRECISION {
+		if err = db.UpdateApiKeyUsage(k.Id, now); err != nil {
+			log.Print(err)
+		}
+	}
+	claims = &Claims{
+		Username: u.Login,
+		UserId:   u.Id,
+		Role:     u.Role,
+	}
+	return claims, nil
+}
+
+// Token given in the Auth cookie or, for the api, in the
+// Authorization header (format: Authorization: Bearer <token>)
+func requestToken(req *http.Request) (val string, fromcookie bool) {
+	if cookie, err := req.Cookie("Auth"); err == nil {
+		return cookie.Value, true
+	}
+	val = strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	return
 }
 
 func setToken(res http.ResponseWriter, req *http.Request) {
 	req.ParseForm()
 	user := req.FormValue("user")
 	pass := req.FormValue("pass")
-	if user == Username && pass == Password {
-		// Expires the token and cookie in 1 hour
-		expireToken := time.Now().Add(time.Hour * 1).Unix()
-		expireCookie := time.Now().Add(time.Hour * 1)
-
-		// We'll manually assign the claims but in production you'd insert values from a database
-		claims := Claims{
-			Username,
-			jwt.StandardClaims{
-				ExpiresAt: expireToken,
-				Issuer:    "localhost:8080",
-			},
-		}
+	if u, err := authenticate(user, pass); err == nil {
+		setSession(res, req, u)
+	} else {
+		http.Redirect(res, req, "/login", http.StatusFound)
+	}
+}
 
-		// Create the token using your claims
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+// Places a new session token of the user in the client's cookie,
+// and redirects to the home page
+func setSession(res http.ResponseWriter, req *http.Request, u *model.User) {
+	signedToken, expires, err := newToken(u, sessionLifetime, time.Now().Unix())
+	if err != nil {
+		log.Print(err)
+		http.Redirect(res, req, "/login", http.StatusFound)
+		return
+	}
+
+	// Place the token in the client's cookie
+	cookie := http.Cookie{Name: "Auth", Value: signedToken, Expires: expires, HttpOnly: true}
+	http.SetCookie(res, &cookie)
 
-		// Signs the token with a secret.
-		signedToken, _ := token.SignedString(mySigningKey)
+	// Redirect the user to root
+	http.Redirect(res, req, "/", http.StatusFound)
+}
 
-		// Place the token in the client's cookie
-		cookie := http.Cookie{Name: "Auth", Value: signedToken, Expires: expireCookie, HttpOnly: true}
+// Redirects to the login page of the OpenID Connect provider. The state
+// and the nonce are independent random values, kept in cookies: the state
+// is checked by oidcCallback, and the nonce in the returned id token.
+func oidcLogin(res http.ResponseWriter, req *http.Request) {
+	ra, ok := authenticator.(auth.RedirectAuthenticator)
+	if !ok {
+		http.NotFound(res, req)
+		return
+	}
+	state := GenerateRandomString(20)
+	nonce := GenerateRandomString(20)
+	for name, value := range map[string]string{"OIDCState": state, "OIDCNonce": nonce} {
+		cookie := http.Cookie{Name: name, Value: value, Path: "/oidc/", MaxAge: int(OIDC_STATE_LIFETIME.Seconds()), HttpOnly: true}
 		http.SetCookie(res, &cookie)
+	}
+	http.Redirect(res, req, ra.LoginURL(state, nonce), http.StatusFound)
+}
 
-		// Redirect the user to root
-		http.Redirect(res, req, "/", http.StatusFound)
-	} else {
-		http.Redirect(res, req, "/login", http.StatusFound)
+// Callback url of the OpenID Connect provider, opens a session
+// for the authenticated user
+func oidcCallback(res http.ResponseWriter, req *http.Request) {
+	ra, ok := authenticator.(auth.RedirectAuthenticator)
+	if !ok {
+		http.NotFound(res, req)
+		return
+	}
+	state, err := req.Cookie("OIDCState")
+	nonce, err2 := req.Cookie("OIDCNonce")
+	http.SetCookie(res, &http.Cookie{Name: "OIDCState", Path: "/oidc/", MaxAge: -1})
+	http.SetCookie(res, &http.Cookie{Name: "OIDCNonce", Path: "/oidc/", MaxAge: -1})
+	if err != nil || err2 != nil || state.Value == "" || nonce.Value == "" || req.FormValue("state") != state.Value {
+		errorHandler(res, req, errors.New("Authentication failed: wrong state"))
+		return
 	}
+	if e := req.FormValue("error"); e != "" {
+		errorHandler(res, req, errors.New("Authentication failed: "+e))
+		return
+	}
+	u, err := ra.Callback(req.FormValue("code"), nonce.Value)
+	if err != nil {
+		log.Print("OpenID Connect authentication failed: " + err.Error())
+		errorHandler(res, req, errors.New("Authentication failed"))
+		return
+	}
+	setSession(res, req, u)
 }
 
 func getToken(res http.ResponseWriter, req *http.Request) {
 	res.Header().Set("Content-Type", "text/json")
 	body, err := ioutil.ReadAll(req.Body)
-	answer := AuthResponse{0, "", ""}
+	answer := AuthResponse{0, "", "", ""}
 	authjson := AuthJson{}
 
 	if err != nil {
@@ -114,30 +329,67 @@ func getToken(res http.ResponseWriter, req *http.Request) {
 		answer.Status = 1
 		answer.Message = err2.Error()
 	} else {
-		if authjson.Username == Username && authjson.Password == Password {
-			// Expires the token and cookie in 1 hour
-			expireToken := time.Now().Add(time.Hour * 10).Unix()
-
-			// We'll manually assign the claims but in production you'd insert values from a database
-			claims := Claims{
-				Username,
-				jwt.StandardClaims{
-					ExpiresAt: expireToken,
-					Issuer:    "booster.c3bi.pasteur.fr",
-				},
+		if u, err := authenticate(authjson.Username, authjson.Password); err == nil {
+			var expires time.Time
+			if answer.Token, expires, err = newToken(u, tokenLifetime, time.Now().Unix()); err != nil {
+				answer.Status = 1
+				answer.Message = err.Error()
+			} else {
+				answer.Expires = expires.Format(time.RFC3339)
 			}
-
-			// Create the token using your claims
-			token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-			// Signs the token with a secret.
-			signedToken, _ := token.SignedString(mySigningKey)
-			answer.Token = signedToken
 		} else {
 			answer.Status = 1
-			answer.Message = "Wrong Credentials"
+			answer.Message = err.Error()
+		}
+	}
+	if err := json.NewEncoder(res).Encode(answer); err != nil {
+		log.Print(err)
+	}
+}
+
+// Returns a new token for the still valid token given in the Auth cookie
+// or in the Authorization header, without sending the credentials again.
+//
+// The user account is read again (deleted users or changed roles are taken
+// into account), and tokens are not refreshed after authentication.refreshlimit
+// since login.
+func refreshToken(res http.ResponseWriter, req *http.Request) {
+	var claims *Claims
+	var u *model.User
+	var expires time.Time
+	var err error
+
+	res.Header().Set("Content-Type", "text/json")
+	answer := AuthResponse{0, "", "", ""}
+	val, fromcookie := requestToken(req)
+	lifetime := tokenLifetime
+	if fromcookie {
+		lifetime = sessionLifetime
+	}
+
+	if claims, err = parseToken(val); err != nil {
+		answer.Status = 1
+		answer.Message = err.Error()
+	} else if time.Since(time.Unix(claims.OrigIssuedAt, 0)) > refreshLimit {
+		answer.Status = 1
+		answer.Message = "Token cannot be refreshed anymore, please log in again"
+	} else if u, err = db.GetUser(claims.UserId); err != nil {
+		answer.Status = 1
+		answer.Message = "Wrong Credentials"
+	} else if answer.Token, expires, err = newToken(u, lifetime, claims.OrigIssuedAt); err != nil {
+		answer.Status = 1
+		answer.Message = err.Error()
+	} else {
+		answer.Expires = expires.Format(time.RFC3339)
+		if fromcookie {
+			cookie := http.Cookie{Name: "Auth", Value: answer.Token, Expires: expires, HttpOnly: true}
+			http.SetCookie(res, &cookie)
 		}
 	}
+
+	if answer.Status != 0 {
+		res.WriteHeader(http.StatusUnauthorized)
+	}
 	if err := json.NewEncoder(res).Encode(answer); err != nil {
 		log.Print(err)
 	}
@@ -155,27 +407,20 @@ func validateHtml(page http.HandlerFunc) http.HandlerFunc {
 				return
 			}
 
-			// Return a Token using the cookie
-			token, err := jwt.ParseWithClaims(cookie.Value, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-				// Make sure token's signature wasn't changed
-				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-					return nil, fmt.Errorf("Unexpected siging method")
-				}
-				return mySigningKey, nil
-			})
+			// Return the claims of the token of the cookie
+			claims, err := parseToken(cookie.Value)
 			if err != nil {
 				http.Redirect(res, req, "/login", http.StatusFound)
 				return
 			}
 
-			// Grab the tokens claims and pass it into the original request
-			if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-				ctx := context.WithValue(req.Context(), MyKey, *claims)
-				page(res, req.WithContext(ctx))
-			} else {
-				http.Redirect(res, req, "/login", http.StatusFound)
+			// Pass the claims into the original request
+			if !canAccessPath(*claims, req.URL.Path) {
+				errorHandler(res, req, errors.New("Analysis does not exist"))
 				return
 			}
+			ctx := context.WithValue(req.Context(), MyKey, *claims)
+			page(res, req.WithContext(ctx))
 		})
 	} else {
 		/* We return a handler without authentication (it does nothing) */
@@ -189,45 +434,28 @@ func validateHtml(page http.HandlerFunc) http.HandlerFunc {
 func validateApi(page http.HandlerFunc) http.HandlerFunc {
 	if Authent {
 		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
-
-			var val string
-			// If no Auth cookie is set then we look at request bearer auth header
-			cookie, err := req.Cookie("Auth")
-			if err != nil {
-				// Get token from the Authorization header
-				// format: Authorization: Bearer
-				tokens, ok := req.Header["Authorization"]
-				if ok && len(tokens) >= 1 {
-					val = tokens[0]
-					val = strings.TrimPrefix(val, "Bearer ")
-				}
+			// Return the claims of the api key, or of the token of the cookie or the bearer
+			var claims *Claims
+			var err error
+			auth := req.Header.Get("Authorization")
+			if strings.HasPrefix(auth, "ApiKey ") {
+				claims, err = apiKeyClaims(strings.TrimPrefix(auth, "ApiKey "))
 			} else {
-				val = cookie.Value
+				val, _ := requestToken(req)
+				claims, err = parseToken(val)
 			}
-
-			//fmt.Println(val)
-
-			// Return a Token using the value of the cookie or the bearer
-			token, err := jwt.ParseWithClaims(val, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-				// Make sure token's signature wasn't changed
-				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-					return nil, fmt.Errorf("Unexpected siging method")
-				}
-				return mySigningKey, nil
-			})
 			if err != nil {
 				apiError(res, err)
 				return
 			}
 
-			// Grab the tokens claims and pass it into the original request
-			if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-				ctx := context.WithValue(req.Context(), MyKey, *claims)
-				page(res, req.WithContext(ctx))
-			} else {
-				apiError(res, errors.New("Problem with authentication token"))
+			// Pass the claims into the original request
+			if !canAccessPath(*claims, req.URL.Path) {
+				apiErrorStatus(res, http.StatusNotFound, errors.New("Analysis does not exist"))
 				return
 			}
+			ctx := context.WithValue(req.Context(), MyKey, *claims)
+			page(res, req.WithContext(ctx))
 		})
 	} else {
 		/* We return a handler without authentication (it does nothing) */
@@ -248,6 +476,61 @@ func protectedProfile(res http.ResponseWriter, req *http.Request) {
 	fmt.Fprintf(res, "Hello %s", claims.Username)
 }
 
+// Returns the user if the login and password are correct for the
+// authentication provider. Errors of the provider itself are logged.
+func authenticate(login, password string) (u *model.User, err error) {
+	if u, err = authenticator.Authenticate(login, password); err != nil && err != auth.ErrWrongCredentials && err != auth.ErrRedirectOnly {
+		log.Print("Authentication error: " + err.Error())
+		return nil, errors.New("Authentication failed")
+	}
+	return
+}
+
+// Claims of the authenticated user of the request, ok is false
+// if authentication is not activated
+func requestClaims(req *http.Request) (claims Claims, ok bool) {
+	claims, ok = req.Context().Value(MyKey).(Claims)
+	return
+}
+
+// Id of the authenticated user of the request, empty
+// if authentication is not activated
+func requestUserId(req *http.Request) string {
+	claims, _ := requestClaims(req)
+	return claims.UserId
+}
+
+// Id of the user whose analyses the request may list: empty
+// for admins (all analyses).
+//
+// ok is false without authentication: analyses are then not listed,
+// anyone could see all analyses, or search them by email.
+func requestOwnerFilter(req *http.Request) (owner string, ok bool) {
+	var claims Claims
+	if claims, ok = requestClaims(req); ok && claims.Role != model.ROLE_ADMIN {
+		owner = claims.UserId
+	}
+	return
+}
+
+// Returns false if the url concerns an analysis owned by another user.
+//
+// Admins access all analyses, and analyses submitted without
+// authentication (no owner) are only accessible to admins.
+func canAccessPath(claims Claims, path string) bool {
+	m := validAnalysisPath.FindStringSubmatch(path)
+	if m == nil || claims.Role == model.ROLE_ADMIN {
+		return true
+	}
+	// Only the owner is needed: alignment, trees and logs are not read
+	a, err := getAnalysisSummary(m[2])
+	if err != nil {
+		// The handler answers that the analysis does not exist
+		return true
+	}
+	return a.Owner != "" && a.Owner == claims.UserId
+}
+
 func logout(res http.ResponseWriter, req *http.Request) {
 	deleteCookie := http.Cookie{Name: "Auth", Value: "none", Expires: time.Now()}
 	http.SetCookie(res, &deleteCookie)
@@ -0,0 +1,291 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/evolbioinfo/booster-web/model"
+)
+
+func TestCanAccessPath(t *testing.T) {
+	newTestDB(t)
+	insertTestAnalysis(t, "owned", "u1", time.Now())
+	insertTestAnalysis(t, "anonymous", "", time.Now())
+	db = summaryOnlyDB{db}
+
+	user := Claims{UserId: "u1", Role: model.ROLE_USER}
+	other := Claims{UserId: "u2", Role: model.ROLE_USER}
+	admin := Claims{UserId: "admin", Role: model.ROLE_ADMIN}
+
+	for _, test := range []struct {
+		claims Claims
+		path   string
+		access bool
+	}{
+		{user, "/view/owned", true},
+		{user, "/api/analysis/owned/files/fbp.nh", true},
+		{other, "/view/owned", false},
+		{other, "/api/analysis/owned", false},
+		{other, "/api/image/owned", false},
+		{other, "/itol/owned", false},
+		{user, "/api/analysis/anonymous", false},
+		{admin, "/api/analysis/owned", true},
+		{admin, "/api/analysis/anonymous", true},
+		{other, "/api/analysis/unknown", true}, // The handler answers 404
+		{other, "/history", true},
+		{other, "/api/analyses", true},
+	} {
+		if access := canAccessPath(test.claims, test.path); access != test.access {
+			t.Errorf("%s on %s: expected access %v, got %v", test.claims.UserId, test.path, test.access, access)
+		}
+	}
+}
+
+func TestValidateApiOwner(t *testing.T) {
+	newTestDB(t)
+	insertTestAnalysis(t, "owned", "u1", time.Now())
+	Authent = true
+	defer func() { Authent = false }()
+
+	handler := validateApi(func(w http.ResponseWriter, r *http.Request) {
+		if requestUserId(r) == "" {
+			t.Error("Handler called without authenticated user")
+		}
+		w.WriteHeader(http.StatusTeapot)
+	})
+	get := func(path, token string) int {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w.Code
+	}
+
+	owner, _, err := newToken(&model.User{Id: "u1", Login: "user1", Role: model.ROLE_USER}, time.Hour, time.Now().Unix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _, err := newToken(&model.User{Id: "u2", Login: "user2", Role: model.ROLE_USER}, time.Hour, time.Now().Unix())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if code := get("/api/analysis/owned", owner); code != http.StatusTeapot {
+		t.Errorf("Owner: expected the handler to answer, got %d", code)
+	}
+	if code := get("/api/analysis/owned", other); code != http.StatusNotFound {
+		t.Errorf("Other user: expected 404, got %d", code)
+	}
+	// Authentication errors are answered with status 1
+	r := httptest.NewRequest(http.MethodGet, "/api/analysis/owned", nil)
+	w := httptest.NewRecorder()
+	handler(w, r)
+	var answer GenericResponse
+	if err = json.NewDecoder(w.Body).Decode(&answer); err != nil || answer.Status != 1 {
+		t.Errorf("No token: expected an authentication error, got %s", w.Body.String())
+	}
+}
+
+func TestRefreshToken(t *testing.T) {
+	newTestDB(t)
+	u := &model.User{Id: "u1", Login: "user1", Role: model.ROLE_USER}
+	if err := db.UpdateUser(u); err != nil {
+		t.Fatal(err)
+	}
+
+	refresh := func(token string, cookie bool) (code int, answer AuthResponse, res *http.Response) {
+		r := httptest.NewRequest(http.MethodPost, "/refreshtoken", nil)
+		if cookie {
+			r.AddCookie(&http.Cookie{Name: "Auth", Value: token})
+		} else {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		refreshToken(w, r)
+		if err := json.NewDecoder(w.Body).Decode(&answer); err != nil {
+			t.Fatal(err)
+		}
+		return w.Code, answer, w.Result()
+	}
+
+	login := time.Now().Add(-time.Hour).Unix()
+	token, _, err := newToken(u, time.Hour, login)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, answer, _ := refresh(token, false)
+	if code != http.StatusOK || answer.Token == "" {
+		t.Fatalf("Expected a new token, got %d %+v", code, answer)
+	}
+	claims, err := parseToken(answer.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.OrigIssuedAt != login || claims.UserId != "u1" {
+		t.Errorf("Expected the login time and user to be kept, got %+v", claims)
+	}
+	if expires, _ := time.Parse(time.RFC3339, answer.Expires); time.Until(expires) < tokenLifetime-time.Minute {
+		t.Errorf("Expected an api token lifetime, expires at %s", answer.Expires)
+	}
+
+	// Web sessions are refreshed in the cookie, with the session lifetime
+	code, answer, res := refresh(token, true)
+	if code != http.StatusOK || len(res.Cookies()) != 1 || res.Cookies()[0].Value != answer.Token {
+		t.Errorf("Expected the new token in the cookie, got %d %v", code, res.Cookies())
+	}
+	if expires, _ := time.Parse(time.RFC3339, answer.Expires); time.Until(expires) > sessionLifetime+time.Minute {
+		t.Errorf("Expected a session lifetime, expires at %s", answer.Expires)
+	}
+
+	// Role changes are taken into account
+	u.Role = model.ROLE_ADMIN
+	if err = db.UpdateUser(u); err != nil {
+		t.Fatal(err)
+	}
+	if _, answer, _ = refresh(token, false); answer.Token == "" {
+		t.Fatalf("Expected a new token, got %+v", answer)
+	}
+	if claims, err = parseToken(answer.Token); err != nil || claims.Role != model.ROLE_ADMIN {
+		t.Errorf("Expected the new role in the token, got %+v (%v)", claims, err)
+	}
+
+	// Tokens are not refreshed after the refresh limit since login
+	old, _, err := newToken(u, time.Hour, time.Now().Add(-refreshLimit-time.Hour).Unix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code, answer, _ = refresh(old, false); code != http.StatusUnauthorized || answer.Token != "" {
+		t.Errorf("Expected the refresh limit to be enforced, got %d %+v", code, answer)
+	}
+
+	// Expired, invalid tokens, or tokens of deleted users are not refreshed
+	expired, _, err := newToken(u, -time.Minute, login)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code, _, _ = refresh(expired, false); code != http.StatusUnauthorized {
+		t.Errorf("Expired token: expected 401, got %d", code)
+	}
+	if code, _, _ = refresh(token+"x", false); code != http.StatusUnauthorized {
+		t.Errorf("Invalid token: expected 401, got %d", code)
+	}
+	if err = db.DeleteUser(u.Id); err != nil {
+		t.Fatal(err)
+	}
+	if code, _, _ = refresh(token, false); code != http.StatusUnauthorized {
+		t.Errorf("Deleted user: expected 401, got %d", code)
+	}
+}
+
+func TestParseTokenIssuer(t *testing.T) {
+	u := &model.User{Id: "u1", Login: "user1", Role: model.ROLE_USER}
+	tokenIssuer = "other"
+	token, _, err := newToken(u, time.Hour, time.Now().Unix())
+	tokenIssuer = TOKEN_ISSUER_DEFAULT
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = parseToken(token); err == nil {
+		t.Error("Tokens of another issuer should be refused")
+	}
+}
+
+func TestApiKeyAuthentication(t *testing.T) {
+	newTestDB(t)
+	insertTestAnalysis(t, "owned", "u1", time.Now())
+	if err := db.UpdateUser(&model.User{Id: "u1", Login: "user1", Role: model.ROLE_USER}); err != nil {
+		t.Fatal(err)
+	}
+	k, key, err := model.NewApiKey("k1", "u1", "pipeline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.InsertApiKey(k); err != nil {
+		t.Fatal(err)
+	}
+	Authent = true
+	defer func() { Authent = false }()
+
+	handler := validateApi(func(w http.ResponseWriter, r *http.Request) {
+		if requestUserId(r) != "u1" {
+			t.Errorf("Expected user u1, got %q", requestUserId(r))
+		}
+		w.WriteHeader(http.StatusTeapot)
+	})
+	get := func(path, key string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.Header.Set("Authorization", "ApiKey "+key)
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+
+	if w := get("/api/analysis/owned", key); w.Code != http.StatusTeapot {
+		t.Fatalf("Expected the handler to answer, got %d %s", w.Code, w.Body.String())
+	}
+	if k, err = db.GetApiKey(k.Hash); err != nil || time.Since(k.LastUsed) > time.Minute {
+		t.Errorf("Expected the last use to be updated, got %+v (%v)", k, err)
+	}
+	// The last use is not written again at each request
+	lastused := k.LastUsed
+	get("/api/analysis/owned", key)
+	if k, _ = db.GetApiKey(k.Hash); !k.LastUsed.Equal(lastused) {
+		t.Errorf("Expected the last use not to be updated within %v", APIKEY_USAGE_PRECISION)
+	}
+
+	// Unknown and revoked keys, and keys of deleted users are refused
+	refused := func(name, key string) {
+		var answer GenericResponse
+		w := get("/api/analysis/owned", key)
+		if err := json.NewDecoder(w.Body).Decode(&answer); err != nil || answer.Status != 1 {
+			t.Errorf("%s: expected an authentication error, got %d %s", name, w.Code, w.Body.String())
+		}
+	}
+	refused("unknown key", "bwk_unknown")
+
+	k2, key2, err := model.NewApiKey("k2", "u1", "other pipeline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.InsertApiKey(k2); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.DeleteApiKey("k1"); err != nil {
+		t.Fatal(err)
+	}
+	refused("revoked key", key)
+	if w := get("/api/analysis/owned", key2); w.Code != http.StatusTeapot {
+		t.Errorf("Expected the other key to stay valid, got %d %s", w.Code, w.Body.String())
+	}
+
+	if err = db.DeleteUser("u1"); err != nil {
+		t.Fatal(err)
+	}
+	refused("deleted user", key2)
+}
@@ -63,72 +63,80 @@ function updateTreeCanvas(){
     });
 }
 
+/* Files are streamed by the server */
+function downloadFile(id, name){
+    window.location.href = "/api/analysis/"+id+"/files/"+name;
+}
+
 function downloadTBENormTree(id){
-    $.ajax({
-	url: "/api/analysis/"+id,
-	dataType: 'json',
- 	async: true,
- 	success: function(data) {
-	    var analysis = data;
-	    if(analysis.status == 2 || analysis.status == 5){
-		download(analysis.tbenormtree, "boosterweb_tbe_norm.nh", "text/plain");
-	    }
-	}
-    });
+    downloadFile(id, "tbe_norm.nh");
 }
 
 function downloadTBERawTree(id){
-    $.ajax({
-	url: "/api/analysis/"+id,
-	dataType: 'json',
- 	async: true,
- 	success: function(data) {
-	    var analysis = data;
-	    if(analysis.status == 2 || analysis.status == 5){
-		download(analysis.tberawtree, "boosterweb_tbe_raw.nh", "text/plain");
-	    }
-	}
-    });
+    downloadFile(id, "tbe_raw.nh");
 }
 
 function downloadFBPTree(id){
-    $.ajax({
-	url: "/api/analysis/"+id,
-	dataType: 'json',
- 	async: true,
- 	success: function(data) {
-	    var analysis = data;
-	    if(analysis.status == 2 || analysis.status == 5){
-		download(analysis.fbptree, "boosterweb_fbp.nh", "text/plain");
-	    }
-	}
-    });
+    downloadFile(id, "fbp.nh");
 }
 
 function downloadAlignment(id){
-    $.ajax({
-	url: "/api/analysis/"+id,
-	dataType: 'json',
- 	async: true,
- 	success: function(data) {
-	    var analysis = data;
-	    if(analysis.status == 2 || analysis.status == 5){
-		download(analysis.align, "alignment.fa", "text/plain");
-	    }
-	}
-    });
+    downloadFile(id, "alignment.fa");
 }
 
 function downloadLogs(id){
+    downloadFile(id, "tbe_logs.txt");
+}
+
+function downloadBundle(id){
+    window.location.href = "/api/analysis/"+id+"/bundle";
+}
+
+function exportTree(id, format){
+    window.location.href = "/api/analysis/"+id+"/export/"+format;
+}
+
+function cancelAnalysis(id){
+    if(!confirm("Do you really want to cancel this analysis?")){
+	return;
+    }
     $.ajax({
 	url: "/api/analysis/"+id,
+	type: 'DELETE',
 	dataType: 'json',
  	async: true,
  	success: function(data) {
-	    var analysis = data;
-	    if(analysis.status == 2 || analysis.status == 5){
-		download(analysis.tbelogs, "boosterweb_tbe_logs.txt", "text/plain");
+	    location.reload();
+	},
+	error: function(resultat, statut, erreur){
+	    var message = erreur;
+	    if(resultat.responseJSON){
+		message = resultat.responseJSON.message;
 	    }
+	    alert("Analysis could not be canceled: "+message);
 	}
     });
 }
+
+/* Follows the status and progress of a pending or running analysis
+   (Server-Sent Events), and reloads the page when it is over.
+   Without EventSource, the page is reloaded every 15 seconds */
+function followAnalysis(id){
+    if(!window.EventSource){
+	setTimeout(function(){ location.reload(); }, 15000);
+	return;
+    }
+    var source = new EventSource("/api/analysis/"+id+"/events");
+    var update = function(e){
+	var data = JSON.parse(e.data);
+	$("#status").text(data.statusstr);
+	$("#message").text(data.message);
+	$("#nboot").text(data.nboot);
+	if(data.status != 0 && data.status != 1){
+	    source.close();
+	    location.reload();
+	}
+    };
+    source.addEventListener("status", update);
+    source.addEventListener("progress", update);
+}
@@ -0,0 +1,199 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+package workflow
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/evolbioinfo/booster-web/model"
+	"github.com/evolbioinfo/goalign/align"
+	"github.com/evolbioinfo/goalign/io/phylip"
+)
+
+const CITATION_FASTTREE = "Price, M. N., Dehal, P. S., & Arkin, A. P. (2009). FastTree: computing large minimum evolution trees with profiles instead of a distance matrix. Molecular biology and evolution, 26(7), 1641-1650."
+
+// FastTree: infers the reference and bootstrap trees with GTR+Gamma
+// (nucleotides) or LG+Gamma (amino acids) by default
+type fastTree struct{}
+
+// Options of FastTree for the substitution models (JC and JTT: none)
+var fastTreeModels = map[string]string{
+	"GTR": "-gtr",
+	"JC":  "",
+	"LG":  "-lg",
+	"WAG": "-wag",
+	"JTT": "",
+}
+
+func init() {
+	Register(fastTree{})
+}
+
+func (fastTree) Id() int {
+	return model.WORKFLOW_FASTTREE
+}
+
+func (fastTree) Name() string {
+	return "FastTree"
+}
+
+func (fastTree) Description() string {
+	return "faster, for large datasets"
+}
+
+func (fastTree) Key() string {
+	return "fasttree"
+}
+
+func (fastTree) InputFormat() string {
+	return FORMAT_FASTA
+}
+
+func (fastTree) Citations() []string {
+	return []string{CITATION_FASTTREE}
+}
+
+func (w fastTree) CheckParams(a *model.Analysis) (err error) {
+	if err = checkParam(w, "criterion", a.Criterion); err != nil {
+		return
+	}
+	if err = checkParam(w, "moves", a.Moves); err != nil {
+		return
+	}
+	if err = checkModel(w, a, []string{"GTR", "JC"}, []string{"LG", "WAG", "JTT"}); err != nil {
+		return
+	}
+	return checkGamma(w, a, true)
+}
+
+// Options of the substitution model and of the gamma rates
+func fastTreeOptions(a *model.Analysis) (modeldna, modelprot, gamma string) {
+	modeldna, modelprot, gamma = "-gtr", "-lg", "-gamma"
+	if a.AlignAlphabet == model.ALIGN_AMINOACIDS && a.Model != "" {
+		modelprot = fastTreeModels[a.Model]
+	} else if a.Model != "" {
+		modeldna = fastTreeModels[a.Model]
+	}
+	if a.NoGamma {
+		gamma = ""
+	}
+	return
+}
+
+func (fastTree) EstimateRunStats(a *model.Analysis) (mem, time float64) {
+	alphabetsize := 4.0
+	if a.AlignAlphabet == align.AMINOACIDS {
+		alphabetsize = 20.0
+	}
+
+	time = 0.5071 +
+		0.00000006141*math.Pow(float64(a.AlignNbSeq), 1.5)*math.Log(float64(a.AlignNbSeq))*float64(a.AlignLength)*alphabetsize
+	mem = 2872 +
+		0.003412*(math.Pow(float64(a.AlignNbSeq), 1.5)+float64(a.AlignNbSeq)*float64(a.AlignLength)*alphabetsize)
+	time *= float64(a.NbootRep)
+	return
+}
+
+func (fastTree) GalaxyParameters(a *model.Analysis) (params map[string]string, err error) {
+	var seqtype string
+
+	if seqtype, err = seqType(a, "", "-nt"); err != nil {
+		return
+	}
+	modeldna, modelprot, gamma := fastTreeOptions(a)
+	params = map[string]string{
+		"sequence_type|seqtype":   seqtype,
+		"sequence_type|modelprot": modelprot,
+		"sequence_type|modeldna":  modeldna,
+		"gamma":                   gamma,
+		"bootstrap|do_bootstrap":  "true",
+		"bootstrap|replicates":    fmt.Sprintf("%d", a.NbootRep),
+	}
+	return
+}
+
+func (fastTree) GalaxyFbpOutput() string {
+	return "out_tree"
+}
+
+func (fastTree) GalaxyFbpScale(a *model.Analysis) float64 {
+	return 1.0
+}
+
+// Infers the reference tree on the alignment, and the bootstrap trees
+// on bootstrap alignments (FastTree -n), as the galaxy tool.
+func (fastTree) Infer(ctx context.Context, r Runner, a *model.Analysis, workdir, reffile, bootfile string) (err error) {
+	var args []string
+	var al align.Alignment
+	var f *os.File
+
+	modeldna, modelprot, gamma := fastTreeOptions(a)
+	switch a.AlignAlphabet {
+	case model.ALIGN_AMINOACIDS:
+		args = options(modelprot, gamma)
+	case model.ALIGN_NUCLEOTIDS:
+		args = options("-nt", modeldna, gamma)
+	default:
+		return errors.New("Unkown sequence alphabet in alignment")
+	}
+	// Number of threads of FastTreeMP
+	env := []string{fmt.Sprintf("OMP_NUM_THREADS=%d", r.Threads())}
+
+	r.SetMessage("Inferring reference tree with FastTree")
+	if err = r.Run(ctx, workdir, reffile, env, append(args, a.SeqAlign)...); err != nil {
+		return
+	}
+
+	// Bootstrap alignments, in one phylip file
+	r.SetMessage(fmt.Sprintf("Building %d bootstrap alignments", a.NbootRep))
+	if al, err = readAlignment(a.SeqAlign); err != nil {
+		return
+	}
+	bootaligns := filepath.Join(workdir, "boot.phy")
+	if f, err = os.Create(bootaligns); err != nil {
+		return
+	}
+	w := bufio.NewWriter(f)
+	for i := 0; i < a.NbootRep && err == nil; i++ {
+		if err = ctx.Err(); err == nil {
+			_, err = w.WriteString(phylip.WriteAlignment(al.BuildBootstrap(), false, false, false))
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	f.Close()
+	if err != nil {
+		return
+	}
+
+	r.SetMessage(fmt.Sprintf("Inferring %d bootstrap trees with FastTree", a.NbootRep))
+	return r.Run(ctx, workdir, bootfile, env, append(args, "-n", fmt.Sprintf("%d", a.NbootRep), bootaligns)...)
+}
@@ -0,0 +1,175 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/evolbioinfo/booster-web/model"
+	"github.com/evolbioinfo/goalign/align"
+)
+
+const (
+	CITATION_IQTREE      = "Minh, B. Q., Schmidt, H. A., Chernomor, O., Schrempf, D., Woodhams, M. D., von Haeseler, A., & Lanfear, R. (2020). IQ-TREE 2: New models and efficient methods for phylogenetic inference in the genomic era. Molecular Biology and Evolution, 37(5), 1530-1534."
+	CITATION_MODELFINDER = "Kalyaanamoorthy, S., Minh, B. Q., Wong, T. K. F., von Haeseler, A., & Jermiin, L. S. (2017). ModelFinder: fast model selection for accurate phylogenetic estimates. Nature Methods, 14(6), 587-589."
+)
+
+// IQ-TREE: selects the model with ModelFinder (unless a model is given),
+// and infers the reference and the bootstrap trees (standard bootstrap)
+// with IQ-TREE 2
+type iqTree struct{}
+
+func init() {
+	Register(iqTree{})
+}
+
+func (iqTree) Id() int {
+	return model.WORKFLOW_IQTREE
+}
+
+func (iqTree) Name() string {
+	return "IQ-TREE"
+}
+
+func (iqTree) Description() string {
+	return "ModelFinder + standard bootstrap"
+}
+
+func (iqTree) Key() string {
+	return "iqtree"
+}
+
+func (iqTree) InputFormat() string {
+	return FORMAT_FASTA
+}
+
+func (iqTree) Citations() []string {
+	return []string{CITATION_IQTREE, CITATION_MODELFINDER}
+}
+
+// The criterion is used by ModelFinder, and gamma may only
+// be disabled with a given model
+func (w iqTree) CheckParams(a *model.Analysis) (err error) {
+	if err = checkParam(w, "moves", a.Moves); err != nil {
+		return
+	}
+	if err = checkModel(w, a, []string{"GTR", "HKY", "K80", "JC"}, []string{"LG", "WAG", "JTT"}); err != nil {
+		return
+	}
+	if a.Model == "" {
+		err = checkGamma(w, a, false)
+	} else if a.Criterion != "" {
+		err = &ParamError{"criterion", "IQ-TREE criterion is only used to select the model, when no model is given"}
+	}
+	if err != nil {
+		return
+	}
+	return checkParam(w, "criterion", a.Criterion, "AIC", "BIC")
+}
+
+// Model given to IQ-TREE: MFP (ModelFinder) if none is given
+func iqTreeModel(a *model.Analysis) string {
+	if a.Model == "" {
+		return "MFP"
+	}
+	if a.NoGamma {
+		return a.Model
+	}
+	return a.Model + "+G"
+}
+
+// Rough estimation, not fitted on runs as the other ones: memory of the
+// partial likelihoods (Bytes) of the 2n nodes (4 rate categories,
+// float64), and time (seconds) of one tree search (n.log(n) likelihood
+// evaluations) per bootstrap replicate, plus ModelFinder that evaluates
+// about 100 models on a starting tree.
+func (iqTree) EstimateRunStats(a *model.Analysis) (mem, time float64) {
+	alphabetsize := 4.0
+	if a.AlignAlphabet == align.AMINOACIDS {
+		alphabetsize = 20.0
+	}
+	cells := float64(a.AlignNbSeq) * float64(a.AlignLength) * alphabetsize
+
+	mem = 50000000 + 2*cells*4*8
+	time = 0.000003*cells*math.Log(float64(a.AlignNbSeq))*float64(a.NbootRep+1) +
+		0.000001*cells*100
+	return
+}
+
+func (iqTree) GalaxyParameters(a *model.Analysis) (params map[string]string, err error) {
+	var seqtype string
+
+	if seqtype, err = seqType(a, "AA", "DNA"); err != nil {
+		return
+	}
+	params = map[string]string{
+		"sequence|seqtype":     seqtype,
+		"model":                iqTreeModel(a),
+		"bootstrap|support":    "boot",
+		"bootstrap|replicates": fmt.Sprintf("%d", a.NbootRep),
+	}
+	if a.Criterion != "" {
+		params["merit"] = a.Criterion
+	}
+	return
+}
+
+func (iqTree) GalaxyFbpOutput() string {
+	return "out_tree"
+}
+
+func (iqTree) GalaxyFbpScale(a *model.Analysis) float64 {
+	return 1.0
+}
+
+func (iqTree) Infer(ctx context.Context, r Runner, a *model.Analysis, workdir, reffile, bootfile string) (err error) {
+	var seqtype string
+
+	if seqtype, err = seqType(a, "AA", "DNA"); err != nil {
+		return
+	}
+
+	prefix := filepath.Join(workdir, "iqtree")
+	args := []string{"-s", a.SeqAlign, "-st", seqtype, "-m", iqTreeModel(a), "-b", fmt.Sprintf("%d", a.NbootRep),
+		"-T", fmt.Sprintf("%d", r.Threads()), "--prefix", prefix, "-quiet"}
+	if a.Criterion != "" {
+		args = append(args, "-merit", a.Criterion)
+	}
+	if a.Model == "" {
+		r.SetMessage(fmt.Sprintf("Selecting model and inferring reference and %d bootstrap trees with IQ-TREE", a.NbootRep))
+	} else {
+		r.SetMessage(fmt.Sprintf("Inferring reference and %d bootstrap trees with IQ-TREE", a.NbootRep))
+	}
+	if err = r.Run(ctx, workdir, "", nil, args...); err != nil {
+		return
+	}
+	if err = os.Rename(prefix+".treefile", reffile); err != nil {
+		return
+	}
+	return os.Rename(prefix+".boottrees", bootfile)
+}
@@ -0,0 +1,164 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/evolbioinfo/booster-web/model"
+	"github.com/evolbioinfo/goalign/align"
+)
+
+const CITATION_PHYML_SMS = "Lefort, V., Longueville, J. E., & Gascuel, O. (2017). SMS: Smart Model Selection in PhyML. Molecular Biology and Evolution."
+
+// PhyML-SMS: selects the model (AIC by default), and infers the
+// reference and bootstrap trees (SPR moves by default) with PhyML
+type phyMLSMS struct{}
+
+func init() {
+	Register(phyMLSMS{})
+}
+
+func (phyMLSMS) Id() int {
+	return model.WORKFLOW_PHYML_SMS
+}
+
+func (phyMLSMS) Name() string {
+	return "PhyML-SMS"
+}
+
+func (phyMLSMS) Description() string {
+	return "slower, for small/medium datasets"
+}
+
+func (phyMLSMS) Key() string {
+	return "phyml"
+}
+
+func (phyMLSMS) InputFormat() string {
+	return FORMAT_PHYLIP
+}
+
+func (phyMLSMS) Citations() []string {
+	return []string{CITATION_PHYML_SMS}
+}
+
+// The substitution model and the gamma rates are selected by SMS
+func (w phyMLSMS) CheckParams(a *model.Analysis) (err error) {
+	if err = checkParam(w, "criterion", a.Criterion, "AIC", "BIC"); err != nil {
+		return
+	}
+	if err = checkParam(w, "moves", a.Moves, "NNI", "SPR"); err != nil {
+		return
+	}
+	if err = checkParam(w, "model", a.Model); err != nil {
+		return
+	}
+	return checkGamma(w, a, false)
+}
+
+func (phyMLSMS) EstimateRunStats(a *model.Analysis) (mem, time float64) {
+	alphabetweight := 0.0
+	if a.AlignAlphabet == align.AMINOACIDS {
+		alphabetweight = 1.1
+	}
+
+	time = 3.526 + 30.18*alphabetweight +
+		0.00002227*float64(a.AlignNbSeq*a.AlignNbSeq*a.AlignLength) +
+		0.00006672*alphabetweight*float64(a.AlignNbSeq*a.AlignNbSeq*a.AlignLength)
+	mem = 3352.7636 -
+		884.7005*alphabetweight +
+		158.6359*float64(a.AlignNbSeq) -
+		5.0467*float64(a.AlignLength) +
+		81.0603*float64(a.AlignNbSeq)*alphabetweight -
+		51.2838*float64(a.AlignLength)*alphabetweight +
+		0.3754*float64(a.AlignLength*a.AlignNbSeq) +
+		1.7922*float64(a.AlignLength*a.AlignNbSeq)*alphabetweight
+
+	time *= float64(a.NbootRep)
+	return
+}
+
+func (phyMLSMS) GalaxyParameters(a *model.Analysis) (params map[string]string, err error) {
+	var seqtype string
+
+	if seqtype, err = seqType(a, "aa", "nt"); err != nil {
+		return
+	}
+	params = map[string]string{
+		"sequence|seqtype":     seqtype,
+		"stat_crit":            strings.ToLower(paramOrDefault(a.Criterion, "AIC")),
+		"move":                 paramOrDefault(a.Moves, "SPR"),
+		"bootstrap|support":    "boot",
+		"bootstrap|replicates": fmt.Sprintf("%d", a.NbootRep),
+	}
+	return
+}
+
+func (phyMLSMS) GalaxyFbpOutput() string {
+	return "out_tree"
+}
+
+// PhyML gives supports in [0,nbootrep]
+func (phyMLSMS) GalaxyFbpScale(a *model.Analysis) float64 {
+	return 1.0 / float64(a.NbootRep)
+}
+
+// The executable is sms.sh. PhyML writes its output trees next to
+// the alignment: it is copied in the work directory first.
+func (phyMLSMS) Infer(ctx context.Context, r Runner, a *model.Analysis, workdir, reffile, bootfile string) (err error) {
+	var seqtype string
+	var reftree, boottree string
+
+	if seqtype, err = seqType(a, "aa", "nt"); err != nil {
+		return
+	}
+
+	input := filepath.Join(workdir, "align.phy")
+	if err = copyFile(a.SeqAlign, input); err != nil {
+		return
+	}
+
+	r.SetMessage(fmt.Sprintf("Selecting model and inferring reference and %d bootstrap trees with PhyML-SMS", a.NbootRep))
+	if err = r.Run(ctx, workdir, "", nil,
+		"-i", input, "-d", seqtype, "-o", workdir, "-c", paramOrDefault(a.Criterion, "AIC"), "-s", paramOrDefault(a.Moves, "SPR"),
+		"-t", "-b", fmt.Sprintf("%d", a.NbootRep)); err != nil {
+		return
+	}
+
+	if reftree, err = findOutput(workdir, "*_phyml_tree*"); err != nil {
+		return
+	}
+	if boottree, err = findOutput(workdir, "*_phyml_boot_trees*"); err != nil {
+		return
+	}
+	if err = os.Rename(reftree, reffile); err != nil {
+		return
+	}
+	return os.Rename(boottree, bootfile)
+}
@@ -0,0 +1,151 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/evolbioinfo/booster-web/model"
+	"github.com/evolbioinfo/goalign/align"
+)
+
+const CITATION_RAXMLNG = "Kozlov, A. M., Darriba, D., Flouri, T., Morel, B., & Stamatakis, A. (2019). RAxML-NG: a fast, scalable and user-friendly tool for maximum likelihood phylogenetic inference. Bioinformatics, 35(21), 4453-4455."
+
+// RAxML-NG: infers the reference and the bootstrap trees with
+// GTR+Gamma (nucleotides) or LG+Gamma (amino acids) by default
+type raxmlNG struct{}
+
+func init() {
+	Register(raxmlNG{})
+}
+
+func (raxmlNG) Id() int {
+	return model.WORKFLOW_RAXMLNG
+}
+
+func (raxmlNG) Name() string {
+	return "RAxML-NG"
+}
+
+func (raxmlNG) Description() string {
+	return ""
+}
+
+func (raxmlNG) Key() string {
+	return "raxmlng"
+}
+
+func (raxmlNG) InputFormat() string {
+	return FORMAT_FASTA
+}
+
+func (raxmlNG) Citations() []string {
+	return []string{CITATION_RAXMLNG}
+}
+
+func (w raxmlNG) CheckParams(a *model.Analysis) (err error) {
+	if err = checkParam(w, "criterion", a.Criterion); err != nil {
+		return
+	}
+	if err = checkParam(w, "moves", a.Moves); err != nil {
+		return
+	}
+	if err = checkModel(w, a, []string{"GTR", "HKY", "K80", "JC"}, []string{"LG", "WAG", "JTT"}); err != nil {
+		return
+	}
+	return checkGamma(w, a, true)
+}
+
+// Rough estimation, computed as for IQ-TREE, without model selection
+func (raxmlNG) EstimateRunStats(a *model.Analysis) (mem, time float64) {
+	alphabetsize := 4.0
+	if a.AlignAlphabet == align.AMINOACIDS {
+		alphabetsize = 20.0
+	}
+	cells := float64(a.AlignNbSeq) * float64(a.AlignLength) * alphabetsize
+
+	mem = 20000000 + 2*cells*4*8
+	time = 0.000002 * cells * math.Log(float64(a.AlignNbSeq)) * float64(a.NbootRep+1)
+	return
+}
+
+func (raxmlNG) GalaxyParameters(a *model.Analysis) (params map[string]string, err error) {
+	var seqtype string
+
+	if seqtype, err = seqType(a, "aa", "nt"); err != nil {
+		return
+	}
+	params = map[string]string{
+		"sequence|seqtype":     seqtype,
+		"sequence|model":       raxmlNGModel(a),
+		"bootstrap|replicates": fmt.Sprintf("%d", a.NbootRep),
+	}
+	return
+}
+
+func (raxmlNG) GalaxyFbpOutput() string {
+	return "out_tree"
+}
+
+func (raxmlNG) GalaxyFbpScale(a *model.Analysis) float64 {
+	return 1.0
+}
+
+func (raxmlNG) Infer(ctx context.Context, r Runner, a *model.Analysis, workdir, reffile, bootfile string) (err error) {
+	var seqtype string
+
+	if seqtype, err = seqType(a, "AA", "DNA"); err != nil {
+		return
+	}
+
+	prefix := filepath.Join(workdir, "raxml")
+	r.SetMessage(fmt.Sprintf("Inferring reference and %d bootstrap trees with RAxML-NG", a.NbootRep))
+	if err = r.Run(ctx, workdir, "", nil,
+		"--all", "--msa", a.SeqAlign, "--data-type", seqtype, "--model", raxmlNGModel(a),
+		"--bs-trees", fmt.Sprintf("%d", a.NbootRep), "--threads", fmt.Sprintf("%d", r.Threads()),
+		"--prefix", prefix); err != nil {
+		return
+	}
+	if err = os.Rename(prefix+".raxml.bestTree", reffile); err != nil {
+		return
+	}
+	return os.Rename(prefix+".raxml.bootstraps", bootfile)
+}
+
+func raxmlNGModel(a *model.Analysis) (submodel string) {
+	submodel = a.Model
+	if submodel == "" && a.AlignAlphabet == model.ALIGN_AMINOACIDS {
+		submodel = "LG"
+	} else if submodel == "" {
+		submodel = "GTR"
+	}
+	if !a.NoGamma {
+		submodel += "+G"
+	}
+	return
+}
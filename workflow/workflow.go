@@ -0,0 +1,275 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+package workflow
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	goio "io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/evolbioinfo/booster-web/model"
+	"github.com/evolbioinfo/goalign/align"
+	autils "github.com/evolbioinfo/goalign/io/utils"
+)
+
+// Formats of the alignments given to the workflows
+// (also the galaxy datatypes of the uploaded alignments)
+const (
+	FORMAT_FASTA  = "fasta"
+	FORMAT_PHYLIP = "phylip"
+)
+
+// A phylogenetic workflow infers the reference tree and the bootstrap
+// trees from a sequence alignment, before supports are computed by booster.
+//
+// Each workflow is defined in its own file of this package, and registered
+// in its init function.
+type Workflow interface {
+	// Code of the workflow, stored with the analyses (model.Analysis.Workflow)
+	Id() int
+	// Name of the workflow, chosen by users (ex: "FastTree")
+	Name() string
+	// Short description, shown in the submission form
+	Description() string
+	// Key of the workflow in the configuration file:
+	// galaxy.tools.<key> and runners.<key>
+	Key() string
+	// Format of the alignment given to the tools: FORMAT_FASTA or FORMAT_PHYLIP
+	InputFormat() string
+	// References of the tree inference tools
+	Citations() []string
+	// Checks the inference parameters of the analysis (model.InferenceParams),
+	// given its alignment alphabet. Returns a *ParamError if one is not supported.
+	CheckParams(a *model.Analysis) error
+
+	// Estimated memory (Bytes) and time (seconds) of the tree inferences,
+	// to refuse analyses that are too large for the galaxy server
+	EstimateRunStats(a *model.Analysis) (mem, time float64)
+	// Parameters of the galaxy tool, that takes the alignment as "input_align"
+	GalaxyParameters(a *model.Analysis) (params map[string]string, err error)
+	// Output of the galaxy tool giving the reference tree with FBP supports
+	GalaxyFbpOutput() string
+	// Factor scaling the FBP supports of this output to [0,1]
+	GalaxyFbpScale(a *model.Analysis) float64
+
+	// Infers the trees locally, with the executable of the runner, and writes
+	// them in reffile and bootfile. workdir is a temp directory for the tools.
+	Infer(ctx context.Context, r Runner, a *model.Analysis, workdir, reffile, bootfile string) error
+}
+
+// Runs the executable of a workflow for the local processor
+type Runner interface {
+	// Runs the executable in dir and writes its standard output in the
+	// file out (discarded if empty). It is killed if ctx is canceled.
+	Run(ctx context.Context, dir, out string, env []string, args ...string) error
+	// Updates the message of the analysis, to follow its progress
+	SetMessage(message string)
+	// Number of threads the executable may use
+	Threads() int
+}
+
+// Inference parameter of an analysis that is not supported by its workflow
+type ParamError struct {
+	Param   string // criterion, moves, model or nogamma
+	Message string
+}
+
+func (e *ParamError) Error() string {
+	return e.Message
+}
+
+var registry = make(map[int]Workflow)
+
+// Registers the workflow. Panics if its code or its name is already registered
+func Register(w Workflow) {
+	if _, ok := registry[w.Id()]; ok {
+		panic(fmt.Sprintf("Workflow %d already registered", w.Id()))
+	}
+	if _, err := ByName(w.Name()); err == nil {
+		panic(fmt.Sprintf("Workflow %s already registered", w.Name()))
+	}
+	registry[w.Id()] = w
+}
+
+// Returns the workflow with the given code
+func Get(id int) (w Workflow, ok bool) {
+	w, ok = registry[id]
+	return
+}
+
+// Returns the workflow with the given name
+func ByName(name string) (w Workflow, err error) {
+	for _, w = range registry {
+		if w.Name() == name {
+			return
+		}
+	}
+	return nil, errors.New(fmt.Sprintf("Phylogenetic workflow does not exist: %s", name))
+}
+
+// All registered workflows, ordered by code
+func All() (workflows []Workflow) {
+	for _, w := range registry {
+		workflows = append(workflows, w)
+	}
+	sort.Slice(workflows, func(i, j int) bool { return workflows[i].Id() < workflows[j].Id() })
+	return
+}
+
+// Name of the workflow with the given code
+func Name(id int) string {
+	if id == model.WORKFLOW_NIL {
+		return "Bootstrap alone"
+	}
+	if w, ok := registry[id]; ok {
+		return w.Name()
+	}
+	return "Unknown"
+}
+
+// References of the tree inference tools of the workflow
+// with the given code, nil if it does not exist
+func Citations(id int) []string {
+	if w, ok := registry[id]; ok {
+		return w.Citations()
+	}
+	return nil
+}
+
+// Checks that the value of the inference parameter is empty (default)
+// or one of the allowed values. Without allowed values, the parameter
+// is not supported by the workflow.
+func checkParam(w Workflow, param, value string, allowed ...string) error {
+	if value == "" {
+		return nil
+	}
+	for _, v := range allowed {
+		if v == value {
+			return nil
+		}
+	}
+	if len(allowed) == 0 {
+		return &ParamError{param, fmt.Sprintf("Parameter %s is not supported by %s", param, w.Name())}
+	}
+	return &ParamError{param, fmt.Sprintf("%s %s must be one of %s", w.Name(), param, strings.Join(allowed, ", "))}
+}
+
+// Checks the substitution model of the analysis, depending on
+// the alphabet of its alignment
+func checkModel(w Workflow, a *model.Analysis, nucleotides, aminoacids []string) error {
+	if a.AlignAlphabet == model.ALIGN_AMINOACIDS {
+		return checkParam(w, "model", a.Model, aminoacids...)
+	}
+	return checkParam(w, "model", a.Model, nucleotides...)
+}
+
+// Checks that gamma is not disabled if the workflow does not support it
+func checkGamma(w Workflow, a *model.Analysis, supported bool) error {
+	if a.NoGamma && !supported {
+		return &ParamError{"nogamma", fmt.Sprintf("Disabling gamma is not supported by %s", w.Name())}
+	}
+	return nil
+}
+
+// Value of the parameter, or its default value if empty
+func paramOrDefault(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
+
+// Command line options, without the empty ones
+func options(opts ...string) (args []string) {
+	for _, o := range opts {
+		if o != "" {
+			args = append(args, o)
+		}
+	}
+	return
+}
+
+// Value of the sequence type parameter of the tools, depending
+// on the alphabet of the alignment
+func seqType(a *model.Analysis, aminoacids, nucleotides string) (seqtype string, err error) {
+	switch a.AlignAlphabet {
+	case model.ALIGN_AMINOACIDS:
+		seqtype = aminoacids
+	case model.ALIGN_NUCLEOTIDS:
+		seqtype = nucleotides
+	default:
+		err = errors.New("Unkown sequence alphabet in alignment")
+	}
+	return
+}
+
+func readAlignment(file string) (al align.Alignment, err error) {
+	var f goio.Closer
+	var r *bufio.Reader
+
+	if f, r, err = autils.GetReader(file); err != nil {
+		return
+	}
+	defer f.Close()
+	al, _, err = autils.ParseAlignmentAuto(r, false)
+	return
+}
+
+// Returns the only file of dir matching the pattern
+func findOutput(dir, pattern string) (file string, err error) {
+	var files []string
+
+	if files, err = filepath.Glob(filepath.Join(dir, pattern)); err != nil {
+		return
+	}
+	if len(files) != 1 {
+		err = fmt.Errorf("Error while getting output file %s of the workflow: %d files found", pattern, len(files))
+		return
+	}
+	file = files[0]
+	return
+}
+
+func copyFile(src, dst string) (err error) {
+	var in, out *os.File
+
+	if in, err = os.Open(src); err != nil {
+		return
+	}
+	defer in.Close()
+	if out, err = os.Create(dst); err != nil {
+		return
+	}
+	if _, err = goio.Copy(out, in); err != nil {
+		out.Close()
+		return
+	}
+	return out.Close()
+}
@@ -0,0 +1,94 @@
+/*
+
+BOOSTER-WEB: Web interface to BOOSTER (https://github.com/evolbioinfo/booster)
+Alternative method to compute bootstrap branch supports in large trees.
+
+Copyright (C) 2017 BOOSTER-WEB dev team
+
+This program is free software; you can redistribute it and/or
+modify it under the terms of the GNU General Public License
+as published by the Free Software Foundation; either version 2
+of the License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program; if not, write to the Free Software
+Foundation, Inc., 51 Franklin Street, Fifth Floor, Boston, MA  02110-1301, USA.
+
+*/
+
+package workflow
+
+import (
+	"testing"
+
+	"github.com/evolbioinfo/booster-web/model"
+)
+
+// Inference parameters of each workflow: param is the parameter
+// reported in the error, empty if the parameters are allowed
+func TestCheckParams(t *testing.T) {
+	nt, aa := model.ALIGN_NUCLEOTIDS, model.ALIGN_AMINOACIDS
+	for _, test := range []struct {
+		workflow int
+		alphabet int
+		params   model.InferenceParams
+		param    string
+	}{
+		{model.WORKFLOW_PHYML_SMS, nt, model.InferenceParams{}, ""},
+		{model.WORKFLOW_PHYML_SMS, nt, model.InferenceParams{Criterion: "BIC", Moves: "SPR"}, ""},
+		{model.WORKFLOW_PHYML_SMS, nt, model.InferenceParams{Criterion: "AICc"}, "criterion"},
+		{model.WORKFLOW_PHYML_SMS, nt, model.InferenceParams{Moves: "TBR"}, "moves"},
+		{model.WORKFLOW_PHYML_SMS, nt, model.InferenceParams{Model: "GTR"}, "model"},
+		{model.WORKFLOW_PHYML_SMS, nt, model.InferenceParams{NoGamma: true}, "nogamma"},
+
+		{model.WORKFLOW_FASTTREE, nt, model.InferenceParams{}, ""},
+		{model.WORKFLOW_FASTTREE, nt, model.InferenceParams{Model: "JC", NoGamma: true}, ""},
+		{model.WORKFLOW_FASTTREE, aa, model.InferenceParams{Model: "WAG"}, ""},
+		{model.WORKFLOW_FASTTREE, nt, model.InferenceParams{NoGamma: true}, ""},
+		{model.WORKFLOW_FASTTREE, nt, model.InferenceParams{Criterion: "AIC"}, "criterion"},
+		{model.WORKFLOW_FASTTREE, nt, model.InferenceParams{Moves: "NNI"}, "moves"},
+		{model.WORKFLOW_FASTTREE, nt, model.InferenceParams{Model: "HKY"}, "model"},
+		{model.WORKFLOW_FASTTREE, aa, model.InferenceParams{Model: "GTR"}, "model"},
+
+		{model.WORKFLOW_IQTREE, nt, model.InferenceParams{}, ""},
+		{model.WORKFLOW_IQTREE, nt, model.InferenceParams{Criterion: "AIC"}, ""},
+		{model.WORKFLOW_IQTREE, nt, model.InferenceParams{Model: "HKY", NoGamma: true}, ""},
+		{model.WORKFLOW_IQTREE, aa, model.InferenceParams{Model: "JTT"}, ""},
+		{model.WORKFLOW_IQTREE, nt, model.InferenceParams{Criterion: "BIC", Model: "GTR"}, "criterion"},
+		{model.WORKFLOW_IQTREE, nt, model.InferenceParams{NoGamma: true}, "nogamma"},
+		{model.WORKFLOW_IQTREE, nt, model.InferenceParams{Criterion: "AICc"}, "criterion"},
+		{model.WORKFLOW_IQTREE, nt, model.InferenceParams{Moves: "SPR"}, "moves"},
+		{model.WORKFLOW_IQTREE, aa, model.InferenceParams{Model: "K80"}, "model"},
+
+		{model.WORKFLOW_RAXMLNG, nt, model.InferenceParams{}, ""},
+		{model.WORKFLOW_RAXMLNG, nt, model.InferenceParams{Model: "K80", NoGamma: true}, ""},
+		{model.WORKFLOW_RAXMLNG, aa, model.InferenceParams{Model: "LG"}, ""},
+		{model.WORKFLOW_RAXMLNG, nt, model.InferenceParams{NoGamma: true}, ""},
+		{model.WORKFLOW_RAXMLNG, nt, model.InferenceParams{Criterion: "AIC"}, "criterion"},
+		{model.WORKFLOW_RAXMLNG, nt, model.InferenceParams{Moves: "NNI"}, "moves"},
+		{model.WORKFLOW_RAXMLNG, nt, model.InferenceParams{Model: "WAG"}, "model"},
+	} {
+		w, ok := Get(test.workflow)
+		if !ok {
+			t.Fatalf("workflow %d is not registered", test.workflow)
+		}
+		a := model.NewAnalysis()
+		a.AlignAlphabet = test.alphabet
+		a.InferenceParams = test.params
+		err := w.CheckParams(a)
+		if test.param == "" {
+			if err != nil {
+				t.Errorf("%s %+v: expected allowed parameters, got %v", w.Name(), test.params, err)
+			}
+			continue
+		}
+		if perr, ok := err.(*ParamError); !ok || perr.Param != test.param {
+			t.Errorf("%s %+v: expected an error on %s, got %v", w.Name(), test.params, test.param, err)
+		}
+	}
+}